@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/FortuneW/gollmperf/internal/cluster"
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/gollmperf/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// agentTokenEnv is the environment variable of the shared secret of the agents
+const agentTokenEnv = "GOLLMPERF_AGENT_TOKEN"
+
+// agentFlags are the flags of the agent, its local options are not taken from the plans of the coordinator
+var agentFlags struct {
+	Listen         string
+	Token          string
+	TLSCert        string
+	TLSKey         string
+	Tokenizer      string
+	ADTokenFile    string
+	ADTokenCommand string
+}
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run an agent of distributed load generation",
+	Long: `Run an agent which sends its share of the tests of a coordinator, started by run with --agents,
+and streams the results back to it. The coordinator must hold the token of the agent.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if agentFlags.Token == "" {
+			mlog.Errorf("Agent token must be specified with --token or $%s", agentTokenEnv)
+			os.Exit(1)
+		}
+		if (agentFlags.TLSCert == "") != (agentFlags.TLSKey == "") {
+			mlog.Errorf("Both --tls-cert and --tls-key must be specified")
+			os.Exit(1)
+		}
+
+		handler := cluster.NewAgent(runAgentPlan, agentFlags.Token).Handler()
+		var err error
+		if agentFlags.TLSCert != "" {
+			mlog.Infof("Agent listening on %s (TLS)", agentFlags.Listen)
+			err = http.ListenAndServeTLS(agentFlags.Listen, agentFlags.TLSCert, agentFlags.TLSKey, handler)
+		} else {
+			mlog.Infof("Agent listening on %s", agentFlags.Listen)
+			err = http.ListenAndServe(agentFlags.Listen, handler)
+		}
+		if err != nil {
+			mlog.Errorf("Agent failed: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	agentCmd.Flags().StringVarP(&agentFlags.Listen, "listen", "", "127.0.0.1:7070", "Address the agent listens on, e.g. :7070 for every interface")
+	agentCmd.Flags().StringVarP(&agentFlags.Token, "token", "", os.Getenv(agentTokenEnv), "Shared secret of the coordinators (default as $"+agentTokenEnv+")")
+	agentCmd.Flags().StringVarP(&agentFlags.TLSCert, "tls-cert", "", "", "TLS certificate file, to serve HTTPS")
+	agentCmd.Flags().StringVarP(&agentFlags.TLSKey, "tls-key", "", "", "TLS key file, to serve HTTPS")
+	agentCmd.Flags().StringVarP(&agentFlags.Tokenizer, "tokenizer", "", "", "Offline tokenizer file (HuggingFace tokenizer.json or tiktoken)")
+	agentCmd.Flags().StringVarP(&agentFlags.ADTokenFile, "ad-token-file", "", "", "File holding an Azure AD bearer token, for the azure provider")
+	agentCmd.Flags().StringVarP(&agentFlags.ADTokenCommand, "ad-token-command", "", "", "Command printing an Azure AD bearer token, for the azure provider")
+}
+
+// agentTokenizer caches the offline tokenizer of the plans, which is loaded once per file
+var agentTokenizer struct {
+	sync.Mutex
+	path string
+	tok  utils.Tokenizer
+}
+
+// runAgentPlan runs the plan of an agent like runTest runs a test, the tokenizer file is optional on the agent
+func runAgentPlan(ctx context.Context, plan *cluster.Plan, sink engine.ResultSink) error {
+	model := &plan.Config.Model
+	model.Tokenizer = agentFlags.Tokenizer
+	if agentFlags.ADTokenFile != "" || agentFlags.ADTokenCommand != "" {
+		azure, _ := model.Sections["azure"].(map[string]any)
+		if azure == nil {
+			azure = make(map[string]any)
+		}
+		azure["ad_token_file"], azure["ad_token_command"] = agentFlags.ADTokenFile, agentFlags.ADTokenCommand
+		if model.Sections == nil {
+			model.Sections = make(map[string]any)
+		}
+		model.Sections["azure"] = azure
+	}
+
+	prov, err := provider.New(&plan.Config.Model, plan.Config.Test.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+	testCtx := &TestContext{
+		Config:   plan.Config,
+		Provider: prov,
+		Dataset:  plan.Dataset,
+		Trace:    plan.Trace,
+	}
+
+	if path := plan.Config.Model.Tokenizer; path != "" {
+		agentTokenizer.Lock()
+		if agentTokenizer.path != path {
+			tok, err := utils.LoadTokenizer(path)
+			if err != nil {
+				mlog.Warnf("Failed to load tokenizer from %s: %v, counting tokens without it", path, err)
+			}
+			agentTokenizer.path, agentTokenizer.tok = path, tok
+		}
+		testCtx.Tokenizer = agentTokenizer.tok
+		agentTokenizer.Unlock()
+	}
+	if plan.Config.Dataset.Template || (plan.Config.PrefixCacheDataset.Enable && plan.Trace == nil) {
+		testCtx.Renderer = utils.NewTemplateRenderer(plan.TemplateVars)
+	}
+
+	return streamTest(ctx, testCtx, plan.Stress, sink)
+}
+
+// runDistributed splits a test across the agents of test.agents and streams their results to sink
+func runDistributed(runCtx context.Context, testCtx *TestContext, isStress bool, sink engine.ResultSink) error {
+	agents := testCtx.Config.Test.Agents
+	if testCtx.Config.Test.AgentToken == "" {
+		return fmt.Errorf("the token of the agents must be specified with test.agent_token, --agent-token or $%s", agentTokenEnv)
+	}
+	cfg, err := inlineBodyTemplate(testCtx.Config)
+	if err != nil {
+		return err
+	}
+	plan := &cluster.Plan{
+		Config:        cfg,
+		Stress:        isStress,
+		Dataset:       testCtx.Dataset,
+		Trace:         testCtx.Trace,
+		KeepResponses: !isStress && testCtx.Config.Output.BatchResultPath != "",
+	}
+	if testCtx.Renderer != nil {
+		plan.TemplateVars = testCtx.Renderer.Rows()
+	}
+
+	mlog.Infof("Splitting the test across %d agents: %v", len(agents), agents)
+	if err := cluster.NewCoordinator(agents, testCtx.Config.Test.AgentToken).Run(runCtx, cluster.Split(plan, len(agents)), sink); err != nil {
+		return fmt.Errorf("distributed test failed: %w", err)
+	}
+	return nil
+}
+
+// inlineBodyTemplate returns the config with the body template file of the generic provider read into its
+// body template, as the agents do not read the files named by a plan
+func inlineBodyTemplate(cfg *config.Config) (*config.Config, error) {
+	generic, _ := cfg.Model.Sections["generic"].(map[string]any)
+	path, _ := generic["body_template_file"].(string)
+	if path == "" || generic["body_template"] != nil {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body template file: %w", err)
+	}
+
+	inlined := *cfg
+	inlined.Model.Sections = maps.Clone(cfg.Model.Sections)
+	generic = maps.Clone(generic)
+	generic["body_template"] = string(data)
+	inlined.Model.Sections["generic"] = generic
+	return &inlined, nil
+}
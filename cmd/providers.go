@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/spf13/cobra"
+)
+
+var providersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "List the registered providers",
+	Long:  `List the providers which are built in, with their default endpoint and the keys of their model.<provider> config section.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, r := range provider.Registrations() {
+			fmt.Printf("%-10s %s\n", r.Name, r.Description)
+			if r.DefaultEndpoint != "" {
+				fmt.Printf("%-10s default endpoint: %s\n", "", r.DefaultEndpoint)
+			}
+			if keys := r.SchemaKeys(); len(keys) > 0 {
+				fmt.Printf("%-10s model.%s: %s\n", "", r.Name, strings.Join(keys, ", "))
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(providersCmd)
+}
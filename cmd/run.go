@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/FortuneW/gollmperf/internal/analyzer"
 	"github.com/FortuneW/gollmperf/internal/collector"
@@ -31,13 +37,20 @@ Run perf mode test to find performance limits in different concurrency levels`,
 		// Create reporter
 		r := reporter.NewReporter()
 
+		// Interrupting the test still reports the completed requests
+		runCtx := interruptContext(testCtx.Config.Test.DrainTimeout)
+
 		runOnceTest := func(ctx *TestContext, isStress bool) {
 			// Run test and get collector
-			col, err := runTest(ctx, isStress)
+			col, err := runTest(runCtx, ctx, isStress)
 			if err != nil {
 				mlog.Errorf("Failed to run test (stress mode: %v): %v", isStress, err)
 				os.Exit(1)
 			}
+			defer col.Close()
+			if runCtx.Err() != nil {
+				mlog.Warnf("Test interrupted, reporting the %d completed requests", col.GetTotalCount()-col.GetCancelledCount())
+			}
 
 			if !runFlags.NoReport {
 				// Analyze results
@@ -46,7 +59,65 @@ Run perf mode test to find performance limits in different concurrency levels`,
 				metrics := resultAnalyzer.Analyze()
 
 				// Generate console report
-				r.AddNewMetrics(testCtx.Config.Test.Concurrency, metrics)
+				if len(testCtx.Trace) > 0 {
+					// The offered load of a replay is the mean rate of its trace
+					r.AddNewRateMetrics(engine.TraceRate(testCtx.Trace, testCtx.Config.Test.Replay.Speed), metrics)
+				} else if isStress && len(testCtx.Config.Test.Stages) > 0 {
+					// Break the metrics down per stage, followed by the whole profile
+					for i, stage := range testCtx.Config.Test.Stages {
+						stageCol := col.GetStageCollector(engine.StageName(i, stage))
+						if stageCol.GetTotalCount() == 0 {
+							continue
+						}
+						r.AddNewStageMetrics(engine.StageName(i, stage), stage.Concurrency, stage.Rate,
+							analyzer.NewAnalyzer(stageCol).Analyze())
+					}
+					r.AddNewStageMetrics(reporter.StageAll, 0, 0, metrics)
+				} else if isStress && !runFlags.IsPerf && testCtx.Config.Dataset.Type == engine.DatasetSessions {
+					// Break the metrics down per turn, the context grows with each turn
+					concurrency := testCtx.Config.Test.Concurrency
+					for turn := 1; ; turn++ {
+						turnCol := col.GetTurnCollector(turn)
+						if turnCol.GetTotalCount() == 0 {
+							break
+						}
+						r.AddNewStageMetrics(fmt.Sprintf("turn-%d", turn), concurrency, 0, analyzer.NewAnalyzer(turnCol).Analyze())
+					}
+					r.AddNewStageMetrics(reporter.StageAll, concurrency, 0, metrics)
+				} else if !runFlags.IsPerf && testCtx.Config.PrefixCacheDataset.Enable {
+					// Compare the requests sharing a prefix with the unique ones, the warm-up ones which fill the cache
+					// of each group are only counted in the overall metrics
+					concurrency, rate := testCtx.Config.Test.Concurrency, 0.0
+					if isStress {
+						rate = testCtx.Config.Test.RequestRate
+					}
+					for _, prefix := range []string{utils.PrefixShared, utils.PrefixUnique} {
+						prefixCol := col.GetTagCollector(utils.PrefixTag, prefix)
+						if prefixCol.GetTotalCount() == 0 {
+							continue
+						}
+						r.AddNewStageMetrics("prefix-"+prefix, concurrency, rate, analyzer.NewAnalyzer(prefixCol).Analyze())
+					}
+					r.AddNewStageMetrics(reporter.StageAll, concurrency, rate, metrics)
+				} else if !runFlags.IsPerf && len(testCtx.Config.Dataset.Sources) > 0 && !testCtx.Config.RandomDatasetVLLM.Enable {
+					// Break the metrics of a mixed workload down per source
+					concurrency, rate := testCtx.Config.Test.Concurrency, 0.0
+					if isStress {
+						rate = testCtx.Config.Test.RequestRate
+					}
+					for _, src := range testCtx.Config.Dataset.Sources {
+						sourceCol := col.GetTagCollector(engine.SourceTag, src.Name)
+						if sourceCol.GetTotalCount() == 0 {
+							continue
+						}
+						r.AddNewStageMetrics("source-"+src.Name, concurrency, rate, analyzer.NewAnalyzer(sourceCol).Analyze())
+					}
+					r.AddNewStageMetrics(reporter.StageAll, concurrency, rate, metrics)
+				} else if isStress && testCtx.Config.Test.RequestRate > 0 {
+					r.AddNewRateMetrics(testCtx.Config.Test.RequestRate, metrics)
+				} else {
+					r.AddNewMetrics(testCtx.Config.Test.Concurrency, metrics)
+				}
 				if runFlags.ShowTableOnConsole {
 					r.GenerateConsoleTableReport()
 				} else {
@@ -60,7 +131,7 @@ Run perf mode test to find performance limits in different concurrency levels`,
 
 				// Save batch results in JSONL format if requested and in batch testing
 				if !isStress && testCtx.Config.Output.BatchResultPath != "" {
-					if err := utils.SaveBatchResultsToJSONL(col.GetAllResults(), testCtx.Config.Output.BatchResultPath); err != nil {
+					if err := utils.SaveBatchResultsToJSONL(col, testCtx.Config.Output.BatchResultPath); err != nil {
 						mlog.Errorf("failed to save batch results to JSONL file [%s]: %v", testCtx.Config.Output.BatchResultPath, err)
 					} else {
 						mlog.Infof("Batch results saved to %s", testCtx.Config.Output.BatchResultPath)
@@ -69,12 +140,34 @@ Run perf mode test to find performance limits in different concurrency levels`,
 			}
 		}
 
-		if !runFlags.IsPerf {
+		if runFlags.IsReplay {
+			if runFlags.IsBatch || runFlags.IsPerf || runFlags.IsSeek {
+				mlog.Errorf("Replay mode can not be combined with batch, perf or seek mode")
+				os.Exit(1)
+			}
+			if testCtx.Config.Test.RequestRate > 0 || len(testCtx.Config.Test.Stages) > 0 {
+				mlog.Warnf("Replay mode sends the requests at the times of the trace, request rate and stages are ignored")
+			}
+		} else if testCtx.Config.Dataset.Type == engine.DatasetSessions {
+			if runFlags.IsBatch {
+				mlog.Errorf("Session dataset can not be run in batch mode, its turns depend on the replies")
+				os.Exit(1)
+			}
+			ignoreLoadProfiles(testCtx, "Session")
+		}
+
+		if runFlags.IsSeek {
+			runSeek(runCtx, testCtx, r)
+		} else if !runFlags.IsPerf {
 			runOnceTest(testCtx, !runFlags.IsBatch)
 		} else {
 			// Run perf test
+			ignoreLoadProfiles(testCtx, "Perf")
 			mlog.Infof("Running perf mode with concurrency group: %v", testCtx.Config.Test.PerfConcurrencyGroup)
 			for _, concurrency := range testCtx.Config.Test.PerfConcurrencyGroup {
+				if runCtx.Err() != nil {
+					break
+				}
 				testCtx.Config.Test.Concurrency = concurrency
 				runOnceTest(testCtx, !runFlags.IsBatch)
 			}
@@ -88,9 +181,11 @@ func init() {
 	runCmd.Flags().BoolVarP(&runFlags.ShowTableOnConsole, "show-table", "s", false, "Show table on console")
 	runCmd.Flags().BoolVarP(&runFlags.IsBatch, "batch", "b", false, "Run batch mode, for run all case in dataset")
 	runCmd.Flags().BoolVarP(&runFlags.IsPerf, "perf", "p", false, "Run perf mode, for find performance limits in different concurrency levels")
+	runCmd.Flags().BoolVarP(&runFlags.IsSeek, "seek", "", false, "Run seek mode, for search the max concurrency at which the SLOs of test.seek hold")
+	runCmd.Flags().BoolVarP(&runFlags.IsReplay, "replay", "", false, "Run replay mode, for send the requests of the trace of test.replay at their recorded times")
 	runCmd.Flags().StringVarP(&runFlags.BatchResultFile, "batch-result", "", "", "Batch results file path (output batch results to JSONL file)")
 	runCmd.Flags().StringVarP(&runFlags.ConfigPath, "config", "c", "", "config file (default is ./example.yaml)")
-	runCmd.Flags().StringVarP(&runFlags.Provider, "provider", "P", "openai", "LLM provider (openai, qwen, etc.)")
+	runCmd.Flags().StringVarP(&runFlags.Provider, "provider", "P", "", "LLM provider (openai, qwen, azure, anthropic, gemini, ollama, generic) (default as config file)")
 	runCmd.Flags().StringVarP(&runFlags.Model, "model", "m", "", "Model name")
 	runCmd.Flags().StringVarP(&runFlags.Dataset, "dataset", "d", "", "Dataset file path")
 	runCmd.Flags().StringVarP(&runFlags.ApiKey, "apikey", "k", "", "API key")
@@ -100,31 +195,187 @@ func init() {
 	runCmd.Flags().BoolVarP(&runFlags.RandomEnable, "random-enable", "", false, "Enable random dataset generation for vLLM")
 	runCmd.Flags().IntVarP(&runFlags.RandomInputLen, "random-input-len", "", 0, "Input token length for random dataset")
 	runCmd.Flags().IntVarP(&runFlags.RandomOutputLen, "random-output-len", "", 0, "Output token length for random dataset")
+	runCmd.Flags().IntVarP(&runFlags.RandomNumPrompts, "random-num-prompts", "", 0, "Number of distinct prompts of random dataset (default as config file)")
+	runCmd.Flags().StringVarP(&runFlags.Tokenizer, "tokenizer", "", "", "Offline tokenizer file (HuggingFace tokenizer.json or tiktoken) (default as config file)")
+	runCmd.Flags().Float64VarP(&runFlags.RequestRate, "rate", "", 0, "Run open-loop mode at the target requests per second (default as config file)")
+	runCmd.Flags().IntVarP(&runFlags.MaxInflight, "max-inflight", "", 0, "Cap on requests in flight of open-loop mode (default as config file)")
+	runCmd.Flags().StringVarP(&runFlags.Trace, "trace", "", "", "Trace file of replay mode (default as config file)")
+	runCmd.Flags().Float64VarP(&runFlags.ReplaySpeed, "replay-speed", "", 0, "Time factor of replay mode, 2 replays twice as fast (default as config file)")
+	runCmd.Flags().StringSliceVarP(&runFlags.Agents, "agents", "", nil, "Agents (host:port) to split the test across, run by gollmperf agent (default as config file)")
+	runCmd.Flags().StringVarP(&runFlags.AgentToken, "agent-token", "", os.Getenv(agentTokenEnv), "Shared secret of the agents (default as config file or $"+agentTokenEnv+")")
+}
+
+// interruptContext returns a context which is cancelled on SIGINT or SIGTERM,
+// a second signal quits at once without waiting for the requests in flight
+func interruptContext(drainTimeout time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		mlog.Warnf("Received %v, stopping the test (drain timeout %v), send it again to quit at once", sig, drainTimeout)
+		cancel()
+		<-signals
+		mlog.Errorf("Received second signal, quitting")
+		os.Exit(130)
+	}()
+	return ctx
+}
+
+// runTest executes the test based on the test context and mode, the test stops early once runCtx is done.
+// The results are streamed to the result log of output.result_log, the returned collector must be closed.
+func runTest(runCtx context.Context, testCtx *TestContext, isStress bool) (*collector.Collector, error) {
+	// Only the batch results need the responses
+	keepResponses := !isStress && testCtx.Config.Output.BatchResultPath != ""
+	col, err := collector.NewLogCollector(testCtx.Config.Output.ResultLog, keepResponses)
+	if err != nil {
+		return nil, err
+	}
+	if err := streamTest(runCtx, testCtx, isStress, col); err != nil {
+		col.Close()
+		return nil, err
+	}
+	if err := col.Err(); err != nil {
+		col.Close()
+		return nil, fmt.Errorf("failed to store the results: %w", err)
+	}
+	return col, nil
 }
 
-// runTest executes the test based on the test context and mode
-func runTest(testCtx *TestContext, isStress bool) (*collector.Collector, error) {
+// streamTest executes the test based on the test context and mode streaming its results to sink,
+// the test stops early once runCtx is done
+func streamTest(runCtx context.Context, testCtx *TestContext, isStress bool, sink engine.ResultSink) error {
 	// Create engine
 	testEngine := engine.NewEngine(testCtx.Config, testCtx.Provider)
+	testEngine.SetResultSink(sink)
+	if testCtx.Tokenizer != nil {
+		testEngine.SetTokenCounter(testCtx.Tokenizer)
+	}
+	if testCtx.Renderer != nil {
+		testEngine.SetRequestRenderer(testCtx.Renderer)
+	}
 
 	// Run Test
-	if isStress {
+	if len(testCtx.Config.Test.Agents) > 0 {
+		defer qlog.TimeTrackWithDebug(mlog, "RunDistributed")()
+		return runDistributed(runCtx, testCtx, isStress, sink)
+	} else if len(testCtx.Trace) > 0 {
+		defer qlog.TimeTrackWithDebug(mlog, "RunReplay")()
+		mlog.Debugf("Running replay mode with provider: %s [%s], model: [%s]",
+			testCtx.Config.Model.Provider, testCtx.Config.Model.Endpoint, testCtx.Config.Model.Name)
+		if _, err := testEngine.RunReplay(runCtx, testCtx.Trace); err != nil {
+			return fmt.Errorf("replay test failed: %w", err)
+		}
+	} else if isStress && testCtx.Config.Dataset.Type == engine.DatasetSessions {
+		defer qlog.TimeTrackWithDebug(mlog, "RunSessions")()
+		mlog.Debugf("Running session mode with provider: %s [%s], model: [%s]",
+			testCtx.Config.Model.Provider, testCtx.Config.Model.Endpoint, testCtx.Config.Model.Name)
+		if _, err := testEngine.RunSessions(runCtx, testCtx.Dataset); err != nil {
+			return fmt.Errorf("session test failed: %w", err)
+		}
+	} else if isStress && len(testCtx.Config.Test.Stages) > 0 {
+		defer qlog.TimeTrackWithDebug(mlog, "RunStages")()
+		mlog.Debugf("Running staged mode with provider: %s [%s], model: [%s]",
+			testCtx.Config.Model.Provider, testCtx.Config.Model.Endpoint, testCtx.Config.Model.Name)
+		if _, err := testEngine.RunStages(runCtx, testCtx.Dataset); err != nil {
+			return fmt.Errorf("staged test failed: %w", err)
+		}
+	} else if isStress && testCtx.Config.Test.RequestRate > 0 {
+		defer qlog.TimeTrackWithDebug(mlog, "RunRate")()
+		mlog.Debugf("Running open-loop mode with provider: %s [%s], model: [%s]",
+			testCtx.Config.Model.Provider, testCtx.Config.Model.Endpoint, testCtx.Config.Model.Name)
+		if _, err := testEngine.RunRate(runCtx, testCtx.Dataset); err != nil {
+			return fmt.Errorf("open-loop test failed: %w", err)
+		}
+	} else if isStress {
 		defer qlog.TimeTrackWithDebug(mlog, "RunStress")()
 		mlog.Debugf("Running stress mode with provider: %s [%s], model: [%s]",
 			testCtx.Config.Model.Provider, testCtx.Config.Model.Endpoint, testCtx.Config.Model.Name)
-		results, err := testEngine.RunStress(testCtx.Dataset)
-		if err != nil {
-			return nil, fmt.Errorf("stress test failed: %w", err)
+		if _, err := testEngine.RunStress(runCtx, testCtx.Dataset); err != nil {
+			return fmt.Errorf("stress test failed: %w", err)
 		}
-		return collector.NewCollector(results), nil
 	} else {
 		defer qlog.TimeTrackWithDebug(mlog, "RunBatch")()
 		mlog.Debugf("Running batch mode with provider: %s [%s], model: [%s]",
 			testCtx.Config.Model.Provider, testCtx.Config.Model.Endpoint, testCtx.Config.Model.Name)
-		results, err := testEngine.RunBatch(testCtx.Dataset)
+		if _, err := testEngine.RunBatch(runCtx, testCtx.Dataset); err != nil {
+			return fmt.Errorf("batch test failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// ignoreLoadProfiles clears the request rate and the stages, which do not apply to the modes running fixed concurrency levels
+func ignoreLoadProfiles(testCtx *TestContext, mode string) {
+	if testCtx.Config.Test.RequestRate > 0 {
+		mlog.Warnf("%s mode runs fixed concurrency levels, request rate %.2f is ignored", mode, testCtx.Config.Test.RequestRate)
+		testCtx.Config.Test.RequestRate = 0
+	}
+	if len(testCtx.Config.Test.Stages) > 0 {
+		mlog.Warnf("%s mode runs fixed concurrency levels, %d stages are ignored", mode, len(testCtx.Config.Test.Stages))
+		testCtx.Config.Test.Stages = nil
+	}
+}
+
+// runSeek searches the highest concurrency at which the SLOs hold, each probe is a stress test
+// whose metrics and SLO check are added to the report
+func runSeek(runCtx context.Context, testCtx *TestContext, r *reporter.Reporter) {
+	seekCfg := testCtx.Config.Test.Seek
+	if seekCfg.SLO.IsEmpty() {
+		mlog.Errorf("Seek mode needs at least one SLO in test.seek.slo")
+		os.Exit(1)
+	}
+	if runFlags.IsBatch || runFlags.IsPerf {
+		mlog.Errorf("Seek mode can not be combined with batch or perf mode")
+		os.Exit(1)
+	}
+	ignoreLoadProfiles(testCtx, "Seek")
+
+	mlog.Infof("Running seek mode with SLOs: %s", seekCfg.SLO)
+	maxConcurrency, err := engine.SeekConcurrency(seekCfg, func(concurrency int) (bool, error) {
+		testCtx.Config.Test.Concurrency = concurrency
+		col, err := runTest(runCtx, testCtx, true)
 		if err != nil {
-			return nil, fmt.Errorf("batch test failed: %w", err)
+			return false, err
+		}
+		defer col.Close()
+		if runCtx.Err() != nil {
+			// The interrupted probe is incomplete, its SLOs are not checked
+			return false, runCtx.Err()
+		}
+
+		metrics := analyzer.NewAnalyzer(col).Analyze()
+		slo := metrics.CheckSLO(seekCfg.SLO)
+		if slo.Passed {
+			mlog.Infof("Probe at concurrency %d: SLOs hold", concurrency)
+		} else {
+			mlog.Warnf("Probe at concurrency %d: SLOs violated: %s", concurrency, strings.Join(slo.Violations, ", "))
+		}
+		r.AddNewSeekMetrics(concurrency, metrics, slo)
+		return slo.Passed, nil
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+		mlog.Warnf("Seek mode interrupted, reporting the %d completed probes", len(r.GetTestResults()))
+	case err != nil:
+		mlog.Errorf("Failed to run seek mode: %v", err)
+		os.Exit(1)
+	case maxConcurrency == 0:
+		r.SetSeekResult(maxConcurrency)
+		mlog.Warnf("SLOs are violated at every probed concurrency")
+	default:
+		r.SetSeekResult(maxConcurrency)
+		mlog.Infof("Max sustainable concurrency: %d", maxConcurrency)
+	}
+
+	if !runFlags.NoReport {
+		if runFlags.ShowTableOnConsole {
+			r.GenerateConsoleTableReport()
+		} else {
+			r.GenerateConsoleReport()
+		}
+		if err := r.GenerateFileReport(testCtx.Config.Output.Path, testCtx.Config.Output.Format); err != nil {
+			mlog.Errorf("failed to generate file report [%s]: %v", testCtx.Config.Output.Path, err)
 		}
-		return collector.NewCollector(results), nil
 	}
 }
@@ -12,12 +12,15 @@ type RunFlags struct {
 	ConfigPath         string
 	IsBatch            bool
 	IsPerf             bool
+	IsSeek             bool
+	IsReplay           bool
 	NoReport           bool
 	ShowTableOnConsole bool
 	RandomEnable       bool
 	RandomEnableSet    bool // true if RandomEnable was explicitly set via command line
 	RandomInputLen     int
 	RandomOutputLen    int
+	RandomNumPrompts   int
 }
 
 var runFlags = &RunFlags{}
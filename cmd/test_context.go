@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
 	"github.com/FortuneW/gollmperf/internal/provider"
 	"github.com/FortuneW/gollmperf/internal/utils"
 )
@@ -16,6 +17,12 @@ type TestContext struct {
 	Config   *config.Config
 	Provider provider.Provider
 	Dataset  []provider.AnyParams
+	// Trace is the trace replayed by replay mode, in place of the dataset
+	Trace []engine.TraceRequest
+	// Tokenizer is the offline tokenizer, nil if not configured
+	Tokenizer utils.Tokenizer
+	// Renderer renders the request templates, nil if dataset.template is not enabled and the dataset is not a prefix cache one
+	Renderer *utils.TemplateRenderer
 }
 
 // InitializeTest initializes the test environment based on command line flags and config
@@ -56,6 +63,9 @@ func InitializeTest(flags *RunFlags) *TestContext {
 	if flags.RandomOutputLen > 0 {
 		cfg.RandomDatasetVLLM.OutputLength = flags.RandomOutputLen
 	}
+	if flags.RandomNumPrompts > 0 {
+		cfg.RandomDatasetVLLM.NumPrompts = flags.RandomNumPrompts
+	}
 
 	// Validate configuration
 	if cfg.Model.Provider == "" {
@@ -63,20 +73,63 @@ func InitializeTest(flags *RunFlags) *TestContext {
 		os.Exit(1)
 	}
 
+	// Load offline tokenizer
+	var tokenizer utils.Tokenizer
+	if cfg.Model.Tokenizer != "" {
+		tokenizer, err = utils.LoadTokenizer(cfg.Model.Tokenizer)
+		if err != nil {
+			mlog.Errorf("Error loading tokenizer from %s: %v", cfg.Model.Tokenizer, err)
+			os.Exit(1)
+		}
+		mlog.Infof("Loaded tokenizer from %s", cfg.Model.Tokenizer)
+	}
+
 	// Get system prompt
 	systemPrompt := utils.GetSystemPrompt(&cfg.Model.SystemPromptTemplate)
 
 	// Load or generate dataset based on configuration
-	var dataset []provider.AnyParams
-
-	if cfg.RandomDatasetVLLM.Enable {
+	var (
+		dataset []provider.AnyParams
+		trace   []engine.TraceRequest
+	)
+
+	if flags.IsReplay {
+		// Load the trace replayed in place of the dataset
+		trace, err = utils.LoadTrace(&cfg.Test.Replay, tokenizer, cfg.Model.Endpoint, systemPrompt)
+		if err != nil {
+			mlog.Errorf("Error loading trace from %s: %v", cfg.Test.Replay.Path, err)
+			os.Exit(1)
+		}
+		mlog.Infof("Loaded %d requests over %v from trace %s", len(trace), trace[len(trace)-1].Offset, cfg.Test.Replay.Path)
+	} else if cfg.PrefixCacheDataset.Enable {
+		// Generate prefix cache benchmark dataset
+		dataset, err = utils.GeneratePrefixCacheDataset(&cfg.PrefixCacheDataset, tokenizer, cfg.Model.Endpoint, systemPrompt)
+		if err != nil {
+			mlog.Errorf("Error generating prefix cache dataset: %v", err)
+			os.Exit(1)
+		}
+		mlog.Infof("Generated prefix cache dataset of %d requests with %d token prefixes, share ratio %.2f",
+			len(dataset), cfg.PrefixCacheDataset.PrefixLength, cfg.PrefixCacheDataset.ShareRatio)
+	} else if cfg.RandomDatasetVLLM.Enable {
 		// Generate random dataset for vLLM
-		dataset = generateRandomDataset(cfg, systemPrompt)
-		mlog.Infof("Generated random dataset with input length %d tokens and output length %d tokens",
-			cfg.RandomDatasetVLLM.InputLength, cfg.RandomDatasetVLLM.OutputLength)
+		dataset, err = utils.GenerateRandomDataset(&cfg.RandomDatasetVLLM, tokenizer, cfg.Model.Endpoint, systemPrompt)
+		if err != nil {
+			mlog.Errorf("Error generating random dataset: %v", err)
+			os.Exit(1)
+		}
+		mlog.Infof("Generated random dataset of %d prompts with input length %d tokens and output length %d tokens",
+			len(dataset), cfg.RandomDatasetVLLM.InputLength, cfg.RandomDatasetVLLM.OutputLength)
+	} else if len(cfg.Dataset.Sources) > 0 {
+		// Mix the datasets of a mixed workload
+		dataset, err = utils.LoadDataset(&cfg.Dataset, tokenizer, systemPrompt)
+		if err != nil {
+			mlog.Errorf("Error loading mixed workload: %v", err)
+			os.Exit(1)
+		}
+		mlog.Infof("Mixed %d test cases from %d dataset sources", len(dataset), len(cfg.Dataset.Sources))
 	} else {
 		// Load dataset from file
-		dataset, err := utils.LoadDataset(cfg.Dataset.Path, cfg.Dataset.Type, systemPrompt)
+		dataset, err = utils.LoadDataset(&cfg.Dataset, tokenizer, systemPrompt)
 		if err != nil {
 			mlog.Errorf("Error loading dataset from %s: %v", cfg.Dataset.Path, err)
 			os.Exit(1)
@@ -84,60 +137,44 @@ func InitializeTest(flags *RunFlags) *TestContext {
 		mlog.Infof("Loaded %d test cases from dataset %s", len(dataset), cfg.Dataset.Path)
 	}
 
-	// Create provider
-	var prov provider.Provider
-	switch cfg.Model.Provider {
-	case "openai":
-		prov = provider.NewOpenAIProvider(cfg.Model.ApiKey, cfg.Model.Endpoint, cfg.Model.Name, cfg.Test.Timeout)
-	case "qwen":
-		prov = provider.NewQwenProvider(cfg.Model.ApiKey, cfg.Model.Endpoint, cfg.Model.Name, cfg.Test.Timeout)
-	default:
-		mlog.Errorf("Unsupported provider: %s. Supported providers: openai, qwen", cfg.Model.Provider)
-		os.Exit(1)
+	// Set up request templating
+	var renderer *utils.TemplateRenderer
+	if cfg.Dataset.Template {
+		var rows []map[string]any
+		if cfg.Dataset.VarsPath != "" {
+			rows, err = utils.LoadTemplateVars(cfg.Dataset.VarsPath)
+			if err != nil {
+				mlog.Errorf("Error loading template variables from %s: %v", cfg.Dataset.VarsPath, err)
+				os.Exit(1)
+			}
+			mlog.Infof("Loaded %d rows of template variables from %s", len(rows), cfg.Dataset.VarsPath)
+		}
+		if cfg.Dataset.VarsPerRow {
+			utils.AssignTemplateVars(dataset, rows)
+			rows = nil
+		}
+		renderer = utils.NewTemplateRenderer(rows)
+	} else if cfg.Dataset.VarsPath != "" {
+		mlog.Warnf("dataset.vars_path is ignored as dataset.template is not enabled")
 	}
-
-	return &TestContext{
-		Config:   cfg,
-		Provider: prov,
-		Dataset:  dataset,
+	if renderer == nil && cfg.PrefixCacheDataset.Enable && !flags.IsReplay {
+		// The prefixes of the prefix cache dataset are rendered for each request
+		renderer = utils.NewTemplateRenderer(nil)
 	}
-}
 
-// generateRandomDataset generates a random dataset for vLLM testing
-func generateRandomDataset(cfg *config.Config, systemPrompt string) []provider.AnyParams {
-	// Generate a single test case with random prompt
-	prompt, err := utils.GetRandomPromptByTokenCount(cfg.Model.Endpoint, cfg.RandomDatasetVLLM.InputLength)
+	// Create provider
+	prov, err := provider.New(&cfg.Model, cfg.Test.Timeout)
 	if err != nil {
-		mlog.Warnf("Failed to generate exact token count: %v, using best effort", err)
-	}
-
-	messages := []interface{}{
-		map[string]interface{}{
-			"role":    "user",
-			"content": prompt,
-		},
-	}
-
-	// Add system prompt if provided
-	if systemPrompt != "" {
-		messages = append([]interface{}{
-			map[string]interface{}{
-				"role":    "system",
-				"content": systemPrompt,
-			},
-		}, messages...)
+		mlog.Errorf("Error creating provider: %v", err)
+		os.Exit(1)
 	}
 
-	return []provider.AnyParams{
-		{
-			"messages":               messages,
-			"max_tokens":             cfg.RandomDatasetVLLM.OutputLength,
-			"ignore_eos":             true,
-			"truncate_prompt_tokens": cfg.RandomDatasetVLLM.InputLength,
-			"stream":                 true,
-			"stream_options": map[string]interface{}{
-				"include_usage": true,
-			},
-		},
+	return &TestContext{
+		Config:    cfg,
+		Provider:  prov,
+		Dataset:   dataset,
+		Trace:     trace,
+		Tokenizer: tokenizer,
+		Renderer:  renderer,
 	}
 }
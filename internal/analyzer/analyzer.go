@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"sort"
 	"time"
 
 	"github.com/FortuneW/gollmperf/internal/collector"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/qlog"
 )
 
+var mlog = qlog.GetRLog("analyzer")
+
 // Duration is a wrapper around time.Duration that marshals to milliseconds in JSON
 type Duration time.Duration
 
@@ -28,6 +31,12 @@ func (d Duration) Milliseconds() int64 {
 	return time.Duration(d).Milliseconds()
 }
 
+// FloatMilliseconds returns the duration as a floating point number of milliseconds,
+// for sub-millisecond precision of the per-token metrics.
+func (d Duration) FloatMilliseconds() float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func (d Duration) String() string {
 	return fmt.Sprintf("%v", time.Duration(d))
 }
@@ -46,6 +55,7 @@ type Metrics struct {
 	TotalRequests      int     `json:"total_requests"`
 	SuccessfulRequests int     `json:"successful_requests"`
 	FailedRequests     int     `json:"failed_requests"`
+	CancelledRequests  int     `json:"cancelled_requests,omitempty"` // interrupted requests, not counted in the other request metrics
 	SuccessRate        Float64 `json:"success_rate"`
 	ErrorRate          Float64 `json:"error_rate"`
 
@@ -63,6 +73,11 @@ type Metrics struct {
 	// Token metrics
 	AverageRequestTokens  Float64 `json:"average_request_tokens"`
 	AverageResponseTokens Float64 `json:"average_response_tokens"`
+	// Reasoning tokens are part of the response tokens, if reported by the provider
+	AverageReasoningTokens Float64 `json:"average_reasoning_tokens,omitempty"`
+	// Cached tokens are the prompt tokens served from the prefix cache, if reported by the provider
+	AverageCachedTokens Float64 `json:"average_cached_tokens,omitempty"`
+	CacheHitRate        Float64 `json:"cache_hit_rate,omitempty"` // percentage of the prompt tokens which were cached
 
 	// Streaming metrics (if applicable)
 	AverageFirstTokenLatency Duration `json:"average_first_token_latency,omitempty"`
@@ -70,6 +85,34 @@ type Metrics struct {
 	FirstTokenLatencyP90     Duration `json:"first_token_latency_p90,omitempty"`
 	FirstTokenLatencyP99     Duration `json:"first_token_latency_p99,omitempty"`
 
+	// Decode metrics (streaming only)
+	AverageInterTokenLatency  Duration `json:"average_inter_token_latency,omitempty"`
+	InterTokenLatencyP50      Duration `json:"inter_token_latency_p50,omitempty"`
+	InterTokenLatencyP90      Duration `json:"inter_token_latency_p90,omitempty"`
+	InterTokenLatencyP99      Duration `json:"inter_token_latency_p99,omitempty"`
+	AverageTimePerOutputToken Duration `json:"average_time_per_output_token,omitempty"`
+	TimePerOutputTokenP50     Duration `json:"time_per_output_token_p50,omitempty"`
+	TimePerOutputTokenP90     Duration `json:"time_per_output_token_p90,omitempty"`
+	TimePerOutputTokenP99     Duration `json:"time_per_output_token_p99,omitempty"`
+	DecodeTokensPerSecond     Float64  `json:"decode_tokens_per_second,omitempty"` // average of the per-request decode speed
+
+	// Server-side timing metrics (if reported by the provider, e.g. ollama)
+	AverageServerLoadTime        Duration `json:"average_server_load_time,omitempty"`
+	AverageServerPrefillTime     Duration `json:"average_server_prefill_time,omitempty"`
+	AverageServerDecodeTime      Duration `json:"average_server_decode_time,omitempty"`
+	ServerPrefillTokensPerSecond Float64  `json:"server_prefill_tokens_per_second,omitempty"`
+	ServerDecodeTokensPerSecond  Float64  `json:"server_decode_tokens_per_second,omitempty"`
+
+	// Embeddings metrics (if applicable), each request is a batch of inputs
+	EmbeddingsPerSecond  Float64 `json:"embeddings_per_second,omitempty"`
+	InputTokensPerSecond Float64 `json:"input_tokens_per_second,omitempty"`
+	AverageBatchSize     Float64 `json:"average_batch_size,omitempty"`
+
+	// Token sources, the number of successful results per source of their token counts (see engine.TokenSource*)
+	TokenSources map[string]int `json:"token_sources,omitempty"`
+	// Usage validation, if the usage reported by the server could be compared with client-side estimates
+	UsageValidation *UsageValidation `json:"usage_validation,omitempty"`
+
 	// Error analysis
 	ErrorTypeCounts map[string]int `json:"error_type_counts,omitempty"`
 }
@@ -86,19 +129,18 @@ func NewAnalyzer(col *collector.Collector) *Analyzer {
 	}
 }
 
-// Analyze performs analysis on the collected results
+// Analyze performs analysis on the collected results. The results are aggregated in one pass with a bounded
+// memory, so that those of a result log are streamed from disk rather than loaded.
 func (a *Analyzer) Analyze() *Metrics {
-	results := a.collector.GetAllResults()
-	successfulResults := a.collector.GetSuccessfulResults()
-
 	metrics := &Metrics{
 		ErrorTypeCounts: make(map[string]int),
 	}
 
-	// Basic metrics
-	metrics.TotalRequests = len(results)
-	metrics.SuccessfulRequests = len(successfulResults)
-	metrics.FailedRequests = a.collector.GetFailureCount()
+	// Basic metrics, the requests cancelled by an interruption are neither successes nor failures
+	metrics.CancelledRequests = a.collector.GetCancelledCount()
+	metrics.TotalRequests = a.collector.GetTotalCount() - metrics.CancelledRequests
+	metrics.SuccessfulRequests = a.collector.GetSuccessCount()
+	metrics.FailedRequests = a.collector.GetFailureCount() - metrics.CancelledRequests
 
 	if metrics.TotalRequests > 0 {
 		metrics.SuccessRate = Float64(metrics.SuccessfulRequests) / Float64(metrics.TotalRequests) * 100
@@ -118,43 +160,72 @@ func (a *Analyzer) Analyze() *Metrics {
 		metrics.QPS = Float64(metrics.SuccessfulRequests) / Float64(metrics.TotalDuration.Seconds())
 	}
 
-	// Only calculate detailed metrics if we have successful results
-	if len(successfulResults) > 0 {
-		// Latency calculations
-		latencies := make([]time.Duration, len(successfulResults))
-		firstTokenLatencies := make([]time.Duration, 0)
-		totalLatency := time.Duration(0)
-		totalRequestTokens := 0
-		totalResponseTokens := 0
-
-		for i, result := range successfulResults {
-			latencies[i] = result.Latency
-			totalLatency += result.Latency
-			totalRequestTokens += result.RequestTokens
-			totalResponseTokens += result.ResponseTokens
-
-			// Collect first token latencies if available
-			if result.FirstTokenLatency > 0 {
-				firstTokenLatencies = append(firstTokenLatencies, result.FirstTokenLatency)
+	var (
+		successful           int
+		latencies            durationDigest
+		firstTokenLatencies  durationDigest
+		totalRequestTokens   int
+		totalResponseTokens  int
+		totalReasoningTokens int
+		totalCachedTokens    int
+		decode               decodeStats
+		serverTiming         serverTimingStats
+		embeddings           embeddingStats
+		usage                usageStats
+	)
+	err := a.collector.Each(func(result *engine.Result) error {
+		if !result.Success {
+			// Error type analysis
+			if result.Cancelled {
+				return nil
 			}
+			if result.Error != nil && result.Error.Type != "" {
+				metrics.ErrorTypeCounts[fmt.Sprintf("%d:%s", result.Error.Code, result.Error.Type)]++
+			} else {
+				// Default to "unknown" for results without error type
+				metrics.ErrorTypeCounts["unknown"]++
+			}
+			return nil
 		}
 
-		// Average latency
-		metrics.AverageLatency = Duration(totalLatency / time.Duration(len(successfulResults)))
+		successful++
+		latencies.add(result.Latency)
+		totalRequestTokens += result.RequestTokens
+		totalResponseTokens += result.ResponseTokens
+		totalReasoningTokens += result.ReasoningTokens
+		totalCachedTokens += result.CachedTokens
+
+		// Collect first token latencies if available
+		if result.FirstTokenLatency > 0 {
+			firstTokenLatencies.add(result.FirstTokenLatency)
+		}
 
-		// Sort latencies for percentile calculations
-		sort.Slice(latencies, func(i, j int) bool {
-			return latencies[i] < latencies[j]
-		})
+		decode.add(result)
+		serverTiming.add(result)
+		embeddings.add(result)
+		usage.add(result, metrics)
+		return nil
+	})
+	if err != nil {
+		mlog.Errorf("Failed to read the results, the metrics miss some of them: %v", err)
+	}
 
-		// Latency percentiles
-		metrics.LatencyP50 = Duration(latencies[int(float64(len(latencies))*0.5)])
-		metrics.LatencyP90 = Duration(latencies[int(float64(len(latencies))*0.9)])
-		metrics.LatencyP99 = Duration(latencies[int(float64(len(latencies))*0.99)])
+	// Only calculate detailed metrics if we have successful results
+	if successful > 0 {
+		// Latency metrics
+		metrics.AverageLatency = Duration(latencies.mean())
+		metrics.LatencyP50 = Duration(latencies.percentile(0.5))
+		metrics.LatencyP90 = Duration(latencies.percentile(0.9))
+		metrics.LatencyP99 = Duration(latencies.percentile(0.99))
 
 		// Token metrics
-		metrics.AverageRequestTokens = Float64(totalRequestTokens) / Float64(len(successfulResults))
-		metrics.AverageResponseTokens = Float64(totalResponseTokens) / Float64(len(successfulResults))
+		metrics.AverageRequestTokens = Float64(totalRequestTokens) / Float64(successful)
+		metrics.AverageResponseTokens = Float64(totalResponseTokens) / Float64(successful)
+		metrics.AverageReasoningTokens = Float64(totalReasoningTokens) / Float64(successful)
+		metrics.AverageCachedTokens = Float64(totalCachedTokens) / Float64(successful)
+		if totalRequestTokens > 0 {
+			metrics.CacheHitRate = Float64(totalCachedTokens) / Float64(totalRequestTokens) * 100
+		}
 
 		// Tokens per second
 		if metrics.TotalDuration > 0 {
@@ -162,36 +233,116 @@ func (a *Analyzer) Analyze() *Metrics {
 		}
 
 		// First token latency metrics (if available)
-		if len(firstTokenLatencies) > 0 {
-			totalFirstTokenLatency := time.Duration(0)
-			for _, lat := range firstTokenLatencies {
-				totalFirstTokenLatency += lat
-			}
-			metrics.AverageFirstTokenLatency = Duration(totalFirstTokenLatency / time.Duration(len(firstTokenLatencies)))
+		if firstTokenLatencies.count > 0 {
+			metrics.AverageFirstTokenLatency = Duration(firstTokenLatencies.mean())
+			metrics.FirstTokenLatencyP50 = Duration(firstTokenLatencies.percentile(0.5))
+			metrics.FirstTokenLatencyP90 = Duration(firstTokenLatencies.percentile(0.9))
+			metrics.FirstTokenLatencyP99 = Duration(firstTokenLatencies.percentile(0.99))
+		}
 
-			// Sort first token latencies for percentile calculations
-			sort.Slice(firstTokenLatencies, func(i, j int) bool {
-				return firstTokenLatencies[i] < firstTokenLatencies[j]
-			})
+		decode.apply(metrics)
+		serverTiming.apply(metrics)
+		embeddings.apply(metrics)
+		usage.apply(metrics)
+	}
 
-			// First token latency percentiles
-			metrics.FirstTokenLatencyP50 = Duration(firstTokenLatencies[int(float64(len(firstTokenLatencies))*0.5)])
-			metrics.FirstTokenLatencyP90 = Duration(firstTokenLatencies[int(float64(len(firstTokenLatencies))*0.9)])
-			metrics.FirstTokenLatencyP99 = Duration(firstTokenLatencies[int(float64(len(firstTokenLatencies))*0.99)])
-		}
+	return metrics
+}
+
+// decodeStats aggregates the inter-token latency and time per output token metrics,
+// only streaming results are taken into account
+type decodeStats struct {
+	interTokenLatencies durationDigest
+	timePerOutputTokens durationDigest
+	decodeSpeedSum      float64
+}
+
+func (s *decodeStats) add(result *engine.Result) {
+	for _, latency := range result.InterTokenLatencies {
+		s.interTokenLatencies.add(latency)
 	}
+	if result.TimePerOutputToken > 0 {
+		s.timePerOutputTokens.add(result.TimePerOutputToken)
+		s.decodeSpeedSum += 1 / result.TimePerOutputToken.Seconds()
+	}
+}
 
-	// Error analysis
-	failedResults := a.collector.GetFailedResults()
-	// Error type analysis
-	for _, result := range failedResults {
-		if result.Error.Type != "" {
-			metrics.ErrorTypeCounts[fmt.Sprintf("%d:%s", result.Error.Code, result.Error.Type)]++
-		} else {
-			// Default to "unknown" for results without error type
-			metrics.ErrorTypeCounts["unknown"]++
-		}
+func (s *decodeStats) apply(metrics *Metrics) {
+	if itl := &s.interTokenLatencies; itl.count > 0 {
+		metrics.AverageInterTokenLatency = Duration(itl.mean())
+		metrics.InterTokenLatencyP50 = Duration(itl.percentile(0.5))
+		metrics.InterTokenLatencyP90 = Duration(itl.percentile(0.9))
+		metrics.InterTokenLatencyP99 = Duration(itl.percentile(0.99))
 	}
 
-	return metrics
+	if tpot := &s.timePerOutputTokens; tpot.count > 0 {
+		metrics.AverageTimePerOutputToken = Duration(tpot.mean())
+		metrics.TimePerOutputTokenP50 = Duration(tpot.percentile(0.5))
+		metrics.TimePerOutputTokenP90 = Duration(tpot.percentile(0.9))
+		metrics.TimePerOutputTokenP99 = Duration(tpot.percentile(0.99))
+		metrics.DecodeTokensPerSecond = Float64(s.decodeSpeedSum / float64(tpot.count))
+	}
+}
+
+// serverTimingStats aggregates the server-side prefill and decode metrics,
+// only results which carry server timing are taken into account
+type serverTimingStats struct {
+	count                                int
+	totalLoad, totalPrefill, totalDecode time.Duration
+	prefillTokens, decodeTokens          int
+}
+
+func (s *serverTimingStats) add(result *engine.Result) {
+	if result.ServerPrefillTime == 0 && result.ServerDecodeTime == 0 {
+		return
+	}
+	s.count++
+	s.totalLoad += result.ServerLoadTime
+	s.totalPrefill += result.ServerPrefillTime
+	s.totalDecode += result.ServerDecodeTime
+	s.prefillTokens += result.RequestTokens
+	s.decodeTokens += result.ResponseTokens
+}
+
+func (s *serverTimingStats) apply(metrics *Metrics) {
+	if s.count == 0 {
+		return
+	}
+
+	metrics.AverageServerLoadTime = Duration(s.totalLoad / time.Duration(s.count))
+	metrics.AverageServerPrefillTime = Duration(s.totalPrefill / time.Duration(s.count))
+	metrics.AverageServerDecodeTime = Duration(s.totalDecode / time.Duration(s.count))
+	if s.totalPrefill > 0 {
+		metrics.ServerPrefillTokensPerSecond = Float64(float64(s.prefillTokens) / s.totalPrefill.Seconds())
+	}
+	if s.totalDecode > 0 {
+		metrics.ServerDecodeTokensPerSecond = Float64(float64(s.decodeTokens) / s.totalDecode.Seconds())
+	}
+}
+
+// embeddingStats aggregates the embeddings throughput metrics,
+// only results of embeddings requests are taken into account
+type embeddingStats struct {
+	count, embeddings, inputTokens int
+}
+
+func (s *embeddingStats) add(result *engine.Result) {
+	if result.Embeddings == 0 {
+		return
+	}
+	s.count++
+	s.embeddings += result.Embeddings
+	s.inputTokens += result.RequestTokens
+}
+
+func (s *embeddingStats) apply(metrics *Metrics) {
+	if s.count == 0 {
+		return
+	}
+
+	metrics.AverageBatchSize = Float64(s.embeddings) / Float64(s.count)
+	if metrics.TotalDuration > 0 {
+		metrics.EmbeddingsPerSecond = Float64(s.embeddings) / Float64(metrics.TotalDuration.Seconds())
+		metrics.InputTokensPerSecond = Float64(s.inputTokens) / Float64(metrics.TotalDuration.Seconds())
+	}
 }
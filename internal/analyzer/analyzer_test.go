@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/collector"
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzer_DecodeMetrics(t *testing.T) {
+	start := time.Now()
+	results := []*engine.Result{
+		{
+			Success:             true,
+			ResponseTokens:      11,
+			Latency:             300 * time.Millisecond,
+			FirstTokenLatency:   100 * time.Millisecond,
+			TimePerOutputToken:  20 * time.Millisecond,
+			InterTokenLatencies: []time.Duration{10 * time.Millisecond, 30 * time.Millisecond},
+			StartTime:           start,
+			EndTime:             start.Add(300 * time.Millisecond),
+		},
+		{
+			Success:             true,
+			ResponseTokens:      11,
+			Latency:             200 * time.Millisecond,
+			FirstTokenLatency:   100 * time.Millisecond,
+			TimePerOutputToken:  10 * time.Millisecond,
+			InterTokenLatencies: []time.Duration{20 * time.Millisecond},
+			StartTime:           start,
+			EndTime:             start.Add(200 * time.Millisecond),
+		},
+		{
+			// Non-streaming results carry no decode timing
+			Success:        true,
+			ResponseTokens: 11,
+			Latency:        time.Second,
+			StartTime:      start,
+			EndTime:        start.Add(time.Second),
+		},
+	}
+
+	metrics := NewAnalyzer(collector.NewCollector(results)).Analyze()
+
+	assert.Equal(t, Duration(20*time.Millisecond), metrics.AverageInterTokenLatency)
+	assert.Equal(t, Duration(20*time.Millisecond), metrics.InterTokenLatencyP50)
+	assert.Equal(t, Duration(30*time.Millisecond), metrics.InterTokenLatencyP99)
+	assert.Equal(t, Duration(15*time.Millisecond), metrics.AverageTimePerOutputToken)
+	assert.Equal(t, Duration(20*time.Millisecond), metrics.TimePerOutputTokenP99)
+	assert.InDelta(t, 75.0, float64(metrics.DecodeTokensPerSecond), 0.001)
+}
+
+func TestMetrics_CheckSLO(t *testing.T) {
+	maxErrorRate := 1.0
+	slo := config.SLOConfig{
+		TTFTP90:   500 * time.Millisecond,
+		E2EP99:    10 * time.Second,
+		TPOTP99:   50 * time.Millisecond,
+		ErrorRate: &maxErrorRate,
+	}
+
+	metrics := &Metrics{
+		TotalRequests:         100,
+		SuccessfulRequests:    100,
+		FirstTokenLatencyP90:  Duration(400 * time.Millisecond),
+		LatencyP99:            Duration(8 * time.Second),
+		TimePerOutputTokenP99: Duration(30 * time.Millisecond),
+	}
+	assert.Equal(t, &SLOResult{Passed: true}, metrics.CheckSLO(slo))
+
+	metrics.FirstTokenLatencyP90 = Duration(600 * time.Millisecond)
+	metrics.TimePerOutputTokenP99 = 0
+	metrics.SuccessfulRequests = 97
+	metrics.ErrorRate = 3
+	result := metrics.CheckSLO(slo)
+	assert.False(t, result.Passed)
+	assert.Equal(t, []string{"TTFT P90 600ms > 500ms", "TPOT P99 not reported", "error rate 3.00% > 1.00%"}, result.Violations)
+
+	assert.Equal(t, []string{"no successful requests"}, (&Metrics{}).CheckSLO(config.SLOConfig{E2EP99: time.Second}).Violations)
+}
+
+func TestAnalyzer_CancelledRequests(t *testing.T) {
+	start := time.Now()
+	results := []*engine.Result{
+		{Success: true, Latency: time.Second, StartTime: start, EndTime: start.Add(time.Second)},
+		{Error: provider.NewError(500, errors.New("internal error")), StartTime: start},
+		{Cancelled: true, Error: provider.NewError(0, context.Canceled), StartTime: start},
+	}
+
+	metrics := NewAnalyzer(collector.NewCollector(results)).Analyze()
+
+	assert.Equal(t, 2, metrics.TotalRequests)
+	assert.Equal(t, 1, metrics.FailedRequests)
+	assert.Equal(t, 1, metrics.CancelledRequests)
+	assert.InDelta(t, 50, float64(metrics.ErrorRate), 0.001)
+	assert.Len(t, metrics.ErrorTypeCounts, 1)
+}
+
+func TestAnalyzer_CachedTokens(t *testing.T) {
+	start := time.Now()
+	results := []*engine.Result{
+		{Success: true, RequestTokens: 1000, CachedTokens: 900, StartTime: start, EndTime: start.Add(time.Second)},
+		{Success: true, RequestTokens: 1000, StartTime: start, EndTime: start.Add(time.Second)},
+	}
+
+	metrics := NewAnalyzer(collector.NewCollector(results)).Analyze()
+
+	assert.InDelta(t, 450, float64(metrics.AverageCachedTokens), 0.001)
+	assert.InDelta(t, 45, float64(metrics.CacheHitRate), 0.001)
+}
+
+func TestAnalyzer_UsageValidation(t *testing.T) {
+	start := time.Now()
+	result := func(source string, request, response, estimatedRequest, estimatedResponse int) *engine.Result {
+		return &engine.Result{
+			Success: true, TokenSource: source,
+			RequestTokens: request, ResponseTokens: response,
+			EstimatedRequestTokens: estimatedRequest, EstimatedResponseTokens: estimatedResponse,
+			StartTime: start, EndTime: start.Add(time.Second),
+		}
+	}
+	results := []*engine.Result{
+		result(engine.TokenSourceUsage, 110, 100, 100, 98),  // within the slack
+		result(engine.TokenSourceUsage, 100, 400, 100, 200), // response tokens doubled
+		result(engine.TokenSourceUsage, 100, 100, 0, 0),     // nothing to compare
+		result(engine.TokenSourceChunks, 0, 50, 0, 50),
+	}
+
+	metrics := NewAnalyzer(collector.NewCollector(results)).Analyze()
+
+	assert.Equal(t, map[string]int{engine.TokenSourceUsage: 3, engine.TokenSourceChunks: 1}, metrics.TokenSources)
+	if assert.NotNil(t, metrics.UsageValidation) {
+		assert.Equal(t, 2, metrics.UsageValidation.Compared)
+		assert.Equal(t, 1, metrics.UsageValidation.Mismatched)
+		assert.InDelta(t, 50, float64(metrics.UsageValidation.MismatchRate), 0.001)
+		assert.InDelta(t, 1.05, float64(metrics.UsageValidation.RequestTokensRatio), 0.001)
+		assert.InDelta(t, 500.0/298, float64(metrics.UsageValidation.ResponseTokensRatio), 0.001)
+	}
+}
+
+func TestDurationDigest(t *testing.T) {
+	// The percentiles are exact up to digestExactLimit samples
+	var d durationDigest
+	for _, v := range []time.Duration{30, 10, 20} {
+		d.add(v * time.Millisecond)
+	}
+	assert.Equal(t, 20*time.Millisecond, d.mean())
+	assert.Equal(t, 20*time.Millisecond, d.percentile(0.5))
+	assert.Equal(t, 30*time.Millisecond, d.percentile(0.99))
+
+	// Beyond, the memory is bounded and the percentiles are within 1%
+	d = durationDigest{}
+	n := 4 * digestExactLimit
+	for i := n; i > 0; i-- {
+		d.add(time.Duration(i) * time.Microsecond)
+	}
+	assert.Nil(t, d.samples)
+	assert.Less(t, len(d.buckets), 2048)
+	assert.Equal(t, time.Duration(n+1)*time.Microsecond/2, d.mean())
+	for _, p := range []float64{0, 0.5, 0.9, 0.99} {
+		want := float64(int(float64(n)*p)+1) * float64(time.Microsecond)
+		assert.InEpsilon(t, want, float64(d.percentile(p)), 0.01, p)
+	}
+}
@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"math/bits"
+	"slices"
+	"time"
+)
+
+const (
+	// digestExactLimit is the number of samples up to which a digest keeps them, for exact percentiles
+	digestExactLimit = 1 << 16
+	// digestSubBits is the log2 of the number of buckets per power of two of a digest histogram,
+	// which bounds the relative error of its percentiles by 2^-digestSubBits (under 1%)
+	digestSubBits = 7
+)
+
+// durationDigest aggregates durations with a bounded memory: it keeps their count and sum, and the samples
+// for exact percentiles until digestExactLimit, then counts them in the buckets of a log-linear histogram
+type durationDigest struct {
+	count   int
+	sum     time.Duration
+	samples []time.Duration
+	buckets map[int]int // sample count per bucket, once the samples overflow
+}
+
+// add adds a sample
+func (d *durationDigest) add(v time.Duration) {
+	d.count++
+	d.sum += v
+	if d.buckets == nil && len(d.samples) < digestExactLimit {
+		d.samples = append(d.samples, v)
+		return
+	}
+	if d.buckets == nil {
+		d.buckets = make(map[int]int)
+		for _, s := range d.samples {
+			d.buckets[digestBucket(s)]++
+		}
+		d.samples = nil
+	}
+	d.buckets[digestBucket(v)]++
+}
+
+// mean returns the mean of the samples, which must not be empty
+func (d *durationDigest) mean() time.Duration {
+	return d.sum / time.Duration(d.count)
+}
+
+// percentile returns the p-th percentile (0 <= p < 1) of the samples, which must not be empty
+func (d *durationDigest) percentile(p float64) time.Duration {
+	rank := int(float64(d.count) * p)
+	if d.buckets == nil {
+		slices.Sort(d.samples)
+		return d.samples[rank]
+	}
+
+	keys := make([]int, 0, len(d.buckets))
+	for b := range d.buckets {
+		keys = append(keys, b)
+	}
+	slices.Sort(keys)
+	seen := 0
+	for _, b := range keys {
+		seen += d.buckets[b]
+		if seen > rank {
+			return digestValue(b)
+		}
+	}
+	return digestValue(keys[len(keys)-1])
+}
+
+// digestBucket returns the histogram bucket of a duration: durations under 2^(digestSubBits+1)ns have
+// a bucket each, the larger ones are bucketed by their digestSubBits+1 most significant bits
+func digestBucket(v time.Duration) int {
+	if v <= 0 {
+		return 0
+	}
+	shift := max(bits.Len64(uint64(v))-digestSubBits-1, 0)
+	return shift<<digestSubBits + int(v>>shift)
+}
+
+// digestValue returns the middle of the range of durations of a histogram bucket
+func digestValue(b int) time.Duration {
+	shift := max(b>>digestSubBits-1, 0)
+	low := time.Duration(b-shift<<digestSubBits) << shift
+	return low + time.Duration(1)<<shift/2
+}
@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+// SLOResult represents the outcome of checking the SLOs against the metrics of a test
+type SLOResult struct {
+	Passed     bool     `json:"passed"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// CheckSLO checks the metrics against the SLOs. A test without successful requests violates every SLO,
+// as does a latency which the test does not report (e.g. TPOT without streaming).
+func (m *Metrics) CheckSLO(slo config.SLOConfig) *SLOResult {
+	result := &SLOResult{}
+
+	checkLatency := func(name string, value Duration, limit time.Duration) {
+		if limit <= 0 {
+			return
+		}
+		if value <= 0 {
+			result.Violations = append(result.Violations, fmt.Sprintf("%s not reported", name))
+		} else if time.Duration(value) > limit {
+			result.Violations = append(result.Violations, fmt.Sprintf("%s %v > %v", name, value, limit))
+		}
+	}
+
+	if m.SuccessfulRequests == 0 {
+		result.Violations = append(result.Violations, "no successful requests")
+	} else {
+		checkLatency("TTFT P50", m.FirstTokenLatencyP50, slo.TTFTP50)
+		checkLatency("TTFT P90", m.FirstTokenLatencyP90, slo.TTFTP90)
+		checkLatency("TTFT P99", m.FirstTokenLatencyP99, slo.TTFTP99)
+		checkLatency("E2E P50", m.LatencyP50, slo.E2EP50)
+		checkLatency("E2E P90", m.LatencyP90, slo.E2EP90)
+		checkLatency("E2E P99", m.LatencyP99, slo.E2EP99)
+		checkLatency("TPOT P90", m.TimePerOutputTokenP90, slo.TPOTP90)
+		checkLatency("TPOT P99", m.TimePerOutputTokenP99, slo.TPOTP99)
+	}
+	if slo.ErrorRate != nil && float64(m.ErrorRate) > *slo.ErrorRate {
+		result.Violations = append(result.Violations, fmt.Sprintf("error rate %.2f%% > %.2f%%", float64(m.ErrorRate), *slo.ErrorRate))
+	}
+
+	result.Passed = len(result.Violations) == 0
+	return result
+}
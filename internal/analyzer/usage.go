@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"github.com/FortuneW/gollmperf/internal/engine"
+)
+
+// A reported token count disagrees with its client-side estimate when they differ by more than
+// UsageMismatchRatio of the estimate and more than UsageMismatchSlack tokens. The slack covers the
+// chat template and special tokens which the client does not count.
+const (
+	UsageMismatchRatio = 0.2
+	UsageMismatchSlack = 16
+)
+
+// UsageValidation compares the token usage reported by the server with the client-side estimates,
+// to catch a server or gateway misreporting the usage
+type UsageValidation struct {
+	Compared     int     `json:"compared"`      // results with both a reported usage and an estimate
+	Mismatched   int     `json:"mismatched"`    // results whose usage disagrees with the estimate
+	MismatchRate Float64 `json:"mismatch_rate"` // percentage of the compared results which mismatched
+	// Ratios of the total reported tokens to the total estimated tokens
+	RequestTokensRatio  Float64 `json:"request_tokens_ratio,omitempty"`
+	ResponseTokensRatio Float64 `json:"response_tokens_ratio,omitempty"`
+}
+
+// usageStats counts the results per source of their token counts, and validates the usage reported
+// by the server against the client-side estimates
+type usageStats struct {
+	validation                          UsageValidation
+	reportedRequest, estimatedRequest   int
+	reportedResponse, estimatedResponse int
+}
+
+func (s *usageStats) add(result *engine.Result, metrics *Metrics) {
+	if result.TokenSource != "" {
+		if metrics.TokenSources == nil {
+			metrics.TokenSources = make(map[string]int)
+		}
+		metrics.TokenSources[result.TokenSource]++
+	}
+	if result.TokenSource != engine.TokenSourceUsage ||
+		(result.EstimatedRequestTokens == 0 && result.EstimatedResponseTokens == 0) {
+		return
+	}
+
+	s.validation.Compared++
+	mismatched := false
+	if result.EstimatedRequestTokens > 0 {
+		s.reportedRequest += result.RequestTokens
+		s.estimatedRequest += result.EstimatedRequestTokens
+		mismatched = usageMismatch(result.RequestTokens, result.EstimatedRequestTokens)
+	}
+	if result.EstimatedResponseTokens > 0 {
+		s.reportedResponse += result.ResponseTokens
+		s.estimatedResponse += result.EstimatedResponseTokens
+		mismatched = mismatched || usageMismatch(result.ResponseTokens, result.EstimatedResponseTokens)
+	}
+	if mismatched {
+		s.validation.Mismatched++
+	}
+}
+
+func (s *usageStats) apply(metrics *Metrics) {
+	validation := s.validation
+	if validation.Compared == 0 {
+		return
+	}
+	validation.MismatchRate = Float64(validation.Mismatched) / Float64(validation.Compared) * 100
+	if s.estimatedRequest > 0 {
+		validation.RequestTokensRatio = Float64(s.reportedRequest) / Float64(s.estimatedRequest)
+	}
+	if s.estimatedResponse > 0 {
+		validation.ResponseTokensRatio = Float64(s.reportedResponse) / Float64(s.estimatedResponse)
+	}
+	metrics.UsageValidation = &validation
+}
+
+// usageMismatch reports whether a reported token count disagrees with its estimate
+func usageMismatch(reported, estimated int) bool {
+	diff := reported - estimated
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > UsageMismatchSlack && float64(diff) > UsageMismatchRatio*float64(estimated)
+}
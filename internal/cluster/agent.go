@@ -0,0 +1,188 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/engine"
+)
+
+// Runner runs the plan of an agent streaming its results to sink, the run stops early once ctx is done
+type Runner func(ctx context.Context, plan *Plan, sink engine.ResultSink) error
+
+// sinkFunc adapts a function to engine.ResultSink
+type sinkFunc func(result *engine.Result)
+
+func (f sinkFunc) AddResult(result *engine.Result) {
+	f(result)
+}
+
+// Agent runs the plans of a coordinator over HTTP, one at a time. Every request must carry the shared token
+// of the agent as "Authorization: Bearer <token>":
+//
+//	GET  /v1/clock  the time of the agent, to measure its clock offset
+//	POST /v1/run    runs the plan of the body, the response streams the messages of the run as JSON lines
+//	POST /v1/start  starts the plan at the start_at of the body, in the clock of the agent
+//	POST /v1/stop   stops the run, the results of the requests in flight are still streamed
+type Agent struct {
+	run   Runner
+	token string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // cancels the current run, nil when idle
+	start  chan time.Time     // start time of the current run
+}
+
+// NewAgent creates an agent running the plans with run, for the coordinators holding token
+func NewAgent(run Runner, token string) *Agent {
+	return &Agent{run: run, token: token}
+}
+
+// Handler returns the HTTP handler of the agent
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/clock", a.handleClock)
+	mux.HandleFunc("POST /v1/run", a.handleRun)
+	mux.HandleFunc("POST /v1/start", a.handleStart)
+	mux.HandleFunc("POST /v1/stop", a.handleStop)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := []byte(r.Header.Get("Authorization"))
+		if a.token == "" || subtle.ConstantTimeCompare(auth, []byte("Bearer "+a.token)) != 1 {
+			http.Error(w, "invalid agent token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (a *Agent) handleClock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clockMessage{Time: time.Now()})
+}
+
+func (a *Agent) handleRun(w http.ResponseWriter, r *http.Request) {
+	var plan Plan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, fmt.Sprintf("invalid plan: %v", err), http.StatusBadRequest)
+		return
+	}
+	if plan.Config == nil {
+		http.Error(w, "invalid plan: no config", http.StatusBadRequest)
+		return
+	}
+	if err := checkLocalOptions(&plan.Config.Model); err != nil {
+		http.Error(w, fmt.Sprintf("invalid plan: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// The run stops if the coordinator goes away
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	start := make(chan time.Time, 1)
+	a.mu.Lock()
+	if a.cancel != nil {
+		a.mu.Unlock()
+		http.Error(w, "agent is busy with another run", http.StatusConflict)
+		return
+	}
+	a.cancel, a.start = cancel, start
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.cancel, a.start = nil, nil
+		a.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	send := func(msg message) error {
+		if err := encoder.Encode(msg); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if err := send(message{Ready: true}); err != nil {
+		mlog.Errorf("Failed to send to the coordinator: %v", err)
+		return
+	}
+
+	var startAt time.Time
+	select {
+	case startAt = <-start:
+	case <-ctx.Done():
+		_ = send(message{Done: true, Error: "stopped before the start"})
+		return
+	}
+	if wait := time.Until(startAt); wait > 0 {
+		mlog.Infof("Starting the plan in %v", wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	} else {
+		mlog.Warnf("Starting the plan %v late", -wait.Round(time.Millisecond))
+	}
+
+	// The results are sent as they complete, the run stops if they can not be sent
+	var (
+		sent    int
+		sendErr error
+	)
+	err := a.run(ctx, &plan, sinkFunc(func(result *engine.Result) {
+		if sendErr != nil {
+			return
+		}
+		if sendErr = send(message{Result: newWireResult(result, plan.KeepResponses)}); sendErr != nil {
+			mlog.Errorf("Failed to send the results to the coordinator: %v", sendErr)
+			cancel()
+			return
+		}
+		sent++
+	}))
+	if sendErr != nil {
+		return
+	}
+	done := message{Done: true}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	_ = send(done)
+	mlog.Infof("Sent %d results to the coordinator", sent)
+}
+
+func (a *Agent) handleStart(w http.ResponseWriter, r *http.Request) {
+	var msg startMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, fmt.Sprintf("invalid start: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.start == nil {
+		http.Error(w, "no plan to start", http.StatusConflict)
+		return
+	}
+	select {
+	case a.start <- msg.StartAt:
+	default:
+		http.Error(w, "plan already started", http.StatusConflict)
+	}
+}
+
+func (a *Agent) handleStop(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		mlog.Warnf("Stopping the run on request of the coordinator")
+		a.cancel()
+	}
+}
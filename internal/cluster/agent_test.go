@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/collector"
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "secret"
+
+// testAgent serves an agent whose runner answers each case of its plan, and records the start times
+type testAgent struct {
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (a *testAgent) run(ctx context.Context, plan *Plan, sink engine.ResultSink) error {
+	start := time.Now()
+	a.mu.Lock()
+	a.starts = append(a.starts, start)
+	a.mu.Unlock()
+
+	if plan.Config.Test.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency")
+	}
+	for _, reqCase := range plan.Dataset {
+		if plan.Stress {
+			<-ctx.Done() // runs until stopped
+		}
+		sink.AddResult(&engine.Result{
+			Success:             true,
+			Cancelled:           ctx.Err() != nil,
+			Tags:                map[string]string{"case": fmt.Sprint(reqCase["i"])},
+			InterTokenLatencies: []time.Duration{time.Millisecond},
+			RefResponse:         &provider.Response{JsonData: fmt.Sprintf(`{"id":"%v"}`, reqCase["i"])},
+			StartTime:           start,
+			EndTime:             start.Add(time.Second),
+		})
+	}
+	return nil
+}
+
+func startTestAgents(t *testing.T, n int) ([]*testAgent, []string) {
+	agents := make([]*testAgent, n)
+	addrs := make([]string, n)
+	for i := range agents {
+		agents[i] = &testAgent{}
+		server := httptest.NewServer(NewAgent(agents[i].run, testToken).Handler())
+		t.Cleanup(server.Close)
+		addrs[i] = server.URL
+	}
+	return agents, addrs
+}
+
+func TestCoordinator_Batch(t *testing.T) {
+	agents, addrs := startTestAgents(t, 2)
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 2, Agents: addrs}}
+	dataset := []provider.AnyParams{{"i": 0}, {"i": 1}, {"i": 2}}
+
+	plans := Split(&Plan{Config: cfg, Dataset: dataset, KeepResponses: true}, len(addrs))
+	col := collector.NewCollector(nil)
+	err := NewCoordinator(addrs, testToken).Run(context.Background(), plans, col)
+	assert.NoError(t, err)
+	results := col.GetAllResults()
+
+	// The results come back in the order of the cases, with their fields left out of the JSON of a result
+	assert.Len(t, results, 3)
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprint(i), result.Tags["case"])
+		assert.Equal(t, []time.Duration{time.Millisecond}, result.InterTokenLatencies)
+		assert.Equal(t, fmt.Sprintf(`{"id":"%d"}`, i), result.RefResponse.String())
+		assert.Equal(t, time.Second, result.EndTime.Sub(result.StartTime))
+	}
+
+	// The agents start together
+	diff := agents[0].starts[0].Sub(agents[1].starts[0]).Abs()
+	assert.Less(t, diff, 50*time.Millisecond)
+}
+
+func TestCoordinator_Stop(t *testing.T) {
+	_, addrs := startTestAgents(t, 2)
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 2, Agents: addrs}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	plans := Split(&Plan{Config: cfg, Stress: true, Dataset: []provider.AnyParams{{"i": 0}}}, len(addrs))
+	col := collector.NewCollector(nil)
+	err := NewCoordinator(addrs, testToken).Run(ctx, plans, col)
+
+	// The stopped agents still send their results
+	assert.NoError(t, err)
+	results := col.GetAllResults()
+	assert.Len(t, results, 2)
+	for _, result := range results {
+		assert.True(t, result.Cancelled)
+	}
+}
+
+func TestCoordinator_Errors(t *testing.T) {
+	_, addrs := startTestAgents(t, 1)
+
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: -1}}
+	col := collector.NewCollector(nil)
+	err := NewCoordinator(addrs, testToken).Run(context.Background(), []*Plan{{Config: cfg, Dataset: []provider.AnyParams{{}}}}, col)
+	assert.ErrorContains(t, err, "invalid concurrency")
+
+	err = NewCoordinator([]string{"127.0.0.1:1"}, testToken).Run(context.Background(), []*Plan{{Config: cfg}}, col)
+	assert.Error(t, err)
+}
+
+func TestAgent_Auth(t *testing.T) {
+	_, addrs := startTestAgents(t, 1)
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 1}}
+	plans := []*Plan{{Config: cfg, Dataset: []provider.AnyParams{{}}}}
+
+	// Every endpoint needs the token
+	err := NewCoordinator(addrs, "wrong").Run(context.Background(), plans, collector.NewCollector(nil))
+	assert.ErrorContains(t, err, "401")
+
+	// The options naming local files or commands are refused from a plan
+	cfg.Model.Sections = map[string]any{"azure": map[string]any{"AD_Token_Command": "id"}}
+	err = NewCoordinator(addrs, testToken).Run(context.Background(), plans, collector.NewCollector(nil))
+	assert.ErrorContains(t, err, "model.azure.ad_token_command is set by the agent")
+
+	cfg.Model.Sections, cfg.Model.Tokenizer = nil, "/etc/passwd"
+	err = NewCoordinator(addrs, testToken).Run(context.Background(), plans, collector.NewCollector(nil))
+	assert.ErrorContains(t, err, "model.tokenizer is set by the agent")
+}
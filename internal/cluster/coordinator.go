@@ -0,0 +1,320 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/engine"
+)
+
+const (
+	// clockSamples is the number of clock readings of an agent, the one of the shortest round trip is kept
+	clockSamples = 5
+	// startLead is the delay from the start message to the start of the agents, so that all get it in time
+	startLead = 500 * time.Millisecond
+)
+
+// Coordinator runs the plans of a test on agents and merges their results
+type Coordinator struct {
+	agents []string // base URLs of the agents
+	token  string   // shared token of the agents
+	client *http.Client
+}
+
+// NewCoordinator creates a coordinator of the agents, given by host:port or URL, holding their shared token
+func NewCoordinator(agents []string, token string) *Coordinator {
+	urls := make([]string, len(agents))
+	for i, agent := range agents {
+		if !strings.Contains(agent, "://") {
+			agent = "http://" + agent
+		}
+		urls[i] = strings.TrimSuffix(agent, "/")
+	}
+	return &Coordinator{agents: urls, token: token, client: &http.Client{}}
+}
+
+// newRequest returns a request to an agent, authenticated with the token
+func (c *Coordinator) newRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// agentRun is the run of a plan on an agent
+type agentRun struct {
+	agent   string
+	plan    *Plan
+	offset  time.Duration // clock of the agent minus the clock of the coordinator
+	body    io.ReadCloser
+	decoder *json.Decoder
+	count   int              // results received
+	held    []*engine.Result // results of a batch test, held back to be merged in the order of the agents
+	err     error
+}
+
+// Run runs plan i on agent i, nil plans are skipped. The plans are sent to the agents first, then the agents
+// are started together at a time set in the clock of each agent, whose offset is measured beforehand.
+// Once ctx is done the agents are stopped, the results of their requests in flight still come back.
+// The results are streamed to sink as they come back, one at a time, their times converted to the clock of
+// the coordinator. The results of a batch test are merged in the order of the agents once all are done.
+func (c *Coordinator) Run(ctx context.Context, plans []*Plan, sink engine.ResultSink) error {
+	if len(plans) != len(c.agents) {
+		return fmt.Errorf("%d plans for %d agents", len(plans), len(c.agents))
+	}
+
+	// The runs go on once ctx is done, the agents are stopped instead so that their results still come back
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	var runs []*agentRun
+	for i, plan := range plans {
+		if plan == nil {
+			continue
+		}
+		run := &agentRun{agent: c.agents[i], plan: plan}
+		offset, err := c.clockOffset(reqCtx, run.agent)
+		if err != nil {
+			return fmt.Errorf("agent %s: %w", run.agent, err)
+		}
+		run.offset = offset
+		mlog.Infof("Agent %s: clock offset %v, %s", run.agent, offset, run.share())
+		runs = append(runs, run)
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("no agent has a share of the test")
+	}
+
+	// Send the plans and wait until every agent is ready
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *agentRun) {
+			defer wg.Done()
+			run.err = c.send(reqCtx, run)
+		}(run)
+	}
+	wg.Wait()
+	defer func() {
+		for _, run := range runs {
+			if run.body != nil {
+				run.body.Close()
+			}
+		}
+	}()
+	for _, run := range runs {
+		if run.err != nil {
+			c.stop(runs)
+			return fmt.Errorf("agent %s: %w", run.agent, run.err)
+		}
+	}
+
+	// Start the agents together
+	startAt := time.Now().Add(startLead)
+	for _, run := range runs {
+		if err := c.post(reqCtx, run.agent+"/v1/start", startMessage{StartAt: startAt.Add(run.offset)}); err != nil {
+			c.stop(runs)
+			return fmt.Errorf("agent %s: failed to start: %w", run.agent, err)
+		}
+	}
+	mlog.Infof("Started %d agents at %s", len(runs), startAt.Format(time.RFC3339Nano))
+
+	// Stop the agents once ctx is done
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.stop(runs)
+		case <-stopped:
+		}
+	}()
+
+	// Collect the results
+	var sinkMutex sync.Mutex
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *agentRun) {
+			defer wg.Done()
+			run.err = run.collect(func(result *engine.Result) {
+				if !run.plan.Stress {
+					run.held = append(run.held, result)
+					return
+				}
+				sinkMutex.Lock()
+				defer sinkMutex.Unlock()
+				sink.AddResult(result)
+			})
+			if run.err != nil {
+				c.stop(runs)
+			}
+		}(run)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, run := range runs {
+		if run.err != nil {
+			errs = append(errs, fmt.Errorf("agent %s: %w", run.agent, run.err))
+		}
+		mlog.Infof("Agent %s: %d results", run.agent, run.count)
+		for _, result := range run.held {
+			sink.AddResult(result)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// share describes the share of the test of the run
+func (r *agentRun) share() string {
+	test := r.plan.Config.Test
+	switch {
+	case len(r.plan.Trace) > 0:
+		return fmt.Sprintf("%d requests of the trace", len(r.plan.Trace))
+	case !r.plan.Stress:
+		return fmt.Sprintf("%d cases at concurrency %d", len(r.plan.Dataset), test.Concurrency)
+	case len(test.Stages) > 0:
+		return fmt.Sprintf("%d stages", len(test.Stages))
+	case test.RequestRate > 0:
+		return fmt.Sprintf("%.2f requests/s", test.RequestRate)
+	default:
+		return fmt.Sprintf("concurrency %d", test.Concurrency)
+	}
+}
+
+// clockOffset measures the offset of the clock of an agent from the clock of the coordinator,
+// assuming that the agent reads its clock halfway through the round trip
+func (c *Coordinator) clockOffset(ctx context.Context, agent string) (time.Duration, error) {
+	var (
+		offset  time.Duration
+		bestRTT time.Duration = -1
+	)
+	for i := 0; i < clockSamples; i++ {
+		req, err := c.newRequest(ctx, http.MethodGet, agent+"/v1/clock", nil)
+		if err != nil {
+			return 0, err
+		}
+		sent := time.Now()
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the clock: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			return 0, fmt.Errorf("failed to read the clock: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		var clock clockMessage
+		err = json.NewDecoder(resp.Body).Decode(&clock)
+		resp.Body.Close()
+		received := time.Now()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the clock: %w", err)
+		}
+
+		if rtt := received.Sub(sent); bestRTT < 0 || rtt < bestRTT {
+			bestRTT = rtt
+			offset = clock.Time.Sub(sent.Add(rtt / 2))
+		}
+	}
+	return offset, nil
+}
+
+// send sends the plan of a run and waits until the agent is ready to start it
+func (c *Coordinator) send(ctx context.Context, run *agentRun) error {
+	body, err := json.Marshal(run.plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode the plan: %w", err)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, run.agent+"/v1/run", body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send the plan: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to send the plan: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	run.body = resp.Body
+	run.decoder = json.NewDecoder(bufio.NewReader(resp.Body))
+
+	var msg message
+	if err := run.decoder.Decode(&msg); err != nil {
+		return fmt.Errorf("failed to read the stream: %w", err)
+	}
+	if !msg.Ready {
+		return fmt.Errorf("agent is not ready: %s", msg.Error)
+	}
+	return nil
+}
+
+// collect reads the results of a run until its end, passing them on to add
+func (r *agentRun) collect(add func(result *engine.Result)) error {
+	for {
+		var msg message
+		if err := r.decoder.Decode(&msg); err != nil {
+			return fmt.Errorf("stream ended before the end of the run: %w", err)
+		}
+		if msg.Done {
+			if msg.Error != "" {
+				return errors.New(msg.Error)
+			}
+			return nil
+		}
+		if msg.Result != nil {
+			r.count++
+			add(msg.Result.result(r.offset))
+		}
+	}
+}
+
+// stop stops the runs on the agents, with a context of its own as the one of the test may be done
+func (c *Coordinator) stop(runs []*agentRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, run := range runs {
+		if err := c.post(ctx, run.agent+"/v1/stop", struct{}{}); err != nil {
+			mlog.Warnf("Agent %s: failed to stop: %v", run.agent, err)
+		}
+	}
+}
+
+// post posts a JSON message to an agent
+func (c *Coordinator) post(ctx context.Context, url string, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package cluster
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/qlog"
+)
+
+var mlog = qlog.GetRLog("cluster")
+
+// Plan is the share of a test run by an agent
+type Plan struct {
+	Config        *config.Config        `json:"config"`
+	Stress        bool                  `json:"stress"` // stress mode, batch mode otherwise
+	Dataset       []provider.AnyParams  `json:"dataset,omitempty"`
+	Trace         []engine.TraceRequest `json:"trace,omitempty"`          // replay mode, in place of the dataset
+	TemplateVars  []map[string]any      `json:"template_vars,omitempty"`  // rows of variables of the request templates
+	KeepResponses bool                  `json:"keep_responses,omitempty"` // send back the responses, for the batch results
+}
+
+// Split splits a test into the plans of n agents. The concurrency, request rate, cap on requests in flight and
+// request count are shared out, as are the targets of the stages, the cases of a batch test (in contiguous
+// chunks, so that the merged results keep their order) and the requests of a trace. A nil plan has no share
+// of the test, e.g. with fewer workers than agents.
+func Split(plan *Plan, n int) []*Plan {
+	total := plan.Config.Test
+	if plan.Stress && len(plan.Trace) == 0 && len(total.Stages) == 0 && total.RequestRate > 0 &&
+		total.MaxRequests <= 0 && total.Duration <= 0 {
+		// An open-loop test sends one pass over the dataset by default, which is shared out as its request count
+		total.MaxRequests = len(plan.Dataset)
+	}
+
+	plans := make([]*Plan, n)
+	for i := range plans {
+		cfg := *plan.Config
+		cfg.Test = splitTest(total, i, n)
+		cfg.Test.Agents, cfg.Test.AgentToken = nil, ""
+		stripLocalOptions(&cfg.Model)
+
+		p := *plan
+		p.Config = &cfg
+		switch test := cfg.Test; {
+		case len(plan.Trace) > 0:
+			p.Trace = nil
+			for j := i; j < len(plan.Trace); j += n {
+				p.Trace = append(p.Trace, plan.Trace[j])
+			}
+			if len(p.Trace) == 0 {
+				continue
+			}
+		case !plan.Stress:
+			p.Dataset = plan.Dataset[i*len(plan.Dataset)/n : (i+1)*len(plan.Dataset)/n]
+			p.Config.Test.Concurrency = max(test.Concurrency, 1)
+			if len(p.Dataset) == 0 {
+				continue
+			}
+		case len(test.Stages) > 0:
+		case test.RequestRate > 0:
+			if total.MaxRequests > 0 && test.MaxRequests == 0 {
+				continue
+			}
+		case test.Concurrency == 0:
+			continue
+		}
+		plans[i] = &p
+	}
+	return plans
+}
+
+// splitTest returns the share of agent i of n of a test
+func splitTest(test config.TestConfig, i, n int) config.TestConfig {
+	test.Concurrency = share(test.Concurrency, i, n)
+	test.RequestRate /= float64(n)
+	if test.MaxInflight > 0 {
+		test.MaxInflight = max(share(test.MaxInflight, i, n), 1)
+	}
+	test.MaxRequests = share(test.MaxRequests, i, n)
+
+	stages := make([]config.StageConfig, len(test.Stages))
+	for j, stage := range test.Stages {
+		stage.Concurrency = share(stage.Concurrency, i, n)
+		stage.Rate /= float64(n)
+		stages[j] = stage
+	}
+	if len(stages) > 0 {
+		test.Stages = stages
+	}
+	return test
+}
+
+// localOptions are the options of the model sections which name a local file or command. An agent does not
+// take them from a plan, which would let anyone reaching it run commands or read files, it sets them itself.
+var localOptions = map[string][]string{
+	"azure":   {"ad_token_file", "ad_token_command"},
+	"generic": {"body_template_file"},
+}
+
+// stripLocalOptions removes the local options and the tokenizer file from a copy of a model config,
+// its sections are cloned first
+func stripLocalOptions(model *config.ModelConfig) {
+	model.Tokenizer = ""
+	model.Sections = maps.Clone(model.Sections)
+	for name, keys := range localOptions {
+		section, ok := model.Sections[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		section = maps.Clone(section)
+		for _, key := range keys {
+			delete(section, key)
+		}
+		model.Sections[name] = section
+	}
+}
+
+// checkLocalOptions returns an error if a model config of a plan sets a local option or the tokenizer file
+func checkLocalOptions(model *config.ModelConfig) error {
+	if model.Tokenizer != "" {
+		return fmt.Errorf("model.tokenizer is set by the agent, not by the plan")
+	}
+	for name, keys := range localOptions {
+		section, _ := model.Sections[name].(map[string]any)
+		// The sections are decoded as JSON, whose keys match the fields regardless of case
+		for key := range section {
+			for _, local := range keys {
+				if strings.EqualFold(key, local) {
+					return fmt.Errorf("model.%s.%s is set by the agent, not by the plan", name, local)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// share returns the share of agent i of n of a total, the remainder going to the first agents
+func share(total, i, n int) int {
+	s := total / n
+	if i < total%n {
+		s++
+	}
+	return s
+}
+
+// startMessage starts a plan at a time in the clock of the agent
+type startMessage struct {
+	StartAt time.Time `json:"start_at"`
+}
+
+// clockMessage is the time of an agent
+type clockMessage struct {
+	Time time.Time `json:"time"`
+}
+
+// message is a line of the stream of a run on an agent: the plan is ready to start, a result,
+// or the end of the run with its error if any
+type message struct {
+	Ready  bool        `json:"ready,omitempty"`
+	Result *wireResult `json:"result,omitempty"`
+	Done   bool        `json:"done,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// wireResult is a result sent by an agent, with the fields which the JSON of engine.Result leaves out
+type wireResult struct {
+	*engine.Result
+	InterTokenLatencies []time.Duration `json:"inter_token_latencies,omitempty"`
+	Response            string          `json:"response,omitempty"` // JSON of the response, if the plan keeps them
+}
+
+// newWireResult returns the wire form of a result
+func newWireResult(result *engine.Result, keepResponse bool) *wireResult {
+	w := &wireResult{Result: result, InterTokenLatencies: result.InterTokenLatencies}
+	if keepResponse && result.RefResponse != nil {
+		w.Response = result.RefResponse.String()
+	}
+	return w
+}
+
+// result returns the result of its wire form, with its times moved by the clock offset of the agent
+func (w *wireResult) result(offset time.Duration) *engine.Result {
+	result := w.Result
+	if result == nil {
+		result = &engine.Result{}
+	}
+	result.InterTokenLatencies = w.InterTokenLatencies
+	if w.Response != "" {
+		result.RefResponse = &provider.Response{JsonData: w.Response}
+	}
+	result.StartTime = result.StartTime.Add(-offset)
+	result.EndTime = result.EndTime.Add(-offset)
+	return result
+}
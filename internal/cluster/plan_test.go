@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit_Stress(t *testing.T) {
+	cfg := &config.Config{Test: config.TestConfig{
+		Concurrency: 5,
+		RequestRate: 30,
+		MaxInflight: 3,
+		MaxRequests: 100,
+		Stages:      []config.StageConfig{{Duration: time.Minute, Concurrency: 7}},
+		Agents:      []string{"a:7070", "b:7070", "c:7070"},
+	}}
+	plans := Split(&Plan{Config: cfg, Stress: true, Dataset: []provider.AnyParams{{}}}, 3)
+
+	assert.Len(t, plans, 3)
+	for i, want := range []config.TestConfig{
+		{Concurrency: 2, RequestRate: 10, MaxInflight: 1, MaxRequests: 34, Stages: []config.StageConfig{{Duration: time.Minute, Concurrency: 3}}},
+		{Concurrency: 2, RequestRate: 10, MaxInflight: 1, MaxRequests: 33, Stages: []config.StageConfig{{Duration: time.Minute, Concurrency: 2}}},
+		{Concurrency: 1, RequestRate: 10, MaxInflight: 1, MaxRequests: 33, Stages: []config.StageConfig{{Duration: time.Minute, Concurrency: 2}}},
+	} {
+		assert.Equal(t, want, plans[i].Config.Test, i)
+		assert.Len(t, plans[i].Dataset, 1)
+	}
+	assert.Equal(t, 5, cfg.Test.Concurrency) // the test is left untouched
+	assert.Equal(t, 7, cfg.Test.Stages[0].Concurrency)
+
+	// An open-loop test without request count nor duration sends one pass over the dataset, which is shared out
+	cfg.Test.MaxRequests, cfg.Test.Stages = 0, nil
+	dataset := []provider.AnyParams{{"i": 0}, {"i": 1}, {"i": 2}, {"i": 3}, {"i": 4}}
+	plans = Split(&Plan{Config: cfg, Stress: true, Dataset: dataset}, 3)
+	requests := 0
+	for _, plan := range plans {
+		requests += plan.Config.Test.MaxRequests
+	}
+	assert.Equal(t, len(dataset), requests)
+	assert.Equal(t, 2, plans[0].Config.Test.MaxRequests)
+	assert.Equal(t, 1, plans[2].Config.Test.MaxRequests)
+	assert.Zero(t, cfg.Test.MaxRequests)
+
+	// An agent without worker has no share
+	cfg.Test.RequestRate, cfg.Test.Stages = 0, nil
+	cfg.Test.Concurrency = 2
+	plans = Split(&Plan{Config: cfg, Stress: true}, 3)
+	assert.NotNil(t, plans[1])
+	assert.Nil(t, plans[2])
+}
+
+func TestSplit_BatchAndTrace(t *testing.T) {
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 1}}
+	dataset := []provider.AnyParams{{"i": 0}, {"i": 1}, {"i": 2}, {"i": 3}, {"i": 4}}
+
+	// The cases are split in contiguous chunks
+	plans := Split(&Plan{Config: cfg, Dataset: dataset}, 2)
+	assert.Equal(t, dataset[:2], plans[0].Dataset)
+	assert.Equal(t, dataset[2:], plans[1].Dataset)
+	assert.Equal(t, 1, plans[1].Config.Test.Concurrency)
+
+	// The requests of a trace are dealt out in turn
+	trace := []engine.TraceRequest{{Offset: 0}, {Offset: time.Second}, {Offset: 2 * time.Second}}
+	plans = Split(&Plan{Config: cfg, Stress: true, Trace: trace}, 2)
+	assert.Equal(t, []engine.TraceRequest{trace[0], trace[2]}, plans[0].Trace)
+	assert.Equal(t, []engine.TraceRequest{trace[1]}, plans[1].Trace)
+
+	plans = Split(&Plan{Config: cfg, Stress: true, Trace: trace[:1]}, 2)
+	assert.Nil(t, plans[1])
+}
+
+func TestSplit_LocalOptions(t *testing.T) {
+	cfg := &config.Config{
+		Model: config.ModelConfig{
+			Tokenizer: "./tokenizer.json",
+			Sections: map[string]any{
+				"azure": map[string]any{"deployment": "gpt", "ad_token_command": "az account get-access-token"},
+			},
+		},
+		Test: config.TestConfig{Concurrency: 1, Agents: []string{"a:7070"}, AgentToken: "secret"},
+	}
+	plans := Split(&Plan{Config: cfg, Dataset: []provider.AnyParams{{}}}, 1)
+
+	// The local options and the token of the agents are not sent
+	model := plans[0].Config.Model
+	assert.Empty(t, model.Tokenizer)
+	assert.Equal(t, map[string]any{"deployment": "gpt"}, model.Sections["azure"])
+	assert.NoError(t, checkLocalOptions(&model))
+	assert.Empty(t, plans[0].Config.Test.AgentToken)
+
+	// The test is left untouched
+	assert.Equal(t, "az account get-access-token", cfg.Model.Sections["azure"].(map[string]any)["ad_token_command"])
+	assert.Error(t, checkLocalOptions(&cfg.Model))
+}
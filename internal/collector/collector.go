@@ -4,69 +4,141 @@ import (
 	"time"
 
 	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/qlog"
 )
 
-// Collector collects and stores test results
+var mlog = qlog.GetRLog("collector")
+
+// Collector collects and stores test results. The results are kept in memory, or streamed to an append-only
+// log on disk by NewLogCollector, so that the memory of a long test stays bounded: only the counts of the
+// results are kept, the results are read back from the log when iterated.
 type Collector struct {
-	results []*engine.Result
+	store  store
+	filter func(result *engine.Result) bool // results of the store which belong to a view, nil for all
+	counts counts
+	err    error // first error of the store
+}
+
+// counts are the counts of the results of a collector, kept up to date as the results are added
+type counts struct {
+	total      int
+	successful int
+	cancelled  int
+	first      time.Time // earliest start
+	last       time.Time // latest end
 }
 
-// NewCollector creates a new collector
+func (c *counts) add(result *engine.Result) {
+	if c.total == 0 || result.StartTime.Before(c.first) {
+		c.first = result.StartTime
+	}
+	if c.total == 0 || result.EndTime.After(c.last) {
+		c.last = result.EndTime
+	}
+	c.total++
+	if result.Success {
+		c.successful++
+	}
+	if result.Cancelled {
+		c.cancelled++
+	}
+}
+
+// NewCollector creates a new collector keeping the results in memory
 func NewCollector(results []*engine.Result) *Collector {
 	if results == nil {
 		results = make([]*engine.Result, 0)
 	}
-	return &Collector{
-		results: results,
+	c := &Collector{store: &memoryStore{results: results}}
+	for _, result := range results {
+		c.counts.add(result)
 	}
+	return c
 }
 
-// AddResult adds a result to the collector
+// NewLogCollector creates a new collector streaming the results to the result log at path, appending to it,
+// or to a temporary log removed on close if path is empty. The responses are dropped from the log,
+// unless keepResponses is set, e.g. for the batch results.
+func NewLogCollector(path string, keepResponses bool) (*Collector, error) {
+	log, err := openLog(path, keepResponses)
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{store: log}, nil
+}
+
+// AddResult adds a result to the collector, it implements engine.ResultSink
 func (c *Collector) AddResult(result *engine.Result) {
-	c.results = append(c.results, result)
+	c.counts.add(result)
+	if err := c.store.add(result); err != nil && c.err == nil {
+		mlog.Errorf("Failed to store result: %v", err)
+		c.err = err
+	}
+}
+
+// Err returns the first error of storing the results, the collector then misses results
+func (c *Collector) Err() error {
+	return c.err
+}
+
+// Close closes the collector, a temporary result log is removed. The views of the collector share its store,
+// they are not used once it is closed. Closing a view does nothing.
+func (c *Collector) Close() error {
+	if c.filter != nil {
+		return nil
+	}
+	return c.store.close()
+}
+
+// Each calls fn for each result in the order they were added, reading them back from the result log
+// one at a time. It stops at the first error of fn, which it returns.
+func (c *Collector) Each(fn func(result *engine.Result) error) error {
+	return c.store.each(func(result *engine.Result) error {
+		if c.filter != nil && !c.filter(result) {
+			return nil
+		}
+		return fn(result)
+	})
+}
+
+// results returns the results for which keep returns true, they are all loaded in memory
+func (c *Collector) results(keep func(result *engine.Result) bool) []*engine.Result {
+	results := make([]*engine.Result, 0)
+	err := c.Each(func(result *engine.Result) error {
+		if keep(result) {
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		mlog.Errorf("Failed to read results: %v", err)
+	}
+	return results
 }
 
 // GetAllResults returns all collected results
 func (c *Collector) GetAllResults() []*engine.Result {
-	return c.results
+	return c.results(func(*engine.Result) bool { return true })
 }
 
 // GetSuccessfulResults returns only successful results
 func (c *Collector) GetSuccessfulResults() []*engine.Result {
-	successful := make([]*engine.Result, 0)
-	for _, result := range c.results {
-		if result.Success {
-			successful = append(successful, result)
-		}
-	}
-	return successful
+	return c.results(func(result *engine.Result) bool { return result.Success })
 }
 
 // GetFailedResults returns only failed results
 func (c *Collector) GetFailedResults() []*engine.Result {
-	failed := make([]*engine.Result, 0)
-	for _, result := range c.results {
-		if !result.Success {
-			failed = append(failed, result)
-		}
-	}
-	return failed
+	return c.results(func(result *engine.Result) bool { return !result.Success })
 }
 
 // GetTotalCount returns the total number of results
 func (c *Collector) GetTotalCount() int {
-	return len(c.results)
+	return c.counts.total
 }
 
 // GetSuccessCount returns the number of successful results
 func (c *Collector) GetSuccessCount() int {
-	count := 0
-	for _, result := range c.results {
-		if result.Success {
-			count++
-		}
-	}
-	return count
+	return c.counts.successful
 }
 
 // GetFailureCount returns the number of failed results
@@ -74,23 +146,49 @@ func (c *Collector) GetFailureCount() int {
 	return c.GetTotalCount() - c.GetSuccessCount()
 }
 
+// GetCancelledCount returns the number of results cancelled by the interruption of the test
+func (c *Collector) GetCancelledCount() int {
+	return c.counts.cancelled
+}
+
 // GetTestDuration returns the duration from first to last result
 func (c *Collector) GetTestDuration() time.Duration {
-	if len(c.results) == 0 {
+	if c.counts.total == 0 {
 		return 0
 	}
+	return c.counts.last.Sub(c.counts.first)
+}
 
-	first := c.results[0].StartTime
-	last := c.results[0].EndTime
-
-	for _, result := range c.results {
-		if result.StartTime.Before(first) {
-			first = result.StartTime
-		}
-		if result.EndTime.After(last) {
-			last = result.EndTime
+// view returns a read-only collector of the results for which keep returns true, sharing the store of c
+func (c *Collector) view(keep func(result *engine.Result) bool) *Collector {
+	v := &Collector{store: c.store, filter: keep}
+	if c.filter != nil {
+		v.filter = func(result *engine.Result) bool {
+			return c.filter(result) && keep(result)
 		}
 	}
+	err := v.Each(func(result *engine.Result) error {
+		v.counts.add(result)
+		return nil
+	})
+	if err != nil {
+		mlog.Errorf("Failed to read results: %v", err)
+		v.err = err
+	}
+	return v
+}
+
+// GetStageCollector returns a collector of the results sent in a stage
+func (c *Collector) GetStageCollector(stage string) *Collector {
+	return c.view(func(result *engine.Result) bool { return result.Stage == stage })
+}
+
+// GetTurnCollector returns a collector of the results of a turn of the sessions
+func (c *Collector) GetTurnCollector(turn int) *Collector {
+	return c.view(func(result *engine.Result) bool { return result.Turn == turn })
+}
 
-	return last.Sub(first)
+// GetTagCollector returns a collector of the results whose dataset entry has the tag key set to value
+func (c *Collector) GetTagCollector(key, value string) *Collector {
+	return c.view(func(result *engine.Result) bool { return result.Tags[key] == value })
 }
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogCollector(t *testing.T) {
+	start := time.Now()
+	results := []*engine.Result{
+		{
+			Success:             true,
+			Stage:               "stage-1",
+			Tags:                map[string]string{"source": "chat"},
+			InterTokenLatencies: []time.Duration{time.Millisecond, 2 * time.Millisecond},
+			RefResponse:         &provider.Response{JsonData: `{"id":"a"}`},
+			StartTime:           start,
+			EndTime:             start.Add(time.Second),
+		},
+		{Success: true, Stage: "stage-2", StartTime: start.Add(time.Second), EndTime: start.Add(3 * time.Second)},
+		{Cancelled: true, Stage: "stage-2", Error: provider.NewError(0, os.ErrDeadlineExceeded), StartTime: start},
+	}
+
+	col, err := NewLogCollector("", false)
+	assert.NoError(t, err)
+	for _, result := range results {
+		col.AddResult(result)
+	}
+	assert.NoError(t, col.Err())
+
+	// The counts are kept in memory, the results are read back from the log
+	assert.Equal(t, 3, col.GetTotalCount())
+	assert.Equal(t, 2, col.GetSuccessCount())
+	assert.Equal(t, 1, col.GetCancelledCount())
+	assert.Equal(t, 3*time.Second, col.GetTestDuration())
+	all := col.GetAllResults()
+	if assert.Len(t, all, 3) {
+		assert.Equal(t, results[0].InterTokenLatencies, all[0].InterTokenLatencies)
+		assert.Equal(t, "chat", all[0].Tags["source"])
+		assert.Nil(t, all[0].RefResponse) // the responses are dropped
+		assert.True(t, all[0].StartTime.Equal(start))
+	}
+	assert.Len(t, col.GetFailedResults(), 1)
+
+	// The views filter the log
+	stage := col.GetStageCollector("stage-2")
+	assert.Equal(t, 2, stage.GetTotalCount())
+	assert.Equal(t, 1, stage.GetSuccessCount())
+	assert.Equal(t, 1, stage.GetTagCollector("source", "").GetSuccessCount())
+	assert.Zero(t, col.GetTagCollector("source", "chat").GetStageCollector("stage-2").GetTotalCount())
+
+	// A temporary log is removed on close
+	path := col.store.(*logStore).file.Name()
+	assert.NoError(t, col.Close())
+	assert.NoFileExists(t, path)
+}
+
+func TestLogCollector_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results", "log.jsonl")
+	for i, id := range []string{"a", "b"} {
+		col, err := NewLogCollector(path, true)
+		assert.NoError(t, err)
+		col.AddResult(&engine.Result{Success: true, RefResponse: &provider.Response{JsonData: id}})
+
+		// A collector reads the results it added, not those of the earlier tests in the log
+		all := col.GetAllResults()
+		if assert.Len(t, all, 1, i) {
+			assert.Equal(t, id, all[0].RefResponse.String())
+		}
+		assert.NoError(t, col.Close())
+	}
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+)
+
+// logBufferSize is the size of the write and read buffers of a result log
+const logBufferSize = 64 << 10
+
+// store holds the results of a collector
+type store interface {
+	add(result *engine.Result) error
+	each(fn func(result *engine.Result) error) error
+	close() error
+}
+
+// memoryStore keeps the results in memory
+type memoryStore struct {
+	results []*engine.Result
+}
+
+func (s *memoryStore) add(result *engine.Result) error {
+	s.results = append(s.results, result)
+	return nil
+}
+
+func (s *memoryStore) each(fn func(result *engine.Result) error) error {
+	for _, result := range s.results {
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) close() error {
+	return nil
+}
+
+// logStore appends the results as JSON lines to a log file, and reads them back from it
+type logStore struct {
+	file          *os.File
+	writer        *bufio.Writer
+	start         int64 // offset of the first result of the store, the log may hold the results of earlier tests
+	size          int64 // offset of the end of the written results
+	temp          bool  // the log is removed on close
+	keepResponses bool
+}
+
+// openLog opens the result log at path for appending, a temporary log if path is empty
+func openLog(path string, keepResponses bool) (*logStore, error) {
+	var (
+		file *os.File
+		err  error
+	)
+	if path == "" {
+		file, err = os.CreateTemp("", "gollmperf-results-*.jsonl")
+	} else {
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open result log: %w", err)
+	}
+	return &logStore{
+		file:          file,
+		writer:        bufio.NewWriterSize(file, logBufferSize),
+		start:         info.Size(),
+		size:          info.Size(),
+		temp:          path == "",
+		keepResponses: keepResponses,
+	}, nil
+}
+
+func (s *logStore) add(result *engine.Result) error {
+	line, err := json.Marshal(newRecord(result, s.keepResponses))
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := s.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to write result log: %w", err)
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+func (s *logStore) each(fn func(result *engine.Result) error) error {
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write result log: %w", err)
+	}
+	file, err := os.Open(s.file.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read result log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, s.start, s.size-s.start), logBufferSize)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var rec record
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return fmt.Errorf("failed to decode result log: %w", err)
+			}
+			if err := fn(rec.result()); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read result log: %w", err)
+		}
+	}
+}
+
+func (s *logStore) close() error {
+	err := errors.Join(s.writer.Flush(), s.file.Close())
+	if s.temp {
+		err = errors.Join(err, os.Remove(s.file.Name()))
+	}
+	return err
+}
+
+// record is a line of a result log, with the fields which the JSON of engine.Result leaves out
+type record struct {
+	*engine.Result
+	InterTokenLatencies []time.Duration `json:"inter_token_latencies,omitempty"`
+	Response            string          `json:"response,omitempty"` // JSON of the response, if the log keeps them
+}
+
+// newRecord returns the record of a result
+func newRecord(result *engine.Result, keepResponse bool) *record {
+	rec := &record{Result: result, InterTokenLatencies: result.InterTokenLatencies}
+	if keepResponse && result.RefResponse != nil {
+		rec.Response = result.RefResponse.String()
+	}
+	return rec
+}
+
+// result returns the result of a record
+func (r *record) result() *engine.Result {
+	result := r.Result
+	if result == nil {
+		result = &engine.Result{}
+	}
+	result.InterTokenLatencies = r.InterTokenLatencies
+	if r.Response != "" {
+		result.RefResponse = &provider.Response{JsonData: r.Response}
+	}
+	return result
+}
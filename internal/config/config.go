@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -23,6 +25,7 @@ func GenerateDefaultConfig(filePath string) error {
 	config.Test.RequestsPerConcurrency = 100
 	config.Test.Timeout = 30 * time.Second
 	config.Test.PerfConcurrencyGroup = []int{1, 2, 4, 8, 16, 20, 32, 40, 48, 64}
+	config.Test.DrainTimeout = 10 * time.Second
 
 	// Add default values for model config
 	config.Model.Name = "${LLM_MODEL_NAME}"
@@ -59,6 +62,17 @@ func GenerateDefaultConfig(filePath string) error {
 	config.RandomDatasetVLLM.Enable = false
 	config.RandomDatasetVLLM.InputLength = 1000
 	config.RandomDatasetVLLM.OutputLength = 100
+	config.RandomDatasetVLLM.NumPrompts = DefaultRandomNumPrompts
+
+	// Add default values for prefix_cache_dataset
+	config.PrefixCacheDataset = PrefixCacheDatasetConfig{
+		Requests:     200,
+		PrefixLength: 2000,
+		SuffixLength: 100,
+		OutputLength: 100,
+		Groups:       4,
+		ShareRatio:   0.8,
+	}
 
 	// Add default values for output
 	config.Output.Format = "html"
@@ -85,11 +99,12 @@ var mlog = qlog.GetRLog("config")
 
 // Config represents the complete configuration for LLMPerf
 type Config struct {
-	Test              TestConfig              `yaml:"test"`
-	Model             ModelConfig             `yaml:"model"`
-	Dataset           DatasetConfig           `yaml:"dataset"`
-	RandomDatasetVLLM RandomDatasetVLLMConfig `yaml:"random_dataset_vllm"`
-	Output            OutputConfig            `yaml:"output"`
+	Test               TestConfig               `yaml:"test"`
+	Model              ModelConfig              `yaml:"model"`
+	Dataset            DatasetConfig            `yaml:"dataset"`
+	RandomDatasetVLLM  RandomDatasetVLLMConfig  `yaml:"random_dataset_vllm" mapstructure:"random_dataset_vllm"`
+	PrefixCacheDataset PrefixCacheDatasetConfig `yaml:"prefix_cache_dataset,omitempty" mapstructure:"prefix_cache_dataset"`
+	Output             OutputConfig             `yaml:"output"`
 }
 
 // TestConfig represents test configuration
@@ -100,6 +115,99 @@ type TestConfig struct {
 	RequestsPerConcurrency int `mapstructure:"requests_per_concurrency"`
 	Timeout                time.Duration
 	PerfConcurrencyGroup   []int `mapstructure:"perf_concurrency_group"`
+	// How long the requests in flight may finish once the test is interrupted, 0 cancels them at once
+	DrainTimeout time.Duration `yaml:"drain_timeout,omitempty" mapstructure:"drain_timeout"`
+	// Default pause of a virtual user between the turns of a session dataset
+	ThinkTime time.Duration `yaml:"think_time,omitempty" mapstructure:"think_time"`
+
+	// Open-loop mode, enabled by a positive request rate
+	RequestRate         float64 `yaml:"request_rate,omitempty" mapstructure:"request_rate"`                 // target requests per second
+	ArrivalDistribution string  `yaml:"arrival_distribution,omitempty" mapstructure:"arrival_distribution"` // poisson (default) or constant
+	MaxInflight         int     `yaml:"max_inflight,omitempty" mapstructure:"max_inflight"`                 // cap on requests in flight, 0 is unlimited
+	MaxRequests         int     `yaml:"max_requests,omitempty" mapstructure:"max_requests"`                 // total requests, 0 is until the duration
+
+	// Staged load profile, run instead of the stress mode if not empty
+	Stages []StageConfig `yaml:"stages,omitempty" mapstructure:"stages"`
+
+	// Goal-seeking search of the max sustainable concurrency, used by seek mode
+	Seek SeekConfig `yaml:"seek,omitempty" mapstructure:"seek"`
+
+	// Replay of a trace of timestamped requests, used by replay mode
+	Replay ReplayConfig `yaml:"replay,omitempty" mapstructure:"replay"`
+
+	// Agents (host:port) the test is split across by coordinator mode, empty runs it in this process
+	Agents []string `yaml:"agents,omitempty" mapstructure:"agents"`
+	// AgentToken is the shared secret of the agents, given to them by gollmperf agent --token
+	AgentToken string `yaml:"agent_token,omitempty" mapstructure:"agent_token"`
+}
+
+// ReplayConfig represents the replay of a trace, each request is sent at its recorded time from the start
+// of the trace. The window of the trace replayed is [start, end), its times are from the first request.
+type ReplayConfig struct {
+	Path  string        `yaml:"path,omitempty" mapstructure:"path"`   // JSONL file of the timestamped requests
+	Speed float64       `yaml:"speed,omitempty" mapstructure:"speed"` // time factor, 2 replays twice as fast, defaults to 1
+	Start time.Duration `yaml:"start,omitempty" mapstructure:"start"` // start of the window, 0 is the start of the trace
+	End   time.Duration `yaml:"end,omitempty" mapstructure:"end"`     // end of the window, 0 is the end of the trace
+}
+
+// SeekConfig represents the search of the highest concurrency at which the SLOs still hold.
+// The concurrency doubles from start until an SLO is violated or max is reached,
+// then a binary search narrows the gap between the last passing and the first failing level.
+type SeekConfig struct {
+	Start     int       `yaml:"start,omitempty" mapstructure:"start"`         // first concurrency probed, defaults to 1
+	Max       int       `yaml:"max,omitempty" mapstructure:"max"`             // highest concurrency probed, defaults to 1024
+	Precision int       `yaml:"precision,omitempty" mapstructure:"precision"` // the search stops once the gap is at most precision, defaults to 1
+	SLO       SLOConfig `yaml:"slo,omitempty" mapstructure:"slo"`
+}
+
+// SLOConfig represents the service level objectives of a probe, a zero value is not checked
+type SLOConfig struct {
+	TTFTP50   time.Duration `yaml:"ttft_p50,omitempty" mapstructure:"ttft_p50"`
+	TTFTP90   time.Duration `yaml:"ttft_p90,omitempty" mapstructure:"ttft_p90"`
+	TTFTP99   time.Duration `yaml:"ttft_p99,omitempty" mapstructure:"ttft_p99"`
+	E2EP50    time.Duration `yaml:"e2e_p50,omitempty" mapstructure:"e2e_p50"`
+	E2EP90    time.Duration `yaml:"e2e_p90,omitempty" mapstructure:"e2e_p90"`
+	E2EP99    time.Duration `yaml:"e2e_p99,omitempty" mapstructure:"e2e_p99"`
+	TPOTP90   time.Duration `yaml:"tpot_p90,omitempty" mapstructure:"tpot_p90"`
+	TPOTP99   time.Duration `yaml:"tpot_p99,omitempty" mapstructure:"tpot_p99"`
+	ErrorRate *float64      `yaml:"error_rate,omitempty" mapstructure:"error_rate"` // max error rate in percent, 0 allows no error
+}
+
+// IsEmpty returns whether no SLO is configured
+func (s SLOConfig) IsEmpty() bool {
+	return s == SLOConfig{}
+}
+
+// String returns the configured SLOs, e.g. "ttft_p90 <= 500ms, error_rate <= 1%"
+func (s SLOConfig) String() string {
+	var slos []string
+	for _, slo := range []struct {
+		name  string
+		limit time.Duration
+	}{
+		{"ttft_p50", s.TTFTP50}, {"ttft_p90", s.TTFTP90}, {"ttft_p99", s.TTFTP99},
+		{"e2e_p50", s.E2EP50}, {"e2e_p90", s.E2EP90}, {"e2e_p99", s.E2EP99},
+		{"tpot_p90", s.TPOTP90}, {"tpot_p99", s.TPOTP99},
+	} {
+		if slo.limit > 0 {
+			slos = append(slos, fmt.Sprintf("%s <= %v", slo.name, slo.limit))
+		}
+	}
+	if s.ErrorRate != nil {
+		slos = append(slos, fmt.Sprintf("error_rate <= %v%%", *s.ErrorRate))
+	}
+	return strings.Join(slos, ", ")
+}
+
+// StageConfig represents a stage of a staged load profile. The load moves from the target of
+// the previous stage (0 before the first one) to the target of the stage over its duration.
+// All the stages of a profile set either a target concurrency or a target request rate.
+type StageConfig struct {
+	Name        string        `yaml:"name,omitempty" mapstructure:"name"`               // defaults to stage-<n>
+	Duration    time.Duration `yaml:"duration" mapstructure:"duration"`                 // length of the stage
+	Concurrency int           `yaml:"concurrency,omitempty" mapstructure:"concurrency"` // target number of workers (closed-loop)
+	Rate        float64       `yaml:"rate,omitempty" mapstructure:"rate"`               // target requests per second (open-loop)
+	Ramp        string        `yaml:"ramp,omitempty" mapstructure:"ramp"`               // linear (default) or step, which jumps to the target at once
 }
 
 // SystemPromptTemplate represents the system prompt configuration
@@ -117,21 +225,109 @@ type ModelConfig struct {
 	Endpoint             string
 	Headers              map[string]string
 	ApiKey               string                 `mapstructure:"api_key"`
+	APIKind              string                 `yaml:"api_kind,omitempty" mapstructure:"api_kind"` // chat (default), completions, embeddings, responses
 	ParamsTemplate       map[string]interface{} `mapstructure:"params_template"`
 	SystemPromptTemplate SystemPromptTemplate   `mapstructure:"system_prompt_template"`
+	Tokenizer            string                 `yaml:"tokenizer,omitempty" mapstructure:"tokenizer"` // HuggingFace tokenizer.json or tiktoken file
+	// Sections holds the provider specific sections (model.<provider>), which are decoded by the provider registry
+	Sections map[string]interface{} `yaml:",inline" mapstructure:",remain"`
 }
 
 // DatasetConfig represents dataset configuration
 type DatasetConfig struct {
-	Type string
+	Type string // jsonl (default), sessions, sharegpt, alpaca, csv or text
 	Path string
+	// Options of the prompt datasets (sharegpt, alpaca, csv and text)
+	MaxInputLength     int    `yaml:"max_input_len,omitempty" mapstructure:"max_input_len"`               // prompts of more tokens are skipped, 0 keeps all
+	NumSamples         int    `yaml:"num_samples,omitempty" mapstructure:"num_samples"`                   // prompts randomly sampled, 0 keeps all in order
+	Seed               uint64 `yaml:"seed,omitempty" mapstructure:"seed"`                                 // seed of the sampling, 0 for a random one
+	OutputLength       int    `yaml:"output_len,omitempty" mapstructure:"output_len"`                     // max_tokens of the requests, 0 leaves it to the server
+	ReferenceOutputLen bool   `yaml:"reference_output_len,omitempty" mapstructure:"reference_output_len"` // max_tokens from the tokens of the reference answer
+	PromptColumn       string `yaml:"prompt_column,omitempty" mapstructure:"prompt_column"`               // csv: column of the prompts, defaults to prompt
+	OutputColumn       string `yaml:"output_column,omitempty" mapstructure:"output_column"`               // csv: column of the reference answers, optional
+	// Request templating, the Go-template placeholders of the entries are rendered for every request
+	Template   bool   `yaml:"template,omitempty" mapstructure:"template"`
+	VarsPath   string `yaml:"vars_path,omitempty" mapstructure:"vars_path"`       // CSV, JSON or JSONL file of rows of template variables
+	VarsPerRow bool   `yaml:"vars_per_row,omitempty" mapstructure:"vars_per_row"` // row i of the variables goes with entry i, instead of a random row per request
+	// Mixed workload, the requests are sampled from the sources by weight instead of from the dataset above
+	Sources []DatasetSource `yaml:"sources,omitempty" mapstructure:"sources"`
+}
+
+// DatasetSource represents a dataset of a mixed workload, with its share of the requests
+type DatasetSource struct {
+	DatasetConfig `yaml:",inline" mapstructure:",squash"`
+	Name          string                 `yaml:"name,omitempty" mapstructure:"name"`     // label of its results, defaults to the file name
+	Weight        float64                `yaml:"weight,omitempty" mapstructure:"weight"` // relative share of the requests, defaults to 1
+	Params        map[string]interface{} `yaml:"params,omitempty" mapstructure:"params"` // request params overriding the ones of its entries, e.g. max_tokens
+}
+
+// normalizeSources defaults the names and weights of the sources of a mixed workload, and checks them
+func (c *DatasetConfig) normalizeSources() error {
+	names := make(map[string]bool, len(c.Sources))
+	for i := range c.Sources {
+		src := &c.Sources[i]
+		if src.Type == "" {
+			src.Type = "jsonl"
+		}
+		if src.Type == "sessions" {
+			return fmt.Errorf("dataset source %d: a sessions dataset can not be mixed", i+1)
+		}
+		if len(src.Sources) > 0 {
+			return fmt.Errorf("dataset source %d: sources can not be nested", i+1)
+		}
+		if src.Weight < 0 {
+			return fmt.Errorf("dataset source %d: negative weight %v", i+1, src.Weight)
+		}
+		if src.Weight == 0 {
+			src.Weight = 1
+		}
+		if src.Name == "" {
+			src.Name = strings.TrimSuffix(filepath.Base(src.Path), filepath.Ext(src.Path))
+		}
+		if names[src.Name] {
+			return fmt.Errorf("dataset source %d: duplicate name %q", i+1, src.Name)
+		}
+		names[src.Name] = true
+	}
+	return nil
 }
 
+// DefaultRandomNumPrompts is the default number of prompts of the random dataset
+const DefaultRandomNumPrompts = 100
+
 // RandomDatasetVLLMConfig represents random dataset generation config for vLLM
 type RandomDatasetVLLMConfig struct {
 	Enable       bool `yaml:"random-enable" mapstructure:"random-enable"`
 	InputLength  int  `yaml:"random-input-len" mapstructure:"random-input-len"`
 	OutputLength int  `yaml:"random-output-len" mapstructure:"random-output-len"`
+	// Number of distinct prompts, each with its own input and output lengths, defaults to DefaultRandomNumPrompts
+	NumPrompts         int                `yaml:"random-num-prompts,omitempty" mapstructure:"random-num-prompts"`
+	InputDistribution  LengthDistribution `yaml:"random-input-dist,omitempty" mapstructure:"random-input-dist"`
+	OutputDistribution LengthDistribution `yaml:"random-output-dist,omitempty" mapstructure:"random-output-dist"`
+}
+
+// LengthDistribution represents the distribution of the token lengths of a random dataset, whose mean
+// is the configured length except for a histogram. The sampled lengths are clamped to [min, max], min is at least 1.
+type LengthDistribution struct {
+	Type       string  `yaml:"type,omitempty" mapstructure:"type"`               // fixed (default), uniform, normal, lognormal or histogram
+	RangeRatio float64 `yaml:"range-ratio,omitempty" mapstructure:"range-ratio"` // uniform: lengths within mean * [1 - ratio, 1 + ratio]
+	StdDev     float64 `yaml:"stddev,omitempty" mapstructure:"stddev"`           // normal and lognormal: standard deviation in tokens
+	Path       string  `yaml:"path,omitempty" mapstructure:"path"`               // histogram: file of "length,weight" lines
+	Min        int     `yaml:"min,omitempty" mapstructure:"min"`
+	Max        int     `yaml:"max,omitempty" mapstructure:"max"`
+}
+
+// PrefixCacheDatasetConfig represents the generation of a prefix cache benchmark dataset: the shared requests
+// are spread over groups, each group sharing a long random prefix with varied suffixes, and the unique requests
+// get a random prefix of the same length, so that their TTFT can be compared.
+type PrefixCacheDatasetConfig struct {
+	Enable       bool    `yaml:"enable" mapstructure:"enable"`
+	Requests     int     `yaml:"requests" mapstructure:"requests"`       // number of requests of the dataset
+	PrefixLength int     `yaml:"prefix_len" mapstructure:"prefix_len"`   // tokens of the prefix
+	SuffixLength int     `yaml:"suffix_len" mapstructure:"suffix_len"`   // tokens of the suffix
+	OutputLength int     `yaml:"output_len" mapstructure:"output_len"`   // max tokens of the response, 0 leaves it to the server
+	Groups       int     `yaml:"groups" mapstructure:"groups"`           // number of distinct shared prefixes, defaults to 1
+	ShareRatio   float64 `yaml:"share_ratio" mapstructure:"share_ratio"` // fraction of the requests which share a prefix, from 0 to 1
 }
 
 // OutputConfig represents output configuration
@@ -139,6 +335,7 @@ type OutputConfig struct {
 	Format          string
 	Path            string
 	BatchResultPath string `mapstructure:"batch_result_path"`
+	ResultLog       string `mapstructure:"result_log"` // append-only log of the raw results, a temporary one if empty
 }
 
 // NewConfig creates a new Config with default values
@@ -162,10 +359,18 @@ func LoadConfig(configPath string) (*Config, error) {
 	// Create new config instance
 	config := NewConfig()
 
+	// A list of datasets is a mixed workload
+	if sources, ok := v.Get("dataset").([]interface{}); ok {
+		v.Set("dataset", map[string]interface{}{"sources": sources})
+	}
+
 	// Unmarshal config
 	if err := v.Unmarshal(config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	if err := config.Dataset.normalizeSources(); err != nil {
+		return nil, err
+	}
 
 	// Handle environment variable substitution for model.name
 	if modelName := v.GetString("model.name"); modelName != "" {
@@ -210,6 +415,7 @@ func (c *Config) OverrideWithFlags(flags *ConfigOverrideFlags) {
 	}
 	if flags.Dataset != "" {
 		c.Dataset.Path = flags.Dataset
+		c.Dataset.Sources = nil // the dataset file replaces a mixed workload
 	}
 	if flags.ApiKey != "" {
 		c.Model.ApiKey = flags.ApiKey
@@ -226,6 +432,27 @@ func (c *Config) OverrideWithFlags(flags *ConfigOverrideFlags) {
 	if flags.BatchResultFile != "" {
 		c.Output.BatchResultPath = flags.BatchResultFile
 	}
+	if flags.Tokenizer != "" {
+		c.Model.Tokenizer = flags.Tokenizer
+	}
+	if flags.RequestRate > 0 {
+		c.Test.RequestRate = flags.RequestRate
+	}
+	if flags.MaxInflight > 0 {
+		c.Test.MaxInflight = flags.MaxInflight
+	}
+	if flags.Trace != "" {
+		c.Test.Replay.Path = flags.Trace
+	}
+	if flags.ReplaySpeed > 0 {
+		c.Test.Replay.Speed = flags.ReplaySpeed
+	}
+	if len(flags.Agents) > 0 {
+		c.Test.Agents = flags.Agents
+	}
+	if flags.AgentToken != "" {
+		c.Test.AgentToken = flags.AgentToken
+	}
 }
 
 // ConfigOverrideFlags holds the command line flags for overriding config values
@@ -241,4 +468,11 @@ type ConfigOverrideFlags struct {
 	RandomEnable    bool
 	RandomInputLen  int
 	RandomOutputLen int
+	RequestRate     float64
+	MaxInflight     int
+	Tokenizer       string
+	Trace           string
+	ReplaySpeed     float64
+	Agents          []string
+	AgentToken      string
 }
@@ -2,7 +2,12 @@ package config
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -16,3 +21,87 @@ func TestLoadConfig(t *testing.T) {
 	t.Logf("Full config: %s", string(b))
 
 }
+
+func TestLoadConfig_Stages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stages.yaml")
+	data := `
+test:
+  stages:
+    - { name: ramp-up, duration: 2m, concurrency: 64 }
+    - { duration: 30s, rate: 12.5, ramp: step }
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []StageConfig{
+		{Name: "ramp-up", Duration: 2 * time.Minute, Concurrency: 64},
+		{Duration: 30 * time.Second, Rate: 12.5, Ramp: "step"},
+	}, config.Test.Stages)
+}
+
+func TestLoadConfig_RandomDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "random.yaml")
+	data := `
+random_dataset_vllm:
+  random-enable: true
+  random-input-len: 1000
+  random-output-len: 200
+  random-num-prompts: 500
+  random-input-dist: { type: lognormal, stddev: 300, max: 4000 }
+  random-output-dist: { type: uniform, range-ratio: 0.5 }
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, RandomDatasetVLLMConfig{
+		Enable:             true,
+		InputLength:        1000,
+		OutputLength:       200,
+		NumPrompts:         500,
+		InputDistribution:  LengthDistribution{Type: "lognormal", StdDev: 300, Max: 4000},
+		OutputDistribution: LengthDistribution{Type: "uniform", RangeRatio: 0.5},
+	}, config.RandomDatasetVLLM)
+}
+
+func TestLoadConfig_DatasetSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mixed.yaml")
+	data := `
+dataset:
+  - { name: chat, weight: 6, path: ./chat.jsonl }
+  - { type: sharegpt, weight: 3, path: ./data/rag.json, max_input_len: 8000, params: { max_tokens: 256 } }
+  - { type: text, path: ./summaries.txt }
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	sources := config.Dataset.Sources
+	assert.Len(t, sources, 3)
+	assert.Equal(t, DatasetSource{DatasetConfig: DatasetConfig{Type: "jsonl", Path: "./chat.jsonl"}, Name: "chat", Weight: 6}, sources[0])
+	assert.Equal(t, "rag", sources[1].Name)
+	assert.Equal(t, 8000, sources[1].MaxInputLength)
+	assert.Equal(t, 256, sources[1].Params["max_tokens"])
+	assert.Equal(t, "summaries", sources[2].Name)
+	assert.Equal(t, 1.0, sources[2].Weight)
+
+	// The sources may also sit under dataset, their names must be unique
+	data = `
+dataset:
+  sources:
+    - { path: ./a/chat.jsonl }
+    - { path: ./b/chat.jsonl }
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "duplicate name")
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"sync"
 
 	"github.com/FortuneW/gollmperf/internal/provider"
@@ -9,15 +10,16 @@ import (
 
 var batchLog = qlog.GetRLog("engine.batch")
 
-// RunBatch runs a batch test
-func (e *Engine) RunBatch(dataset []provider.AnyParams) ([]*Result, error) {
+// RunBatch runs a batch test, the results are in the order of the dataset. Once ctx is done the remaining
+// cases are not sent, their results are marked as cancelled so that the results still match the dataset.
+func (e *Engine) RunBatch(ctx context.Context, dataset []provider.AnyParams) ([]*Result, error) {
 	batchLog.Infof("Starting batch testing with concurrency %d...", e.config.Test.Concurrency)
 
-	// Create results slice with exact capacity
-	results := make([]*Result, len(dataset))
+	reqCtx, cancel := e.requestContext(ctx)
+	defer cancel()
 
-	// Channel to collect results with their indices
-	resultsChan := make(chan workerResult, len(dataset))
+	// The results keep the order of the dataset
+	results := e.newResultList()
 
 	// Create jobs channel
 	jobsChan := make(chan struct {
@@ -39,26 +41,18 @@ func (e *Engine) RunBatch(dataset []provider.AnyParams) ([]*Result, error) {
 	wg := e.startWorkers(concurrency, func(workerID int, wg *sync.WaitGroup) {
 		// Process jobs from the jobs channel
 		for job := range jobsChan {
-			result := e.executeRequest(job.req)
-
-			// Send indexed result to results channel
-			resultsChan <- workerResult{
-				index:  job.index,
-				result: result,
+			var result *Result
+			if ctx.Err() != nil {
+				result = cancelledResult(ctx)
+			} else {
+				result = e.executeRequest(reqCtx, job.req)
 			}
+
+			results.addAt(job.index, result)
 		}
 	})
 
-	// Close results channel when all workers are done
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	// Collect results from channel in order
-	for indexedRes := range resultsChan {
-		results[indexedRes.index] = indexedRes.result
-	}
+	wg.Wait()
 
-	return results, nil
+	return results.list(), nil
 }
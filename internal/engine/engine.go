@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"sync"
 	"time"
 
@@ -12,25 +14,84 @@ import (
 
 // Engine is the main test engine
 type Engine struct {
-	config   *config.Config
-	provider provider.Provider
+	config       *config.Config
+	provider     provider.Provider
+	tokenCounter TokenCounter
+	renderer     RequestRenderer
+	sink         ResultSink
+}
+
+// TokenCounter counts the tokens of a text offline
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// RequestRenderer renders a dataset entry into the params of a request, freshly for each request
+type RequestRenderer interface {
+	Render(reqCase provider.AnyParams) (provider.AnyParams, error)
 }
 
 // Result represents a single test result
 type Result struct {
-	RequestTokens     int                `json:"request_tokens"`
-	ResponseTokens    int                `json:"response_tokens"`
-	Latency           time.Duration      `json:"latency"`
-	FirstTokenLatency time.Duration      `json:"first_token_latency,omitempty"`
-	Success           bool               `json:"success"`
-	Error             *provider.Error    `json:"error,omitempty"`
-	StartTime         time.Time          `json:"start_time"`
-	EndTime           time.Time          `json:"end_time"`
-	RefResponse       *provider.Response `json:"-"`
+	RequestTokens           int                `json:"request_tokens"`
+	ResponseTokens          int                `json:"response_tokens"`
+	ReasoningTokens         int                `json:"reasoning_tokens,omitempty"`
+	CachedTokens            int                `json:"cached_tokens,omitempty"`             // prompt tokens served from the prefix cache
+	TokenSource             string             `json:"token_source,omitempty"`              // where the request and response tokens come from, one of TokenSource*
+	EstimatedRequestTokens  int                `json:"estimated_request_tokens,omitempty"`  // client-side estimate, to validate the usage
+	EstimatedResponseTokens int                `json:"estimated_response_tokens,omitempty"` // client-side estimate, to validate the usage
+	Latency                 time.Duration      `json:"latency"`
+	FirstTokenLatency       time.Duration      `json:"first_token_latency,omitempty"`
+	TimePerOutputToken      time.Duration      `json:"time_per_output_token,omitempty"` // (latency - first token latency) / (response tokens - 1)
+	InterTokenLatencies     []time.Duration    `json:"-"`
+	ServerLoadTime          time.Duration      `json:"server_load_time,omitempty"`
+	ServerPrefillTime       time.Duration      `json:"server_prefill_time,omitempty"`
+	ServerDecodeTime        time.Duration      `json:"server_decode_time,omitempty"`
+	Embeddings              int                `json:"embeddings,omitempty"`
+	Stage                   string             `json:"stage,omitempty"`   // stage of a staged load profile the request was sent in
+	Session                 string             `json:"session,omitempty"` // session of a session dataset the request belongs to
+	Turn                    int                `json:"turn,omitempty"`    // turn of the session, starting at 1
+	Tags                    map[string]string  `json:"tags,omitempty"`    // tags of the dataset entry, see TagsKey
+	Success                 bool               `json:"success"`
+	Cancelled               bool               `json:"cancelled,omitempty"` // aborted or never sent because the test was interrupted
+	Error                   *provider.Error    `json:"error,omitempty"`
+	StartTime               time.Time          `json:"start_time"`
+	EndTime                 time.Time          `json:"end_time"`
+	RefResponse             *provider.Response `json:"-"`
 }
 
 var mlog = qlog.GetRLog("engine")
 
+// TagsKey is the key of the tags of a dataset entry, e.g. {"_tags": {"prefix": "shared"}}.
+// The tags are not sent, they label the result so that the reports can break the metrics down.
+const TagsKey = "_tags"
+
+// VarsKey is the key of the template variables of a dataset entry, e.g. {"_vars": {"user_name": "Ada"}}.
+// The variables are not sent, they are used by the RequestRenderer.
+const VarsKey = "_vars"
+
+// splitTags returns the request params of a dataset entry without its tags, and the tags
+func splitTags(reqCase provider.AnyParams) (provider.AnyParams, map[string]string) {
+	raw, ok := reqCase[TagsKey]
+	if !ok {
+		return reqCase, nil
+	}
+	params := maps.Clone(reqCase)
+	delete(params, TagsKey)
+
+	var tags map[string]string
+	switch t := raw.(type) {
+	case map[string]string:
+		tags = t
+	case map[string]any:
+		tags = make(map[string]string, len(t))
+		for k, v := range t {
+			tags[k] = fmt.Sprint(v)
+		}
+	}
+	return params, tags
+}
+
 // NewEngine creates a new test engine
 func NewEngine(cfg *config.Config, prov provider.Provider) *Engine {
 	if cfg.Model.ParamsTemplate == nil {
@@ -46,8 +107,71 @@ func NewEngine(cfg *config.Config, prov provider.Provider) *Engine {
 	}
 }
 
-// runWarmup runs the warmup phase
-func (e *Engine) runWarmup(dataset []provider.AnyParams) (err error) {
+// SetTokenCounter sets the offline token counter, which estimates the request and response tokens
+// of each response, in place of the usage if the server reports none
+func (e *Engine) SetTokenCounter(counter TokenCounter) {
+	e.tokenCounter = counter
+}
+
+// SetRequestRenderer sets the renderer of the dataset entries, which is called for every request
+func (e *Engine) SetRequestRenderer(renderer RequestRenderer) {
+	e.renderer = renderer
+}
+
+// requestContext returns the context of the requests of a test run under ctx. It outlives ctx by
+// the drain timeout, so that the requests in flight when the test is interrupted can still finish.
+// The returned cancel function must be called once the test is over.
+func (e *Engine) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-reqCtx.Done():
+			return
+		}
+
+		if drain := e.config.Test.DrainTimeout; drain > 0 {
+			mlog.Warnf("Test interrupted, draining requests in flight for up to %v...", drain)
+			timer := time.NewTimer(drain)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				mlog.Warnf("Drain timeout reached, cancelling requests in flight")
+			case <-reqCtx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return reqCtx, cancel
+}
+
+// sleepContext sleeps for d, it returns false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cancelledResult returns the result of a request which was not sent because the test was interrupted
+func cancelledResult(ctx context.Context) *Result {
+	return &Result{
+		StartTime: time.Now(),
+		Cancelled: true,
+		Error:     provider.NewError(0, fmt.Errorf("request not sent: %w", context.Cause(ctx))),
+	}
+}
+
+// runWarmup runs the warmup phase, it stops early without error if ctx is done
+func (e *Engine) runWarmup(ctx context.Context, dataset []provider.AnyParams) (err error) {
 	warmupDuration := e.config.Test.Warmup
 	if warmupDuration <= 0 {
 		return
@@ -66,9 +190,12 @@ func (e *Engine) runWarmup(dataset []provider.AnyParams) (err error) {
 			startTime := time.Now()
 			reqIndex := workerID // Each worker has a different starting index to avoid request repetition
 
-			for time.Since(startTime) < warmupDuration {
+			for time.Since(startTime) < warmupDuration && ctx.Err() == nil {
 				req := dataset[reqIndex%len(dataset)]
-				res := e.executeRequest(req)
+				res := e.executeRequest(ctx, req)
+				if res.Cancelled {
+					break
+				}
 				if !res.Success {
 					if err == nil {
 						err = fmt.Errorf("warmup failed, first err: %s", res.Error)
@@ -76,7 +203,7 @@ func (e *Engine) runWarmup(dataset []provider.AnyParams) (err error) {
 					break
 				}
 				reqIndex++
-				time.Sleep(100 * time.Millisecond)
+				sleepContext(ctx, 100*time.Millisecond)
 			}
 		}(i)
 	}
@@ -85,25 +212,55 @@ func (e *Engine) runWarmup(dataset []provider.AnyParams) (err error) {
 	return
 }
 
-// executeRequest executes a single request
-func (e *Engine) executeRequest(reqCase provider.AnyParams) *Result {
+// executeRequest executes a single request, a request failing once ctx is done is marked as cancelled
+func (e *Engine) executeRequest(ctx context.Context, reqCase provider.AnyParams) *Result {
+	reqCase, tags := splitTags(reqCase)
 	result := &Result{
+		Tags:      tags,
 		StartTime: time.Now(),
 	}
 
-	resp, err := e.provider.SendRequest(e.config.Model.ParamsTemplate, reqCase, e.config.Model.Headers)
+	if e.renderer != nil {
+		rendered, err := e.renderer.Render(reqCase)
+		if err != nil {
+			result.Error = provider.NewError(0, fmt.Errorf("failed to render request: %w", err))
+			return result
+		}
+		reqCase = rendered
+	} else if _, ok := reqCase[VarsKey]; ok {
+		reqCase = maps.Clone(reqCase)
+		delete(reqCase, VarsKey)
+	}
+
+	resp, err := e.provider.SendRequest(ctx, e.config.Model.ParamsTemplate, reqCase, e.config.Model.Headers)
 	if err != nil {
 		// mlog.Warnf("recv api err: %v", err)
 		result.Error = err
 		result.Success = false
+		result.Cancelled = ctx.Err() != nil
 		return result
 	}
 
 	result.RefResponse = resp
-	result.RequestTokens = resp.Usage.PromptTokens
-	result.ResponseTokens = resp.Usage.CompletionTokens
+	e.countTokens(result, reqCase, resp)
+	if resp.Usage.CompletionTokensDetails != nil {
+		result.ReasoningTokens = resp.Usage.CompletionTokensDetails.ReasoningTokens
+	}
+	if resp.Usage.PromptTokensDetails != nil {
+		result.CachedTokens = resp.Usage.PromptTokensDetails.CachedTokens
+	}
 	result.Latency = resp.Latency
 	result.FirstTokenLatency = resp.FirstTokenLatency
+	result.InterTokenLatencies = resp.InterTokenLatencies
+	if decode := resp.Latency - resp.FirstTokenLatency; resp.FirstTokenLatency > 0 && decode > 0 && result.ResponseTokens > 1 {
+		result.TimePerOutputToken = decode / time.Duration(result.ResponseTokens-1)
+	}
+	result.Embeddings = resp.Embeddings
+	if resp.ServerTiming != nil {
+		result.ServerLoadTime = resp.ServerTiming.LoadDuration
+		result.ServerPrefillTime = resp.ServerTiming.PrefillDuration
+		result.ServerDecodeTime = resp.ServerTiming.DecodeDuration
+	}
 	result.Success = true
 	result.EndTime = time.Now()
 
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStress_Interrupted(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		drain     time.Duration
+		cancelled bool
+	}{
+		{"cancel at once", 0, true},
+		{"drain requests in flight", time.Second, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prov := &sleepProvider{delay: 200 * time.Millisecond}
+			cfg := &config.Config{Test: config.TestConfig{Concurrency: 4, Duration: time.Minute, DrainTimeout: tc.drain}}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(300*time.Millisecond, cancel)
+			start := time.Now()
+			results, err := NewEngine(cfg, prov).RunStress(ctx, []provider.AnyParams{{}})
+
+			assert.NoError(t, err)
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Len(t, results, 8)
+			var cancelled int
+			for _, r := range results {
+				if r.Cancelled {
+					cancelled++
+					assert.False(t, r.Success)
+				}
+			}
+			if tc.cancelled {
+				assert.Equal(t, 4, cancelled)
+			} else {
+				assert.Zero(t, cancelled)
+			}
+		})
+	}
+}
+
+func TestRunBatch_Interrupted(t *testing.T) {
+	prov := &sleepProvider{delay: 100 * time.Millisecond}
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 2, DrainTimeout: time.Second}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(150*time.Millisecond, cancel)
+	results, err := NewEngine(cfg, prov).RunBatch(ctx, make([]provider.AnyParams, 10))
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 10)
+	var succeeded, cancelled int
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		}
+		if r.Cancelled {
+			cancelled++
+		}
+	}
+	assert.Equal(t, 4, succeeded)
+	assert.Equal(t, 6, cancelled)
+}
+
+func TestExecuteRequest_Tags(t *testing.T) {
+	prov := &echoProvider{}
+	e := NewEngine(&config.Config{}, prov)
+
+	result := e.executeRequest(context.Background(), provider.AnyParams{
+		"messages": []any{map[string]any{"role": "user", "content": "Hi"}},
+		TagsKey:    map[string]any{"prefix": "shared", "prefix_group": 2.0},
+	})
+
+	assert.True(t, result.Success)
+	assert.Equal(t, map[string]string{"prefix": "shared", "prefix_group": "2"}, result.Tags)
+	assert.NotContains(t, prov.params[0], TagsKey)
+}
+
+// wordCounter counts the words of a text as tokens
+type wordCounter struct{}
+
+func (wordCounter) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestExecuteRequest_TokenCounter(t *testing.T) {
+	prov := &echoProvider{}
+	e := NewEngine(&config.Config{}, prov)
+	req := provider.AnyParams{
+		"messages": []any{
+			map[string]any{"role": "system", "content": []any{map[string]any{"type": "text", "text": "Be brief"}}},
+			map[string]any{"role": "user", "content": "Hi there"},
+		},
+	}
+
+	// Without counter nor streamed chunks the missing usage stays zero
+	result := e.executeRequest(context.Background(), req)
+	assert.Equal(t, 0, result.RequestTokens)
+	assert.Equal(t, "", result.TokenSource)
+
+	// The streamed chunks approximate the response tokens
+	prov.chunks = 5
+	result = e.executeRequest(context.Background(), req)
+	assert.Equal(t, TokenSourceChunks, result.TokenSource)
+	assert.Equal(t, 0, result.RequestTokens)
+	assert.Equal(t, 5, result.ResponseTokens)
+
+	// Without counter the usage is not validated against the chunks
+	prov.usage = provider.Usage{PromptTokens: 20, CompletionTokens: 200}
+	result = e.executeRequest(context.Background(), req)
+	assert.Equal(t, TokenSourceUsage, result.TokenSource)
+	assert.Equal(t, 200, result.ResponseTokens)
+	assert.Zero(t, result.EstimatedResponseTokens)
+	prov.usage = provider.Usage{}
+
+	// The token counter takes precedence over the chunks
+	e.SetTokenCounter(wordCounter{})
+	result = e.executeRequest(context.Background(), req)
+	assert.True(t, result.Success)
+	assert.Equal(t, TokenSourceTokenizer, result.TokenSource)
+	assert.Equal(t, 4, result.RequestTokens)
+	assert.Equal(t, 3, result.ResponseTokens) // "re: Hi there"
+
+	// The usage is preferred, the estimates are kept to validate it
+	prov.usage = provider.Usage{PromptTokens: 20, CompletionTokens: 9}
+	result = e.executeRequest(context.Background(), req)
+	assert.Equal(t, TokenSourceUsage, result.TokenSource)
+	assert.Equal(t, 20, result.RequestTokens)
+	assert.Equal(t, 9, result.ResponseTokens)
+	assert.Equal(t, 4, result.EstimatedRequestTokens)
+	assert.Equal(t, 3, result.EstimatedResponseTokens)
+}
+
+// prefixRenderer prefixes the prompt of a request, or fails on an empty prompt
+type prefixRenderer struct{}
+
+func (prefixRenderer) Render(reqCase provider.AnyParams) (provider.AnyParams, error) {
+	if reqCase["prompt"] == "" {
+		return nil, fmt.Errorf("empty prompt")
+	}
+	params := maps.Clone(reqCase)
+	params["messages"] = []any{map[string]any{"role": "user", "content": "rendered " + reqCase["prompt"].(string)}}
+	delete(params, "prompt")
+	return params, nil
+}
+
+func TestExecuteRequest_Renderer(t *testing.T) {
+	prov := &echoProvider{}
+	e := NewEngine(&config.Config{}, prov)
+
+	// Without renderer the variables are not sent
+	result := e.executeRequest(context.Background(), provider.AnyParams{
+		"messages": []any{map[string]any{"role": "user", "content": "Hi"}},
+		VarsKey:    map[string]any{"user_name": "Ada"},
+	})
+	assert.True(t, result.Success)
+	assert.NotContains(t, prov.params[0], VarsKey)
+
+	e.SetRequestRenderer(prefixRenderer{})
+	result = e.executeRequest(context.Background(), provider.AnyParams{"prompt": "Hi"})
+	assert.True(t, result.Success)
+	assert.Equal(t, "rendered Hi", prov.params[1]["messages"].([]any)[0].(map[string]any)["content"])
+
+	result = e.executeRequest(context.Background(), provider.AnyParams{"prompt": ""})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error.Message, "failed to render request")
+	assert.Len(t, prov.params, 2)
+}
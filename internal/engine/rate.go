@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/qlog"
+)
+
+var rateLog = qlog.GetRLog("engine.rate")
+
+// Arrival distributions of the open-loop mode
+const (
+	ArrivalPoisson  = "poisson"  // exponential inter-arrival times
+	ArrivalConstant = "constant" // fixed inter-arrival times
+)
+
+// newArrivals returns a generator of inter-arrival times at a request rate
+func newArrivals(distribution string) (func(rate float64) time.Duration, error) {
+	switch distribution {
+	case "", ArrivalPoisson:
+		return func(rate float64) time.Duration {
+			return time.Duration(rand.ExpFloat64() * float64(time.Second) / rate)
+		}, nil
+	case ArrivalConstant:
+		return func(rate float64) time.Duration {
+			return time.Duration(float64(time.Second) / rate)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported arrival distribution: %s, supported distributions: %s, %s",
+			distribution, ArrivalPoisson, ArrivalConstant)
+	}
+}
+
+// arrivalInterval returns a generator of inter-arrival times for a fixed request rate
+func arrivalInterval(distribution string, rate float64) (func() time.Duration, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("request rate must be positive, got %v", rate)
+	}
+	next, err := newArrivals(distribution)
+	if err != nil {
+		return nil, err
+	}
+	return func() time.Duration {
+		return next(rate)
+	}, nil
+}
+
+// RunRate runs an open-loop test: requests are dispatched at the target request rate
+// without waiting for the earlier ones to finish, so that latency is measured at a given offered load.
+// At most max_inflight requests are in flight, later arrivals wait for a free slot.
+// The test stops after the test duration or max_requests requests, by default after one pass over the dataset,
+// or once ctx is done.
+func (e *Engine) RunRate(ctx context.Context, dataset []provider.AnyParams) ([]*Result, error) {
+	if len(dataset) == 0 {
+		return nil, fmt.Errorf("dataset is empty")
+	}
+
+	testCfg := e.config.Test
+	nextInterval, err := arrivalInterval(testCfg.ArrivalDistribution, testCfg.RequestRate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Warmup phase
+	if testCfg.Warmup > 0 {
+		onceWarmup.Do(func() {
+			rateLog.Infof("Starting warmup for %v...", testCfg.Warmup)
+			err = e.runWarmup(ctx, dataset)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxRequests := testCfg.MaxRequests
+	if maxRequests <= 0 && testCfg.Duration <= 0 {
+		maxRequests = len(dataset)
+	}
+
+	rateLog.Infof("Starting open-loop testing at %.2f requests/s (%s arrivals) for %v or %d requests, max in flight %d...",
+		testCfg.RequestRate, arrivalDistributionName(testCfg.ArrivalDistribution), testCfg.Duration, maxRequests, testCfg.MaxInflight)
+
+	// Arrival times are offsets from the start, so that late dispatches do not lower the offered load
+	var offset time.Duration
+	results, delayed := e.runOpenLoop(ctx, dataset, testCfg.MaxInflight, func(i int, elapsed time.Duration) (time.Duration, string, bool) {
+		if i > 0 {
+			offset += nextInterval()
+		}
+		if maxRequests > 0 && i >= maxRequests {
+			return 0, "", false
+		}
+		if testCfg.Duration > 0 && (offset >= testCfg.Duration || elapsed >= testCfg.Duration) {
+			return 0, "", false
+		}
+		return offset, "", true
+	})
+
+	if delayed > 0 {
+		rateLog.Warnf("%d requests were delayed by max_inflight %d, the offered load was not reached", delayed, testCfg.MaxInflight)
+	}
+
+	return results, nil
+}
+
+// runOpenLoop dispatches the i-th request at the offset from the start given by schedule, without waiting
+// for the earlier requests to finish, until schedule reports the end of the test. Schedule is also given the
+// elapsed time, which runs behind the offsets when dispatches are delayed. Dispatching stops once ctx is done.
+// At most maxInflight requests are in flight, it returns the results and the number of dispatches delayed by the cap.
+func (e *Engine) runOpenLoop(ctx context.Context, dataset []provider.AnyParams, maxInflight int,
+	schedule func(i int, elapsed time.Duration) (offset time.Duration, stage string, ok bool)) ([]*Result, int) {
+	var (
+		wg       sync.WaitGroup
+		results  = e.newResultList()
+		inflight chan struct{}
+		delayed  int
+	)
+	if maxInflight > 0 {
+		inflight = make(chan struct{}, maxInflight)
+	}
+
+	reqCtx, cancel := e.requestContext(ctx)
+	defer cancel()
+
+	startTime := time.Now()
+	for i := 0; ; i++ {
+		offset, stage, ok := schedule(i, time.Since(startTime))
+		if !ok {
+			break
+		}
+		if !sleepContext(ctx, time.Until(startTime.Add(offset))) {
+			break
+		}
+
+		// Wait for a free slot if the cap of requests in flight is reached
+		if inflight != nil {
+			select {
+			case inflight <- struct{}{}:
+			default:
+				delayed++
+				select {
+				case inflight <- struct{}{}:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		wg.Add(1)
+		go func(req provider.AnyParams) {
+			defer wg.Done()
+			result := e.executeRequest(reqCtx, req)
+			result.Stage = stage
+			if inflight != nil {
+				<-inflight
+			}
+			results.add(result)
+		}(dataset[i%len(dataset)])
+	}
+
+	wg.Wait()
+	return results.list(), delayed
+}
+
+// arrivalDistributionName returns the name of the distribution, poisson by default
+func arrivalDistributionName(distribution string) string {
+	if distribution == "" {
+		return ArrivalPoisson
+	}
+	return distribution
+}
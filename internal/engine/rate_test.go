@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+// sleepProvider answers every request after a fixed delay and records the peak of requests in flight
+type sleepProvider struct {
+	delay    time.Duration
+	inflight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (p *sleepProvider) Name() string {
+	return "sleep"
+}
+
+func (p *sleepProvider) SendRequest(ctx context.Context, priorityParams, anyParam provider.AnyParams, headers map[string]string) (*provider.Response, *provider.Error) {
+	n := p.inflight.Add(1)
+	defer p.inflight.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(p.delay):
+		return &provider.Response{Latency: p.delay}, nil
+	case <-ctx.Done():
+		return nil, provider.NewError(0, ctx.Err())
+	}
+}
+
+func (p *sleepProvider) SupportsStreaming() bool {
+	return false
+}
+
+func TestArrivalInterval(t *testing.T) {
+	next, err := arrivalInterval(ArrivalConstant, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 250*time.Millisecond, next())
+
+	next, err = arrivalInterval("", 1000)
+	assert.NoError(t, err)
+	var total time.Duration
+	for i := 0; i < 10000; i++ {
+		total += next()
+	}
+	assert.InDelta(t, float64(time.Millisecond), float64(total/10000), float64(100*time.Microsecond))
+
+	_, err = arrivalInterval(ArrivalPoisson, 0)
+	assert.Error(t, err)
+	_, err = arrivalInterval("uniform", 1)
+	assert.Error(t, err)
+}
+
+func TestRunRate_OpenLoop(t *testing.T) {
+	// Requests take 10 times longer than the inter-arrival time, a closed loop of one worker would take 2s
+	prov := &sleepProvider{delay: 100 * time.Millisecond}
+	cfg := &config.Config{Test: config.TestConfig{
+		RequestRate:         100,
+		ArrivalDistribution: ArrivalConstant,
+		MaxRequests:         20,
+	}}
+
+	start := time.Now()
+	results, err := NewEngine(cfg, prov).RunRate(context.Background(), []provider.AnyParams{{}})
+	elapsed := time.Since(start)
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 20)
+	assert.Less(t, elapsed, time.Second)
+	assert.Greater(t, prov.peak.Load(), int32(5))
+	for _, r := range results {
+		assert.True(t, r.Success)
+	}
+}
+
+func TestRunRate_MaxInflight(t *testing.T) {
+	prov := &sleepProvider{delay: 50 * time.Millisecond}
+	cfg := &config.Config{Test: config.TestConfig{
+		RequestRate:         200,
+		ArrivalDistribution: ArrivalConstant,
+		MaxInflight:         2,
+		MaxRequests:         10,
+	}}
+
+	results, err := NewEngine(cfg, prov).RunRate(context.Background(), []provider.AnyParams{{}, {}})
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 10)
+	assert.Equal(t, int32(2), prov.peak.Load())
+}
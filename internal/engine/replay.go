@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/qlog"
+)
+
+var replayLog = qlog.GetRLog("engine.replay")
+
+// TraceRequest is a request of a trace with its recorded time
+type TraceRequest struct {
+	Offset time.Duration      `json:"offset"` // time of the request from the start of the trace
+	Params provider.AnyParams `json:"params"`
+}
+
+// replaySpeed returns the time factor of a replay, 1 by default
+func replaySpeed(speed float64) (float64, error) {
+	if speed < 0 {
+		return 0, fmt.Errorf("replay speed must be positive, got %v", speed)
+	}
+	if speed == 0 {
+		return 1, nil
+	}
+	return speed, nil
+}
+
+// TraceRate returns the mean request rate of a trace sorted by offset, replayed at a speed
+func TraceRate(trace []TraceRequest, speed float64) float64 {
+	speed, err := replaySpeed(speed)
+	if err != nil || len(trace) < 2 {
+		return 0
+	}
+	span := trace[len(trace)-1].Offset - trace[0].Offset
+	if span <= 0 {
+		return 0
+	}
+	return float64(len(trace)-1) / span.Seconds() * speed
+}
+
+// RunReplay replays a trace sorted by offset: each request is dispatched at its offset divided by the replay
+// speed, without waiting for the earlier ones to finish, so that the bursts and lulls of the recorded traffic
+// are reproduced. At most max_inflight requests are in flight, later requests wait for a free slot.
+// The replay stops after the last request of the trace, or once ctx is done.
+func (e *Engine) RunReplay(ctx context.Context, trace []TraceRequest) ([]*Result, error) {
+	if len(trace) == 0 {
+		return nil, fmt.Errorf("trace is empty")
+	}
+	speed, err := replaySpeed(e.config.Test.Replay.Speed)
+	if err != nil {
+		return nil, err
+	}
+
+	dataset := make([]provider.AnyParams, len(trace))
+	for i, req := range trace {
+		dataset[i] = req.Params
+	}
+
+	maxInflight := e.config.Test.MaxInflight
+	replayLog.Infof("Starting replay of %d requests over %v at speed %gx, max in flight %d...",
+		len(trace), time.Duration(float64(trace[len(trace)-1].Offset)/speed).Round(time.Millisecond), speed, maxInflight)
+
+	results, delayed := e.runOpenLoop(ctx, dataset, maxInflight, func(i int, elapsed time.Duration) (time.Duration, string, bool) {
+		if i >= len(trace) {
+			return 0, "", false
+		}
+		return time.Duration(float64(trace[i].Offset) / speed), "", true
+	})
+
+	if delayed > 0 {
+		replayLog.Warnf("%d requests were delayed by max_inflight %d, they were sent later than recorded", delayed, maxInflight)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReplay(t *testing.T) {
+	prov := &sleepProvider{delay: 10 * time.Millisecond}
+	cfg := &config.Config{Test: config.TestConfig{Replay: config.ReplayConfig{Speed: 2}}}
+	trace := []TraceRequest{
+		{Offset: 0, Params: provider.AnyParams{}},
+		{Offset: 100 * time.Millisecond, Params: provider.AnyParams{}},
+		{Offset: 100 * time.Millisecond, Params: provider.AnyParams{}},
+		{Offset: 400 * time.Millisecond, Params: provider.AnyParams{}},
+	}
+
+	results, err := NewEngine(cfg, prov).RunReplay(context.Background(), trace)
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+
+	// The requests are sent at their offsets divided by the speed
+	slices.SortFunc(results, func(a, b *Result) int {
+		return a.StartTime.Compare(b.StartTime)
+	})
+	start := results[0].StartTime
+	for i, want := range []time.Duration{0, 50 * time.Millisecond, 50 * time.Millisecond, 200 * time.Millisecond} {
+		assert.InDelta(t, float64(want), float64(results[i].StartTime.Sub(start)), float64(20*time.Millisecond), i)
+	}
+	assert.Equal(t, int32(2), prov.peak.Load()) // the burst of two requests
+	assert.InDelta(t, 15.0, TraceRate(trace, 2), 0.001)
+
+	cfg.Test.Replay.Speed = -1
+	_, err = NewEngine(cfg, prov).RunReplay(context.Background(), trace)
+	assert.Error(t, err)
+}
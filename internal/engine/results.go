@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"sync"
+)
+
+// ResultSink receives the results of a test as they complete
+type ResultSink interface {
+	AddResult(result *Result)
+}
+
+// SetResultSink streams the results of the tests to sink as they complete, one call at a time. The Run methods
+// then return no results, so that the memory of a long test does not grow with its requests.
+func (e *Engine) SetResultSink(sink ResultSink) {
+	e.sink = sink
+}
+
+// resultList gathers the results of a test run, or passes them on to the sink of the engine
+type resultList struct {
+	mu      sync.Mutex
+	sink    ResultSink
+	results []*Result
+	pending map[int]*Result // results of addAt waiting for the earlier ones
+	next    int             // index of the next result of addAt
+}
+
+// newResultList returns the result list of a test run
+func (e *Engine) newResultList() *resultList {
+	return &resultList{sink: e.sink, pending: make(map[int]*Result)}
+}
+
+// add adds a result as it completes
+func (l *resultList) add(result *Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.push(result)
+}
+
+// addAt adds the i-th result of a run whose results keep their order, e.g. the cases of a batch.
+// A result is held back until the earlier ones are added, every index must be added once.
+func (l *resultList) addAt(i int, result *Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending[i] = result
+	for {
+		next, ok := l.pending[l.next]
+		if !ok {
+			return
+		}
+		delete(l.pending, l.next)
+		l.next++
+		l.push(next)
+	}
+}
+
+func (l *resultList) push(result *Result) {
+	if l.sink != nil {
+		l.sink.AddResult(result)
+	} else {
+		l.results = append(l.results, result)
+	}
+}
+
+// list returns the results, none if they were passed on to the sink
+func (l *resultList) list() []*Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.results
+}
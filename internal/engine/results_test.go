@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceSink gathers the results streamed to it
+type sliceSink []*Result
+
+func (s *sliceSink) AddResult(result *Result) {
+	*s = append(*s, result)
+}
+
+func TestResultList_AddAt(t *testing.T) {
+	var sink sliceSink
+	results := &resultList{sink: &sink, pending: make(map[int]*Result)}
+
+	// A result is held back until the earlier ones are added
+	r := []*Result{{Turn: 0}, {Turn: 1}, {Turn: 2}}
+	results.addAt(2, r[2])
+	results.addAt(1, r[1])
+	assert.Empty(t, sink)
+	results.addAt(0, r[0])
+	assert.Equal(t, sliceSink(r), sink)
+	assert.Empty(t, results.list())
+}
+
+func TestRunStress_ResultSink(t *testing.T) {
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 4, RequestsPerConcurrency: 25}}
+	testEngine := NewEngine(cfg, &sleepProvider{delay: time.Millisecond})
+	var sink sliceSink
+	testEngine.SetResultSink(&sink)
+
+	// The results are streamed to the sink, none is dropped
+	results, err := testEngine.RunStress(context.Background(), []provider.AnyParams{{}})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Len(t, sink, 100)
+
+	// The cases of a batch keep their order
+	sink = nil
+	dataset := make([]provider.AnyParams, 20)
+	for i := range dataset {
+		dataset[i] = provider.AnyParams{TagsKey: map[string]string{"i": string(rune('a' + i))}}
+	}
+	_, err = testEngine.RunBatch(context.Background(), dataset)
+	assert.NoError(t, err)
+	assert.Len(t, sink, len(dataset))
+	for i, result := range sink {
+		assert.Equal(t, string(rune('a'+i)), result.Tags["i"])
+	}
+}
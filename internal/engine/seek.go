@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/qlog"
+)
+
+var seekLog = qlog.GetRLog("engine.seek")
+
+// Defaults of the goal-seeking search
+const (
+	defaultSeekStart     = 1
+	defaultSeekMax       = 1024
+	defaultSeekPrecision = 1
+)
+
+// SeekConcurrency searches the highest concurrency at which probe passes: the concurrency doubles from start
+// until a probe fails or max is reached, then a binary search between the last passing and the first failing
+// level stops once their gap is at most precision. Each level is probed once, it returns 0 if no level passes.
+func SeekConcurrency(cfg config.SeekConfig, probe func(concurrency int) (bool, error)) (int, error) {
+	start, max, precision := cfg.Start, cfg.Max, cfg.Precision
+	if start <= 0 {
+		start = defaultSeekStart
+	}
+	if max <= 0 {
+		max = defaultSeekMax
+	}
+	if precision <= 0 {
+		precision = defaultSeekPrecision
+	}
+	if start > max {
+		return 0, fmt.Errorf("seek start %d is greater than max %d", start, max)
+	}
+
+	// pass is the highest passing level, fail the lowest failing one (0 if none)
+	pass, fail := 0, 0
+
+	// Exponential growth
+	for concurrency := start; ; concurrency *= 2 {
+		if concurrency > max {
+			concurrency = max
+		}
+		ok, err := probe(concurrency)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			fail = concurrency
+			break
+		}
+		pass = concurrency
+		if concurrency == max {
+			seekLog.Infof("SLOs hold up to the max concurrency %d", max)
+			return pass, nil
+		}
+	}
+
+	// Binary search
+	for fail-pass > precision {
+		concurrency := (pass + fail) / 2
+		if concurrency == 0 {
+			break
+		}
+		ok, err := probe(concurrency)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			pass = concurrency
+		} else {
+			fail = concurrency
+		}
+	}
+
+	return pass, nil
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekConcurrency(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      config.SeekConfig
+		capacity int // highest passing concurrency
+		want     int
+		probes   []int
+	}{
+		{"exponential then binary", config.SeekConfig{}, 45, 45, []int{1, 2, 4, 8, 16, 32, 64, 48, 40, 44, 46, 45}},
+		{"precision", config.SeekConfig{Precision: 8}, 45, 40, []int{1, 2, 4, 8, 16, 32, 64, 48, 40}},
+		{"capped by max", config.SeekConfig{Start: 4, Max: 20}, 100, 20, []int{4, 8, 16, 20}},
+		{"start fails", config.SeekConfig{Start: 4}, 2, 2, []int{4, 2, 3}},
+		{"nothing passes", config.SeekConfig{}, 0, 0, []int{1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var probes []int
+			got, err := SeekConcurrency(tc.cfg, func(concurrency int) (bool, error) {
+				probes = append(probes, concurrency)
+				return concurrency <= tc.capacity, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.probes, probes)
+		})
+	}
+}
+
+func TestSeekConcurrency_Errors(t *testing.T) {
+	_, err := SeekConcurrency(config.SeekConfig{Start: 8, Max: 4}, func(int) (bool, error) { return true, nil })
+	assert.Error(t, err)
+
+	_, err = SeekConcurrency(config.SeekConfig{}, func(int) (bool, error) { return false, errors.New("probe failed") })
+	assert.EqualError(t, err, "probe failed")
+}
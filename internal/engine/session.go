@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/qlog"
+)
+
+var sessionLog = qlog.GetRLog("engine.session")
+
+// DatasetSessions is the dataset type of conversation scripts, one session per line
+const DatasetSessions = "sessions"
+
+// Keys of a session dataset entry, the other keys are request params shared by all the turns
+const (
+	SessionIDKey    = "session_id" // optional id of the session, defaults to session-<line>
+	SessionTurns    = "turns"      // user turns, either a string or a message with an optional think_time
+	ThinkTimeKey    = "think_time" // think time before a turn, a duration string (e.g. "2s") or seconds
+	sessionMessages = "messages"   // messages sent before the first turn, e.g. a system prompt
+)
+
+// session is the conversation script of a session dataset entry
+type session struct {
+	id      string
+	params  provider.AnyParams // request params shared by the turns, without the messages
+	history []any              // messages sent before the first turn
+	turns   []sessionTurn
+}
+
+// sessionTurn is a user message of a session
+type sessionTurn struct {
+	message   map[string]any
+	thinkTime time.Duration // negative if the default think time applies
+}
+
+// parseSessions parses the conversation scripts of a session dataset
+func parseSessions(dataset []provider.AnyParams) ([]*session, error) {
+	sessions := make([]*session, 0, len(dataset))
+	for i, entry := range dataset {
+		s, err := parseSession(i, entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session %d: %w", i+1, err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// parseSession parses the i-th entry of a session dataset
+func parseSession(i int, entry provider.AnyParams) (*session, error) {
+	s := &session{
+		id:     fmt.Sprintf("session-%d", i+1),
+		params: make(provider.AnyParams, len(entry)),
+	}
+	for k, v := range entry {
+		switch k {
+		case SessionIDKey:
+			s.id = fmt.Sprint(v)
+		case SessionTurns:
+		case sessionMessages:
+			history, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s must be an array of messages", sessionMessages)
+			}
+			s.history = history
+		default:
+			s.params[k] = v
+		}
+	}
+
+	turns, ok := entry[SessionTurns].([]any)
+	if !ok || len(turns) == 0 {
+		return nil, fmt.Errorf("%s must be a non-empty array", SessionTurns)
+	}
+	for n, t := range turns {
+		turn := sessionTurn{thinkTime: -1}
+		switch v := t.(type) {
+		case string:
+			turn.message = map[string]any{"role": "user", "content": v}
+		case map[string]any:
+			turn.message = maps.Clone(v)
+			if raw, ok := turn.message[ThinkTimeKey]; ok {
+				d, err := parseThinkTime(raw)
+				if err != nil {
+					return nil, fmt.Errorf("turn %d: %w", n+1, err)
+				}
+				turn.thinkTime = d
+				delete(turn.message, ThinkTimeKey)
+			}
+			if _, ok := turn.message["role"]; !ok {
+				turn.message["role"] = "user"
+			}
+		default:
+			return nil, fmt.Errorf("turn %d must be a string or a message", n+1)
+		}
+		s.turns = append(s.turns, turn)
+	}
+	return s, nil
+}
+
+// parseThinkTime parses a think time given as a duration string or as seconds
+func parseThinkTime(v any) (time.Duration, error) {
+	switch t := v.(type) {
+	case string:
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", ThinkTimeKey, err)
+		}
+		return d, nil
+	case float64:
+		return time.Duration(t * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("invalid %s: %v", ThinkTimeKey, v)
+	}
+}
+
+// RunSessions runs a session test: each of the concurrency virtual users takes the next conversation script
+// and sends its turns one after the other, each turn carrying the whole conversation so far including the
+// real assistant replies, with the think time in between. The sessions are run until the test duration,
+// or once each without duration. A failed turn ends its session.
+func (e *Engine) RunSessions(ctx context.Context, dataset []provider.AnyParams) ([]*Result, error) {
+	if len(dataset) == 0 {
+		return nil, fmt.Errorf("dataset is empty")
+	}
+	sessions, err := parseSessions(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	testCfg := e.config.Test
+	sessionLog.Infof("Starting session testing of %d sessions for %v with %d virtual users, think time %v...",
+		len(sessions), testCfg.Duration, e.getConcurrency(), testCfg.ThinkTime)
+
+	reqCtx, cancel := e.requestContext(ctx)
+	defer cancel()
+
+	var (
+		results = e.newResultList()
+		next    atomic.Int64
+	)
+
+	startTime := time.Now()
+	running := func() bool {
+		return ctx.Err() == nil && (testCfg.Duration <= 0 || time.Since(startTime) < testCfg.Duration)
+	}
+
+	wg := e.startWorkers(e.getConcurrency(), func(workerID int, wg *sync.WaitGroup) {
+		for running() {
+			i := int(next.Add(1) - 1)
+			if testCfg.Duration <= 0 && i >= len(sessions) {
+				return
+			}
+
+			e.runSession(ctx, reqCtx, sessions[i%len(sessions)], running, results.add)
+		}
+	})
+	wg.Wait()
+
+	return results.list(), nil
+}
+
+// runSession sends the turns of a session until it ends, fails or running reports the end of the test
+func (e *Engine) runSession(ctx, reqCtx context.Context, s *session, running func() bool, collect func(*Result)) {
+	messages := make([]any, len(s.history), len(s.history)+2*len(s.turns))
+	copy(messages, s.history)
+
+	for n, turn := range s.turns {
+		if n > 0 {
+			thinkTime := e.config.Test.ThinkTime
+			if turn.thinkTime >= 0 {
+				thinkTime = turn.thinkTime
+			}
+			if !sleepContext(ctx, thinkTime) || !running() {
+				return
+			}
+		}
+
+		messages = append(messages, turn.message)
+		req := maps.Clone(s.params)
+		req["messages"] = messages
+
+		result := e.executeRequest(reqCtx, req)
+		result.Session = s.id
+		result.Turn = n + 1
+		collect(result)
+
+		if !result.Success {
+			if !result.Cancelled {
+				sessionLog.Warnf("Session %s ended at turn %d: %s", s.id, n+1, result.Error)
+			}
+			return
+		}
+
+		// Carry the real reply over to the next turn
+		var reply any = ""
+		if resp := result.RefResponse; len(resp.Choices) > 0 && resp.Choices[0].Message.Content != nil {
+			reply = resp.Choices[0].Message.Content
+		}
+		messages = append(messages, map[string]any{"role": "assistant", "content": reply})
+	}
+}
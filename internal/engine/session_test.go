@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoProvider replies to the last message and records the params and the messages of each request
+type echoProvider struct {
+	mu       sync.Mutex
+	params   []provider.AnyParams
+	requests [][]any
+	failOn   string // content of a user message which fails the request
+	usage    provider.Usage
+	chunks   int // streamed chunks of the replies
+}
+
+func (p *echoProvider) Name() string {
+	return "echo"
+}
+
+func (p *echoProvider) SendRequest(ctx context.Context, priorityParams, anyParam provider.AnyParams, headers map[string]string) (*provider.Response, *provider.Error) {
+	messages := anyParam["messages"].([]any)
+	p.mu.Lock()
+	p.params = append(p.params, anyParam)
+	p.requests = append(p.requests, append([]any(nil), messages...))
+	p.mu.Unlock()
+
+	last := messages[len(messages)-1].(map[string]any)["content"]
+	if last == p.failOn {
+		return nil, provider.NewError(500, fmt.Errorf("failed on %v", last))
+	}
+	return &provider.Response{
+		Choices: []provider.Choice{
+			{Message: provider.Message{Role: "assistant", Content: fmt.Sprintf("re: %v", last)}},
+		},
+		Usage:        p.usage,
+		StreamChunks: p.chunks,
+	}, nil
+}
+
+func (p *echoProvider) SupportsStreaming() bool {
+	return false
+}
+
+func TestParseSession(t *testing.T) {
+	s, err := parseSession(0, provider.AnyParams{
+		"max_tokens": 16.0,
+		"messages":   []any{map[string]any{"role": "system", "content": "Be brief"}},
+		"turns": []any{
+			"Hi",
+			map[string]any{"content": "And then?", "think_time": "2s"},
+			map[string]any{"role": "user", "content": "Bye", "think_time": 0.5},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "session-1", s.id)
+	assert.Equal(t, provider.AnyParams{"max_tokens": 16.0}, s.params)
+	assert.Len(t, s.history, 1)
+	assert.Len(t, s.turns, 3)
+	assert.Equal(t, map[string]any{"role": "user", "content": "Hi"}, s.turns[0].message)
+	assert.Equal(t, time.Duration(-1), s.turns[0].thinkTime)
+	assert.Equal(t, map[string]any{"role": "user", "content": "And then?"}, s.turns[1].message)
+	assert.Equal(t, 2*time.Second, s.turns[1].thinkTime)
+	assert.Equal(t, 500*time.Millisecond, s.turns[2].thinkTime)
+
+	_, err = parseSession(0, provider.AnyParams{"turns": []any{}})
+	assert.Error(t, err)
+	_, err = parseSession(0, provider.AnyParams{"turns": []any{map[string]any{"content": "Hi", "think_time": "soon"}}})
+	assert.Error(t, err)
+}
+
+func TestRunSessions(t *testing.T) {
+	prov := &echoProvider{}
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 1, ThinkTime: 50 * time.Millisecond}}
+
+	start := time.Now()
+	results, err := NewEngine(cfg, prov).RunSessions(context.Background(), []provider.AnyParams{
+		{"session_id": "chat", "turns": []any{"Hi", "How are you?", map[string]any{"content": "Bye", "think_time": "0s"}}},
+	})
+
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Len(t, results, 3)
+	for i, r := range results {
+		assert.True(t, r.Success)
+		assert.Equal(t, "chat", r.Session)
+		assert.Equal(t, i+1, r.Turn)
+	}
+
+	// Each turn carries the real replies to the previous turns
+	assert.Len(t, prov.requests, 3)
+	assert.Equal(t, []any{
+		map[string]any{"role": "user", "content": "Hi"},
+		map[string]any{"role": "assistant", "content": "re: Hi"},
+		map[string]any{"role": "user", "content": "How are you?"},
+		map[string]any{"role": "assistant", "content": "re: How are you?"},
+		map[string]any{"role": "user", "content": "Bye"},
+	}, prov.requests[2])
+}
+
+func TestRunSessions_FailedTurn(t *testing.T) {
+	prov := &echoProvider{failOn: "Boom"}
+	cfg := &config.Config{Test: config.TestConfig{Concurrency: 2}}
+
+	results, err := NewEngine(cfg, prov).RunSessions(context.Background(), []provider.AnyParams{
+		{"turns": []any{"Hi", "Boom", "Never sent"}},
+		{"turns": []any{"Hello", "Again"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	turns := map[string]int{}
+	for _, r := range results {
+		turns[r.Session]++
+		assert.Equal(t, r.Session != "session-1" || r.Turn != 2, r.Success)
+	}
+	assert.Equal(t, map[string]int{"session-1": 2, "session-2": 2}, turns)
+}
@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/qlog"
+)
+
+var stagesLog = qlog.GetRLog("engine.stages")
+
+// Ramps of a stage
+const (
+	RampLinear = "linear" // the target moves linearly from the previous target over the stage
+	RampStep   = "step"   // the target jumps to the stage target at the start of the stage
+)
+
+// stageControlInterval is how often the worker count of a closed-loop profile is adjusted,
+// and how often an open-loop profile at a zero rate checks the rate again
+const stageControlInterval = 100 * time.Millisecond
+
+// stagePlan is a validated staged load profile
+type stagePlan struct {
+	stages   []config.StageConfig
+	starts   []time.Duration // offset of the start of each stage
+	total    time.Duration
+	openLoop bool // the stages set target rates instead of concurrencies
+}
+
+// newStagePlan validates the stages and fills in the default names
+func newStagePlan(stages []config.StageConfig) (*stagePlan, error) {
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no stages configured")
+	}
+
+	plan := &stagePlan{
+		stages: make([]config.StageConfig, len(stages)),
+		starts: make([]time.Duration, len(stages)),
+	}
+	var hasConcurrency, hasRate bool
+	for i, stage := range stages {
+		stage.Name = StageName(i, stage)
+		if stage.Duration <= 0 {
+			return nil, fmt.Errorf("stage %s: duration must be positive", stage.Name)
+		}
+		if stage.Concurrency < 0 || stage.Rate < 0 {
+			return nil, fmt.Errorf("stage %s: concurrency and rate must not be negative", stage.Name)
+		}
+		switch stage.Ramp {
+		case "", RampLinear, RampStep:
+		default:
+			return nil, fmt.Errorf("stage %s: unsupported ramp: %s, supported ramps: %s, %s", stage.Name, stage.Ramp, RampLinear, RampStep)
+		}
+		hasConcurrency = hasConcurrency || stage.Concurrency > 0
+		hasRate = hasRate || stage.Rate > 0
+
+		plan.stages[i] = stage
+		plan.starts[i] = plan.total
+		plan.total += stage.Duration
+	}
+
+	if hasConcurrency && hasRate {
+		return nil, fmt.Errorf("stages must all set either a target concurrency or a target rate")
+	}
+	if !hasConcurrency && !hasRate {
+		return nil, fmt.Errorf("stages need a target concurrency or a target rate")
+	}
+	plan.openLoop = hasRate
+	return plan, nil
+}
+
+// StageName returns the name of the i-th stage, stage-<i+1> if it has none
+func StageName(i int, stage config.StageConfig) string {
+	if stage.Name == "" {
+		return fmt.Sprintf("stage-%d", i+1)
+	}
+	return stage.Name
+}
+
+// target returns the target concurrency or rate of a stage
+func (p *stagePlan) target(i int) float64 {
+	if i < 0 {
+		return 0
+	}
+	if p.openLoop {
+		return p.stages[i].Rate
+	}
+	return float64(p.stages[i].Concurrency)
+}
+
+// at returns the stage and the target load at an offset from the start, the stage is -1 once the profile is over
+func (p *stagePlan) at(offset time.Duration) (int, float64) {
+	for i, stage := range p.stages {
+		if offset >= p.starts[i]+stage.Duration {
+			continue
+		}
+
+		to := p.target(i)
+		if stage.Ramp == RampStep {
+			return i, to
+		}
+		from := p.target(i - 1)
+		progress := float64(offset-p.starts[i]) / float64(stage.Duration)
+		return i, from + (to-from)*progress
+	}
+	return -1, 0
+}
+
+// RunStages runs the staged load profile of test.stages. A closed-loop profile adds and stops workers
+// as the target concurrency moves, an open-loop profile dispatches requests at the moving target rate.
+// Each result is tagged with the stage it was sent in. The profile is cut short once ctx is done.
+func (e *Engine) RunStages(ctx context.Context, dataset []provider.AnyParams) ([]*Result, error) {
+	if len(dataset) == 0 {
+		return nil, fmt.Errorf("dataset is empty")
+	}
+
+	testCfg := e.config.Test
+	plan, err := newStagePlan(testCfg.Stages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Warmup phase
+	if testCfg.Warmup > 0 {
+		onceWarmup.Do(func() {
+			stagesLog.Infof("Starting warmup for %v...", testCfg.Warmup)
+			err = e.runWarmup(ctx, dataset)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if plan.openLoop {
+		return e.runRateStages(ctx, dataset, plan)
+	}
+	return e.runConcurrencyStages(ctx, dataset, plan), nil
+}
+
+// runConcurrencyStages runs a closed-loop profile, a stopped worker finishes its request in flight
+func (e *Engine) runConcurrencyStages(ctx context.Context, dataset []provider.AnyParams, plan *stagePlan) []*Result {
+	stagesLog.Infof("Starting staged testing of %d stages for %v...", len(plan.stages), plan.total)
+
+	var (
+		wg       sync.WaitGroup
+		results  = e.newResultList()
+		workers  []chan struct{} // stop channel of each running worker
+		reqIndex atomic.Int64
+	)
+
+	reqCtx, cancel := e.requestContext(ctx)
+	defer cancel()
+
+	startTime := time.Now()
+	worker := func(stop chan struct{}) {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			stage, _ := plan.at(time.Since(startTime))
+			if stage < 0 {
+				return
+			}
+
+			// Get a request from dataset (round-robin)
+			req := dataset[int(reqIndex.Add(1)-1)%len(dataset)]
+			result := e.executeRequest(reqCtx, req)
+			result.Stage = plan.stages[stage].Name
+			results.add(result)
+		}
+	}
+
+	ticker := time.NewTicker(stageControlInterval)
+	defer ticker.Stop()
+	current := -1
+	for ctx.Err() == nil {
+		stage, target := plan.at(time.Since(startTime))
+		if stage < 0 {
+			break
+		}
+		if stage != current {
+			current = stage
+			stagesLog.Infof("Stage %s: concurrency %d -> %d over %v", plan.stages[stage].Name,
+				len(workers), plan.stages[stage].Concurrency, plan.stages[stage].Duration)
+		}
+
+		want := int(math.Round(target))
+		for len(workers) < want {
+			stop := make(chan struct{})
+			workers = append(workers, stop)
+			wg.Add(1)
+			go worker(stop)
+		}
+		for len(workers) > want {
+			close(workers[len(workers)-1])
+			workers = workers[:len(workers)-1]
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+	}
+
+	for _, stop := range workers {
+		close(stop)
+	}
+	wg.Wait()
+	return results.list()
+}
+
+// runRateStages runs an open-loop profile
+func (e *Engine) runRateStages(ctx context.Context, dataset []provider.AnyParams, plan *stagePlan) ([]*Result, error) {
+	testCfg := e.config.Test
+	nextInterval, err := newArrivals(testCfg.ArrivalDistribution)
+	if err != nil {
+		return nil, err
+	}
+
+	stagesLog.Infof("Starting open-loop staged testing of %d stages (%s arrivals) for %v, max in flight %d...",
+		len(plan.stages), arrivalDistributionName(testCfg.ArrivalDistribution), plan.total, testCfg.MaxInflight)
+
+	var offset time.Duration
+	current := -1
+	results, delayed := e.runOpenLoop(ctx, dataset, testCfg.MaxInflight, func(i int, elapsed time.Duration) (time.Duration, string, bool) {
+		if i > 0 {
+			stage, rate := plan.at(offset)
+			next := offset + nextInterval(rate)
+			// A gap drawn at the rate of a stage does not reach into the next one,
+			// there the gap is drawn again at the new rate
+			if end := plan.starts[stage] + plan.stages[stage].Duration; next > end && stage+1 < len(plan.stages) {
+				_, rate = plan.at(end)
+				next = end
+				if rate > 0 {
+					next += nextInterval(rate)
+				}
+			}
+			offset = next
+		}
+
+		for {
+			stage, rate := plan.at(offset)
+			if stage < 0 {
+				return 0, "", false
+			}
+			if stage != current {
+				current = stage
+				stagesLog.Infof("Stage %s: rate -> %.2f requests/s over %v", plan.stages[stage].Name,
+					plan.stages[stage].Rate, plan.stages[stage].Duration)
+			}
+			if rate > 0 {
+				return offset, plan.stages[stage].Name, true
+			}
+			// The rate is zero at the start of a ramp from zero, check it again a little later
+			offset += stageControlInterval
+		}
+	})
+
+	if delayed > 0 {
+		stagesLog.Warnf("%d requests were delayed by max_inflight %d, the offered load was not reached", delayed, testCfg.MaxInflight)
+	}
+
+	return results, nil
+}
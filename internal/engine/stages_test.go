@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStagePlan_At(t *testing.T) {
+	plan, err := newStagePlan([]config.StageConfig{
+		{Name: "ramp-up", Duration: 2 * time.Minute, Concurrency: 64},
+		{Name: "plateau", Duration: 10 * time.Minute, Concurrency: 64},
+		{Name: "spike", Duration: 30 * time.Second, Concurrency: 128, Ramp: RampStep},
+		{Duration: time.Minute},
+	})
+	assert.NoError(t, err)
+	assert.False(t, plan.openLoop)
+	assert.Equal(t, "stage-4", plan.stages[3].Name)
+
+	for _, tc := range []struct {
+		offset time.Duration
+		stage  int
+		target float64
+	}{
+		{0, 0, 0},
+		{time.Minute, 0, 32},
+		{5 * time.Minute, 1, 64},
+		{12 * time.Minute, 2, 128},
+		{13 * time.Minute, 3, 64},
+		{14 * time.Minute, -1, 0},
+	} {
+		stage, target := plan.at(tc.offset)
+		assert.Equal(t, tc.stage, stage, tc.offset)
+		assert.InDelta(t, tc.target, target, 0.001, tc.offset)
+	}
+}
+
+func TestNewStagePlan_Invalid(t *testing.T) {
+	for _, stages := range [][]config.StageConfig{
+		nil,
+		{{Concurrency: 1}},
+		{{Duration: time.Second}},
+		{{Duration: time.Second, Concurrency: 1}, {Duration: time.Second, Rate: 1}},
+		{{Duration: time.Second, Concurrency: 1, Ramp: "exponential"}},
+	} {
+		_, err := newStagePlan(stages)
+		assert.Error(t, err, stages)
+	}
+}
+
+func TestRunStages_Concurrency(t *testing.T) {
+	prov := &sleepProvider{delay: 20 * time.Millisecond}
+	cfg := &config.Config{Test: config.TestConfig{Stages: []config.StageConfig{
+		{Name: "low", Duration: 300 * time.Millisecond, Concurrency: 1, Ramp: RampStep},
+		{Name: "high", Duration: 300 * time.Millisecond, Concurrency: 4, Ramp: RampStep},
+	}}}
+
+	results, err := NewEngine(cfg, prov).RunStages(context.Background(), []provider.AnyParams{{}})
+
+	assert.NoError(t, err)
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Stage]++
+	}
+	assert.Len(t, counts, 2)
+	assert.Greater(t, counts["high"], 2*counts["low"])
+	assert.Equal(t, int32(4), prov.peak.Load())
+}
+
+func TestRunStages_Rate(t *testing.T) {
+	prov := &sleepProvider{delay: 10 * time.Millisecond}
+	cfg := &config.Config{Test: config.TestConfig{
+		ArrivalDistribution: ArrivalConstant,
+		Stages: []config.StageConfig{
+			{Name: "low", Duration: 200 * time.Millisecond, Rate: 20, Ramp: RampStep},
+			{Name: "high", Duration: 200 * time.Millisecond, Rate: 100, Ramp: RampStep},
+		},
+	}}
+
+	results, err := NewEngine(cfg, prov).RunStages(context.Background(), []provider.AnyParams{{}})
+
+	assert.NoError(t, err)
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Stage]++
+	}
+	assert.InDelta(t, 4, counts["low"], 1)
+	assert.InDelta(t, 20, counts["high"], 1)
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -12,14 +13,15 @@ var stressLog = qlog.GetRLog("engine.stress")
 
 var onceWarmup sync.Once
 
-func (e *Engine) RunStress(dataset []provider.AnyParams) ([]*Result, error) {
+// RunStress runs a stress test, once ctx is done the workers stop sending new requests
+func (e *Engine) RunStress(ctx context.Context, dataset []provider.AnyParams) ([]*Result, error) {
 	// Warmup phase
 	var err error
 
 	if e.config.Test.Warmup > 0 {
 		onceWarmup.Do(func() {
 			stressLog.Infof("Starting warmup for %v...", e.config.Test.Warmup)
-			err = e.runWarmup(dataset)
+			err = e.runWarmup(ctx, dataset)
 		})
 		if err != nil {
 			return nil, err
@@ -30,13 +32,13 @@ func (e *Engine) RunStress(dataset []provider.AnyParams) ([]*Result, error) {
 	stressLog.Infof("Starting stress testing for %v or %d requests/concurrency with concurrency %d...",
 		e.config.Test.Duration, e.config.Test.RequestsPerConcurrency, e.config.Test.Concurrency)
 
-	// Create channel for results
-	resultsChan := make(chan *Result, 1000) // Buffered channel to prevent blocking
-	var results []*Result
-	resultsMutex := sync.Mutex{}
+	results := e.newResultList()
 
 	testDuration := e.config.Test.Duration
 
+	reqCtx, cancel := e.requestContext(ctx)
+	defer cancel()
+
 	// Start worker goroutines
 	concurrency := e.getConcurrency()
 	wg := e.startWorkers(concurrency, func(workerID int, wg *sync.WaitGroup) {
@@ -47,32 +49,21 @@ func (e *Engine) RunStress(dataset []provider.AnyParams) ([]*Result, error) {
 		maxRequests := e.config.Test.RequestsPerConcurrency
 
 		for (testDuration <= 0 || time.Since(workerStartTime) < testDuration) &&
-			(maxRequests <= 0 || requestsCompleted < maxRequests) {
+			(maxRequests <= 0 || requestsCompleted < maxRequests) && ctx.Err() == nil {
 
 			// Get a request from dataset (round-robin)
 			req := dataset[reqIndex%len(dataset)]
 			reqIndex++
 
-			e.executeWorkerJob(req, resultsChan)
+			results.add(e.executeRequest(reqCtx, req))
 			requestsCompleted++
 
 			// Small delay to prevent overwhelming the system
-			time.Sleep(10 * time.Millisecond)
+			sleepContext(ctx, 10*time.Millisecond)
 		}
 	})
 
-	// Close results channel when all workers are done
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	// Collect results from channel
-	for result := range resultsChan {
-		resultsMutex.Lock()
-		results = append(results, result)
-		resultsMutex.Unlock()
-	}
+	wg.Wait()
 
-	return results, nil
+	return results.list(), nil
 }
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+)
+
+// Sources of the token counts of a result
+const (
+	TokenSourceUsage     = "usage"     // usage reported by the server
+	TokenSourceTokenizer = "tokenizer" // counted by the offline token counter
+	TokenSourceChunks    = "chunks"    // response tokens approximated by the streamed chunks, no request tokens
+)
+
+// countTokens sets the request and response tokens of a result and their source. The usage reported by the
+// server is preferred, without usage the client estimates are used: the token counter if set, the number of
+// streamed chunks otherwise. The estimates of the token counter are kept on the result to validate the usage,
+// the chunks are too rough for it, e.g. with several tokens per chunk.
+func (e *Engine) countTokens(result *Result, reqCase provider.AnyParams, resp *provider.Response) {
+	result.RequestTokens = resp.Usage.PromptTokens
+	result.ResponseTokens = resp.Usage.CompletionTokens
+	if resp.Embeddings > 0 {
+		// Embeddings have no response tokens to estimate
+		result.TokenSource = TokenSourceUsage
+		return
+	}
+
+	if e.tokenCounter != nil {
+		result.EstimatedRequestTokens = e.tokenCounter.CountTokens(promptText(e.config.Model.ParamsTemplate, reqCase))
+		result.EstimatedResponseTokens = e.tokenCounter.CountTokens(responseText(resp))
+	}
+
+	switch {
+	case resp.Usage.PromptTokens > 0 || resp.Usage.CompletionTokens > 0:
+		result.TokenSource = TokenSourceUsage
+	case e.tokenCounter != nil:
+		result.RequestTokens = result.EstimatedRequestTokens
+		result.ResponseTokens = result.EstimatedResponseTokens
+		result.TokenSource = TokenSourceTokenizer
+	case resp.StreamChunks > 0:
+		result.ResponseTokens = resp.StreamChunks
+		result.TokenSource = TokenSourceChunks
+	}
+}
+
+// promptKeys are the request params holding the prompt: the messages of the chat APIs,
+// the prompt of the completions API and the input of the responses API
+var promptKeys = []string{"messages", "prompt", "input"}
+
+// promptText returns the text of the prompt of a request, the request params take precedence over
+// the params template. The chat template of the messages is not taken into account.
+func promptText(template, reqCase provider.AnyParams) string {
+	var sb strings.Builder
+	for _, key := range promptKeys {
+		v, ok := reqCase[key]
+		if !ok {
+			v = template[key]
+		}
+		appendText(&sb, v)
+	}
+	return sb.String()
+}
+
+// appendText appends the text of a prompt value: a string, a message, a content part or an array of them
+func appendText(sb *strings.Builder, v any) {
+	switch t := v.(type) {
+	case string:
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(t)
+	case []any:
+		for _, item := range t {
+			appendText(sb, item)
+		}
+	case []provider.Message:
+		for _, msg := range t {
+			appendText(sb, msg.Content)
+		}
+	case provider.Message:
+		appendText(sb, t.Content)
+	case map[string]any:
+		// A message has a content, a content part of type text has a text
+		if content, ok := t["content"]; ok {
+			appendText(sb, content)
+		} else if text, ok := t["text"]; ok {
+			appendText(sb, text)
+		}
+	}
+}
+
+// responseText returns the text of the choices of a response
+func responseText(resp *provider.Response) string {
+	var sb strings.Builder
+	for _, choice := range resp.Choices {
+		appendText(&sb, choice.Message.Content)
+	}
+	return sb.String()
+}
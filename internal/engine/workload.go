@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"math"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/FortuneW/qlog"
+)
+
+var workloadLog = qlog.GetRLog("engine.workload")
+
+// SourceTag is the tag of the entries of a mixed workload with the name of their source
+const SourceTag = "source"
+
+// maxMixSize bounds the size of a mix, unless the sources hold more entries: the size for every entry to appear
+// grows with the ratio of the weights, e.g. a million requests for a source of 1000 entries weighted 1 to 1000
+const maxMixSize = 1 << 16
+
+// WorkloadSource is a dataset of a mixed workload with its share of the requests
+type WorkloadSource struct {
+	Name    string
+	Weight  float64 // relative share of the requests, must be positive
+	Dataset []provider.AnyParams
+}
+
+// MixWorkload samples the entries of the sources into one dataset according to their weights, each entry
+// tagged with the name of its source. The sources are interleaved by smooth weighted round robin, so that any
+// run of consecutive requests follows the weights and not only the whole dataset, and each source cycles
+// over its entries. The mix is long enough for every entry of every source to appear at least once, up to
+// maxMixSize or the total number of entries of the sources. Its entries repeat the same maps, which must not
+// be modified.
+func MixWorkload(sources []WorkloadSource) ([]provider.AnyParams, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no workload source")
+	}
+
+	var total float64
+	for _, src := range sources {
+		if src.Weight <= 0 || math.IsInf(src.Weight, 0) || math.IsNaN(src.Weight) {
+			return nil, fmt.Errorf("workload source %s: invalid weight %v", src.Name, src.Weight)
+		}
+		if len(src.Dataset) == 0 {
+			return nil, fmt.Errorf("workload source %s: empty dataset", src.Name)
+		}
+		total += src.Weight
+	}
+
+	size, entries := 0.0, 0
+	tagged := make([][]provider.AnyParams, len(sources))
+	for i, src := range sources {
+		size = max(size, math.Ceil(float64(len(src.Dataset))*total/src.Weight))
+		entries += len(src.Dataset)
+		tagged[i] = make([]provider.AnyParams, len(src.Dataset))
+		for j, entry := range src.Dataset {
+			tagged[i][j] = tagSource(entry, src.Name)
+		}
+	}
+
+	limit := max(entries, maxMixSize)
+	if size > float64(limit) {
+		workloadLog.Warnf("The mix is limited to %d requests, some entries of the sources with a small weight are left out", limit)
+		size = float64(limit)
+	}
+
+	mix := make([]provider.AnyParams, 0, int(size))
+	current := make([]float64, len(sources))
+	next := make([]int, len(sources))
+	for len(mix) < cap(mix) {
+		best := 0
+		for i, src := range sources {
+			current[i] += src.Weight
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		mix = append(mix, tagged[best][next[best]%len(tagged[best])])
+		next[best]++
+	}
+	return mix, nil
+}
+
+// tagSource returns a copy of a dataset entry tagged with its source, along with its own tags
+func tagSource(entry provider.AnyParams, name string) provider.AnyParams {
+	_, tags := splitTags(entry)
+	tags = maps.Clone(tags)
+	if tags == nil {
+		tags = make(map[string]string, 1)
+	}
+	tags[SourceTag] = name
+
+	tagged := maps.Clone(entry)
+	tagged[TagsKey] = tags
+	return tagged
+}
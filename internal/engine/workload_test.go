@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMixWorkload(t *testing.T) {
+	chat := []provider.AnyParams{{"prompt": "c0"}, {"prompt": "c1"}}
+	rag := []provider.AnyParams{{"prompt": "r0", TagsKey: map[string]any{"prefix": "shared"}}}
+	mix, err := MixWorkload([]WorkloadSource{
+		{Name: "chat", Weight: 3, Dataset: chat},
+		{Name: "rag", Weight: 1, Dataset: rag},
+	})
+	assert.NoError(t, err)
+
+	// Every entry appears, the sources are interleaved in proportion to the weights
+	var prompts []any
+	for _, entry := range mix {
+		prompts = append(prompts, entry["prompt"])
+	}
+	assert.Equal(t, []any{"c0", "c1", "r0", "c0"}, prompts)
+
+	_, tags := splitTags(mix[2])
+	assert.Equal(t, map[string]string{"prefix": "shared", SourceTag: "rag"}, tags)
+	_, tags = splitTags(mix[0])
+	assert.Equal(t, map[string]string{SourceTag: "chat"}, tags)
+	assert.NotContains(t, chat[0], TagsKey) // the sources are left untouched
+
+	// Any window of the mix follows the weights
+	mix, err = MixWorkload([]WorkloadSource{
+		{Name: "a", Weight: 0.6, Dataset: chat},
+		{Name: "b", Weight: 0.3, Dataset: chat},
+		{Name: "c", Weight: 0.1, Dataset: chat},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, mix, 20)
+	counts := make(map[string]int)
+	for _, entry := range mix[:10] {
+		_, tags := splitTags(entry)
+		counts[tags[SourceTag]]++
+	}
+	assert.Equal(t, map[string]int{"a": 6, "b": 3, "c": 1}, counts)
+
+	// Skewed weights do not blow the size of the mix up
+	light := make([]provider.AnyParams, 10000)
+	for i := range light {
+		light[i] = provider.AnyParams{"prompt": i}
+	}
+	mix, err = MixWorkload([]WorkloadSource{
+		{Name: "heavy", Weight: 1000, Dataset: chat},
+		{Name: "light", Weight: 1, Dataset: light},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, mix, maxMixSize)
+
+	_, err = MixWorkload([]WorkloadSource{{Name: "a", Weight: 0, Dataset: chat}})
+	assert.Error(t, err)
+	_, err = MixWorkload([]WorkloadSource{{Name: "a", Weight: 1}})
+	assert.Error(t, err)
+}
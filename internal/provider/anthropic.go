@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+const (
+	anthropicDefaultEndpoint  = "https://api.anthropic.com/v1/messages"
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 1024
+)
+
+// anthropicUnsupportedParams are OpenAI only request params, which are rejected by the Messages API
+var anthropicUnsupportedParams = []string{
+	"stream_options", "extra_body", "n", "frequency_penalty", "presence_penalty",
+	"logprobs", "top_logprobs", "response_format", "seed", "user",
+	"ignore_eos", "truncate_prompt_tokens", "max_completion_tokens",
+}
+
+func init() {
+	Register(Registration{
+		Name:            "anthropic",
+		Description:     "Anthropic native Messages API",
+		DefaultEndpoint: anthropicDefaultEndpoint,
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			return NewAnthropicProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+		},
+	})
+}
+
+// AnthropicProvider implements the Provider interface for the Anthropic Messages API
+type AnthropicProvider struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+// anthropicUsage represents token usage information of the Messages API
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicMessage represents a non-streaming response of the Messages API
+type anthropicMessage struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Role    string `json:"role"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      anthropicUsage `json:"usage"`
+}
+
+// anthropicEvent represents a typed server-sent event of the Messages API
+type anthropicEvent struct {
+	Type    string           `json:"type"`
+	Message anthropicMessage `json:"message"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+// NewAnthropicProvider creates a new AnthropicProvider
+func NewAnthropicProvider(apiKey, endpoint, model string, timeout time.Duration) *AnthropicProvider {
+	if endpoint == "" {
+		endpoint = anthropicDefaultEndpoint
+		mlog.Infof("Created Anthropic provider [%s] with model [%s]", endpoint, model)
+	}
+
+	return &AnthropicProvider{
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		client:   newHTTPClient(timeout),
+	}
+}
+
+// Name returns the provider name
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+// buildRequest converts the OpenAI style request params into a Messages API request body.
+// System messages are moved to the top-level "system" field and OpenAI only params are dropped.
+func (p *AnthropicProvider) buildRequest(priorityParams, anyParam AnyParams) (data []byte, isStream bool, err error) {
+	body := mergeParams(priorityParams, anyParam)
+
+	messages, err := decodeMessages(body["messages"])
+	if err != nil {
+		return nil, false, err
+	}
+
+	var system []string
+	converted := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "system" || msg.Role == "developer" {
+			system = append(system, messageText(msg.Content))
+			continue
+		}
+		converted = append(converted, msg)
+	}
+	body["messages"] = converted
+	if len(system) > 0 {
+		if _, ok := body["system"]; !ok {
+			body["system"] = strings.Join(system, "\n")
+		}
+	}
+
+	// max_tokens is required by the Messages API
+	if _, ok := body["max_tokens"]; !ok {
+		if v, ok := body["max_completion_tokens"]; ok {
+			body["max_tokens"] = v
+		} else {
+			body["max_tokens"] = anthropicDefaultMaxTokens
+		}
+	}
+
+	if stop, ok := body["stop"]; ok {
+		if s, ok := stop.(string); ok {
+			body["stop_sequences"] = []string{s}
+		} else {
+			body["stop_sequences"] = stop
+		}
+		delete(body, "stop")
+	}
+
+	for _, key := range anthropicUnsupportedParams {
+		delete(body, key)
+	}
+
+	isStream, _ = body["stream"].(bool)
+
+	data, err = json.Marshal(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return data, isStream, nil
+}
+
+// SendRequest sends a request to the Anthropic Messages API
+func (p *AnthropicProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+	// Cook request body
+	data, isStream, err := p.buildRequest(priorityParams, anyParam)
+	if err != nil {
+		return nil, NewError(0, err)
+	}
+
+	// debug request body
+	if debugRequest == "1" {
+		mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Request: %s", string(data))
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("failed to create request: %w", err))
+	}
+
+	// Set headers
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	// Record start time
+	startTime := time.Now()
+
+	// Execute request
+	respHttp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("request failed: %w", err))
+	}
+	defer respHttp.Body.Close()
+
+	// Check status code
+	if respHttp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(respHttp.Body)
+		return nil, NewError(respHttp.StatusCode, fmt.Errorf("%s", string(body)))
+	}
+
+	var resp *Response
+
+	defer func() {
+		// debug response body
+		if debugResponse == "1" {
+			mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Response: %+v", resp)
+		}
+	}()
+
+	if isStream {
+		resp, err = p.handleStreamingResponse(respHttp, startTime)
+	} else {
+		resp, err = p.handleNoStreamResponse(respHttp, startTime)
+	}
+
+	if err == nil {
+		return resp, nil
+	} else {
+		return resp, NewError(503, err)
+	}
+}
+
+// handleNoStreamResponse processes a non-streaming response from the Messages API
+func (p *AnthropicProvider) handleNoStreamResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var msg anthropicMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, block := range msg.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	response := p.toResponse(&msg, content.String(), msg.StopReason, msg.Usage)
+	response.Latency = time.Since(startTime)
+	response.FirstTokenLatency = response.Latency // unstreaming same as e2e latency
+	return response, nil
+}
+
+// handleStreamingResponse processes the typed server-sent events of the Messages API
+func (p *AnthropicProvider) handleStreamingResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	var (
+		msg        anthropicMessage
+		usage      anthropicUsage
+		timer      = newStreamTimer(startTime)
+		content    strings.Builder
+		stopReason string
+	)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		// Event names are repeated in the "type" field of the data payload
+		data, ok := sseData(scanner.Text())
+		if !ok || data == "" {
+			continue
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			mlog.Errorf("Error unmarshaling response: %v", err)
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			msg = event.Message
+			usage = event.Message.Usage
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" {
+				continue
+			}
+			// Record the arrival of the text delta, the first one gives the first token latency
+			timer.token()
+			content.WriteString(event.Delta.Text)
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				stopReason = event.Delta.StopReason
+			}
+			// output_tokens of message_delta is cumulative
+			if event.Usage.OutputTokens > 0 {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+			if event.Usage.InputTokens > 0 {
+				usage.InputTokens = event.Usage.InputTokens
+			}
+		case "error":
+			return nil, fmt.Errorf("%s", data)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading streaming response: %w", err)
+	}
+
+	response := p.toResponse(&msg, content.String(), stopReason, usage)
+	response.Latency = time.Since(startTime)
+	timer.apply(response)
+	return response, nil
+}
+
+// toResponse maps a Messages API result onto the common Response
+func (p *AnthropicProvider) toResponse(msg *anthropicMessage, content, stopReason string, usage anthropicUsage) *Response {
+	role := msg.Role
+	if role == "" {
+		role = "assistant"
+	}
+	return &Response{
+		ID:    msg.ID,
+		Model: msg.Model,
+		Choices: []Choice{
+			{
+				FinishReason: stopReason,
+				Message: Message{
+					Role:    role,
+					Content: content,
+				},
+			},
+		},
+		Usage: Usage{
+			PromptTokens:     usage.InputTokens,
+			CompletionTokens: usage.OutputTokens,
+			TotalTokens:      usage.InputTokens + usage.OutputTokens,
+		},
+	}
+}
+
+// SupportsStreaming returns whether Anthropic supports streaming
+func (p *AnthropicProvider) SupportsStreaming() bool {
+	return true
+}
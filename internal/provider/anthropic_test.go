@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnthropicProvider_BuildRequest(t *testing.T) {
+	provider := NewAnthropicProvider("key", "http://localhost", "claude", time.Second)
+
+	anyParams := AnyParams{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "You are a helpful assistant."},
+			map[string]any{"role": "user", "content": "Hello"},
+		},
+		"stop": "\n\n",
+	}
+	priorityParam := AnyParams{
+		"model":  "claude",
+		"stream": true,
+		"stream_options": map[string]any{
+			"include_usage": true,
+		},
+	}
+
+	data, isStream, err := provider.buildRequest(priorityParam, anyParams)
+	assert.NoError(t, err)
+	assert.True(t, isStream)
+
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal(data, &body))
+	assert.Equal(t, "You are a helpful assistant.", body["system"])
+	assert.Len(t, body["messages"], 1)
+	assert.EqualValues(t, anthropicDefaultMaxTokens, body["max_tokens"])
+	assert.Equal(t, []any{"\n\n"}, body["stop_sequences"])
+	assert.NotContains(t, body, "stream_options")
+	assert.NotContains(t, body, "stop")
+}
+
+func TestAnthropicProvider_Streaming(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","role":"assistant","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("key", server.URL, "claude", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "claude", "stream": true}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "msg_1", resp.ID)
+	assert.Equal(t, "Hello world", resp.Choices[0].Message.Content)
+	assert.Equal(t, "end_turn", resp.Choices[0].FinishReason)
+	assert.Equal(t, 12, resp.Usage.PromptTokens)
+	assert.Equal(t, 5, resp.Usage.CompletionTokens)
+	assert.Equal(t, 17, resp.Usage.TotalTokens)
+	assert.NotZero(t, resp.FirstTokenLatency)
+	assert.GreaterOrEqual(t, resp.Latency, resp.FirstTokenLatency)
+}
+
+func TestAnthropicProvider_NoStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_2","type":"message","role":"assistant","model":"claude",`+
+			`"content":[{"type":"text","text":"Hi there"}],"stop_reason":"max_tokens",`+
+			`"usage":{"input_tokens":3,"output_tokens":2}}`)
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("key", server.URL, "claude", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "claude"}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Hi there", resp.Choices[0].Message.Content)
+	assert.Equal(t, "max_tokens", resp.Choices[0].FinishReason)
+	assert.Equal(t, 3, resp.Usage.PromptTokens)
+	assert.Equal(t, 2, resp.Usage.CompletionTokens)
+	assert.Equal(t, resp.Latency, resp.FirstTokenLatency)
+}
+
+func TestAnthropicProvider_StreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("key", server.URL, "claude", time.Second*10)
+	_, err := provider.SendRequest(context.Background(), AnyParams{"stream": true}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 503, err.Code)
+		assert.Contains(t, err.Type, "overloaded_error")
+	}
+}
@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+const (
+	azureDefaultAPIVersion = "2024-10-21"
+	// azureResponsesAPIVersion is the default api-version of the Responses API, which is only in preview versions
+	azureResponsesAPIVersion = "2025-04-01-preview"
+	// azureTokenRefreshInterval is how long an Azure AD token read from a file or command is reused
+	azureTokenRefreshInterval = 5 * time.Minute
+)
+
+// AzureOptions holds the Azure OpenAI specific settings, which are read from the model.azure config section
+type AzureOptions struct {
+	Deployment     string `json:"deployment"`       // Deployment name, defaults to the model name
+	APIVersion     string `json:"api_version"`      // api-version query param, defaults to azureDefaultAPIVersion
+	APIKind        string `json:"-"`                // chat (default), completions, embeddings or responses, from model.api_kind
+	ADTokenFile    string `json:"ad_token_file"`    // File holding an Azure AD bearer token, used instead of the api key
+	ADTokenCommand string `json:"ad_token_command"` // Command printing an Azure AD bearer token, used instead of the api key
+}
+
+func init() {
+	Register(Registration{
+		Name:            "azure",
+		Description:     "Azure OpenAI deployments, api-key or Azure AD token authentication",
+		DefaultEndpoint: "https://{resource}.openai.azure.com",
+		Schema:          &AzureOptions{},
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			var opts AzureOptions
+			if err := DecodeSection(cfg, "azure", &opts); err != nil {
+				return nil, err
+			}
+			if cfg.Endpoint == "" {
+				return nil, fmt.Errorf("endpoint of the Azure OpenAI resource must be specified")
+			}
+			opts.APIKind = cfg.APIKind
+			return NewAzureProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout, opts), nil
+		},
+	})
+}
+
+// AzureProvider implements the Provider interface for Azure OpenAI deployments
+type AzureProvider struct {
+	oai  *OpenAIProvider
+	opts AzureOptions
+
+	mu           sync.Mutex
+	token        string
+	tokenFetched time.Time
+}
+
+// NewAzureProvider creates a new AzureProvider.
+// The endpoint is either the resource url (e.g. https://my-resource.openai.azure.com),
+// from which the deployment url is built, or the full deployment url.
+func NewAzureProvider(apiKey, endpoint, model string, timeout time.Duration, opts AzureOptions) *AzureProvider {
+	if opts.Deployment == "" {
+		opts.Deployment = model
+	}
+	if opts.APIKind == "" {
+		opts.APIKind = APIKindChat
+	}
+	if opts.APIVersion == "" {
+		opts.APIVersion = azureDefaultAPIVersion
+		if opts.APIKind == APIKindResponses {
+			opts.APIVersion = azureResponsesAPIVersion
+		}
+	}
+
+	deploymentURL := azureDeploymentURL(endpoint, opts)
+	mlog.Infof("Created Azure OpenAI provider [%s] with deployment [%s]", deploymentURL, opts.Deployment)
+
+	p := &AzureProvider{
+		oai:  NewOpenAIProvider(apiKey, deploymentURL, model, timeout),
+		opts: opts,
+	}
+	p.oai.apiKind = opts.APIKind
+	p.oai.setAuth = p.setAuth
+	return p
+}
+
+// azureDeploymentURL builds {endpoint}/openai/deployments/{deployment}/{path}?api-version=..., or
+// {endpoint}/openai/responses?api-version=... for the Responses API, which takes the deployment as the model
+func azureDeploymentURL(endpoint string, opts AzureOptions) string {
+	base := strings.TrimRight(endpoint, "/")
+	if opts.APIKind == APIKindResponses {
+		if !strings.Contains(base, "/openai/") {
+			base += "/openai/responses"
+		}
+	} else if !strings.Contains(base, "/openai/deployments/") {
+		path := "chat/completions"
+		switch opts.APIKind {
+		case APIKindCompletions:
+			path = "completions"
+		case APIKindEmbeddings:
+			path = "embeddings"
+		}
+		base = fmt.Sprintf("%s/openai/deployments/%s/%s", base, url.PathEscape(opts.Deployment), path)
+	}
+	if strings.Contains(base, "api-version=") {
+		return base
+	}
+
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "api-version=" + url.QueryEscape(opts.APIVersion)
+}
+
+// Name returns the provider name
+func (p *AzureProvider) Name() string {
+	return "azure"
+}
+
+// setAuth sets the "Authorization: Bearer" header of an Azure AD token if one is configured,
+// otherwise the "api-key" header. The Bearer api key header of OpenAI is never sent.
+func (p *AzureProvider) setAuth(req *http.Request) error {
+	if p.opts.ADTokenFile == "" && p.opts.ADTokenCommand == "" {
+		req.Header.Set("api-key", p.oai.apiKey)
+		return nil
+	}
+
+	token, err := p.adToken(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// adToken returns the cached Azure AD token, which is read again once azureTokenRefreshInterval elapsed
+func (p *AzureProvider) adToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Since(p.tokenFetched) < azureTokenRefreshInterval {
+		return p.token, nil
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if p.opts.ADTokenFile != "" {
+		data, err = os.ReadFile(p.opts.ADTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read Azure AD token file: %w", err)
+		}
+	} else {
+		data, err = exec.CommandContext(ctx, "sh", "-c", p.opts.ADTokenCommand).Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run Azure AD token command: %w", err)
+		}
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty Azure AD token")
+	}
+	p.token = token
+	p.tokenFetched = time.Now()
+	return token, nil
+}
+
+// SendRequest sends a request to the Azure OpenAI deployment
+func (p *AzureProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+	if p.opts.APIKind == APIKindResponses {
+		// The Responses API is not under the deployment url, the deployment is the model of the request
+		priorityParams = maps.Clone(priorityParams)
+		if priorityParams == nil {
+			priorityParams = AnyParams{}
+		}
+		priorityParams["model"] = p.opts.Deployment
+	}
+	return p.oai.SendRequest(ctx, priorityParams, anyParam, headers)
+}
+
+// SupportsStreaming returns whether Azure OpenAI supports streaming
+func (p *AzureProvider) SupportsStreaming() bool {
+	return p.oai.SupportsStreaming()
+}
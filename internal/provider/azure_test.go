@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureDeploymentURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		opts     AzureOptions
+		want     string
+	}{
+		{
+			name:     "resource url",
+			endpoint: "https://res.openai.azure.com/",
+			opts:     AzureOptions{Deployment: "gpt-4o", APIVersion: "2024-10-21", APIKind: APIKindChat},
+			want:     "https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21",
+		},
+		{
+			name:     "embeddings",
+			endpoint: "https://res.openai.azure.com",
+			opts:     AzureOptions{Deployment: "ada", APIVersion: "2024-10-21", APIKind: APIKindEmbeddings},
+			want:     "https://res.openai.azure.com/openai/deployments/ada/embeddings?api-version=2024-10-21",
+		},
+		{
+			name:     "responses",
+			endpoint: "https://res.openai.azure.com/",
+			opts:     AzureOptions{Deployment: "o4-mini", APIVersion: "2025-04-01-preview", APIKind: APIKindResponses},
+			want:     "https://res.openai.azure.com/openai/responses?api-version=2025-04-01-preview",
+		},
+		{
+			name:     "full responses url",
+			endpoint: "https://res.openai.azure.com/openai/v1/responses",
+			opts:     AzureOptions{Deployment: "o4-mini", APIVersion: "preview", APIKind: APIKindResponses},
+			want:     "https://res.openai.azure.com/openai/v1/responses?api-version=preview",
+		},
+		{
+			name:     "full deployment url",
+			endpoint: "https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2025-01-01-preview",
+			opts:     AzureOptions{Deployment: "ignored", APIVersion: "2024-10-21"},
+			want:     "https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2025-01-01-preview",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, azureDeploymentURL(tt.endpoint, tt.opts))
+		})
+	}
+}
+
+func TestAzureProvider_Auth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("ad-token\n"), 0600))
+
+	tests := []struct {
+		name       string
+		opts       AzureOptions
+		wantAPIKey string
+		wantBearer string
+	}{
+		{name: "api key", wantAPIKey: "key"},
+		{name: "ad token file", opts: AzureOptions{ADTokenFile: tokenFile}, wantBearer: "Bearer ad-token"},
+		{name: "ad token command", opts: AzureOptions{ADTokenCommand: "echo cmd-token"}, wantBearer: "Bearer cmd-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/openai/deployments/gpt-4o/chat/completions", r.URL.Path)
+				assert.Equal(t, azureDefaultAPIVersion, r.URL.Query().Get("api-version"))
+				assert.Equal(t, tt.wantAPIKey, r.Header.Get("api-key"))
+				assert.Equal(t, tt.wantBearer, r.Header.Get("Authorization"))
+				fmt.Fprint(w, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],`+
+					`"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+			}))
+			defer server.Close()
+
+			provider := NewAzureProvider("key", server.URL, "gpt-4o", time.Second*10, tt.opts)
+			resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "gpt-4o"}, AnyParams{
+				"messages": []Message{{Role: "user", Content: "Hello"}},
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+		})
+	}
+}
+
+func TestAzureProvider_Responses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The deployment is sent as the model, not in the url
+		assert.Equal(t, "/openai/responses", r.URL.Path)
+		assert.Equal(t, azureResponsesAPIVersion, r.URL.Query().Get("api-version"))
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "o4-mini-prod", body["model"])
+		assert.NotNil(t, body["input"])
+		fmt.Fprint(w, `{"id":"resp_1","model":"o4-mini","status":"completed",`+
+			`"output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Hi"}]}],`+
+			`"usage":{"input_tokens":3,"output_tokens":1,"total_tokens":4}}`)
+	}))
+	defer server.Close()
+
+	provider := NewAzureProvider("key", server.URL, "o4-mini", time.Second*10, AzureOptions{Deployment: "o4-mini-prod", APIKind: APIKindResponses})
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "o4-mini"}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+}
@@ -0,0 +1,374 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+// geminiPassthroughParams are native generateContent fields, which are sent as they are
+var geminiPassthroughParams = []string{
+	"contents", "systemInstruction", "safetySettings", "tools", "toolConfig", "cachedContent",
+}
+
+// geminiGenerationParams maps OpenAI style sampling params onto generationConfig fields
+var geminiGenerationParams = map[string]string{
+	"max_tokens":            "maxOutputTokens",
+	"max_completion_tokens": "maxOutputTokens",
+	"temperature":           "temperature",
+	"top_p":                 "topP",
+	"top_k":                 "topK",
+	"n":                     "candidateCount",
+	"seed":                  "seed",
+	"presence_penalty":      "presencePenalty",
+	"frequency_penalty":     "frequencyPenalty",
+}
+
+const geminiDefaultEndpoint = "https://generativelanguage.googleapis.com/v1beta"
+
+func init() {
+	Register(Registration{
+		Name:            "gemini",
+		Description:     "Google Gemini native generateContent API",
+		DefaultEndpoint: geminiDefaultEndpoint,
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			return NewGeminiProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+		},
+	})
+}
+
+// GeminiProvider implements the Provider interface for the Google Gemini generateContent API
+type GeminiProvider struct {
+	apiKey   string
+	endpoint string
+	model    string
+	client   *http.Client
+}
+
+// geminiPart represents a part of a Gemini content
+type geminiPart struct {
+	Text string `json:"text,omitempty"`
+}
+
+// geminiContent represents a Gemini content, which is the counterpart of an OpenAI message
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiResponse represents a (streamed chunk of a) GenerateContentResponse
+type geminiResponse struct {
+	ResponseID   string `json:"responseId"`
+	ModelVersion string `json:"modelVersion"`
+	Candidates   []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error map[string]any `json:"error,omitempty"`
+}
+
+// NewGeminiProvider creates a new GeminiProvider.
+// The endpoint is either the API base url (e.g. https://generativelanguage.googleapis.com/v1beta)
+// or the full url of a model, the generateContent method is chosen per request.
+func NewGeminiProvider(apiKey, endpoint, model string, timeout time.Duration) *GeminiProvider {
+	if endpoint == "" {
+		endpoint = geminiDefaultEndpoint
+		mlog.Infof("Created Gemini provider [%s] with model [%s]", endpoint, model)
+	}
+
+	return &GeminiProvider{
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		model:    model,
+		client:   newHTTPClient(timeout),
+	}
+}
+
+// Name returns the provider name
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+// requestURL builds the generateContent or streamGenerateContent url of the model
+func (p *GeminiProvider) requestURL(model string, isStream bool) string {
+	method := ":generateContent"
+	if isStream {
+		method = ":streamGenerateContent?alt=sse"
+	}
+
+	base := strings.TrimRight(p.endpoint, "/")
+	if idx := strings.Index(base, "/models/"); idx >= 0 {
+		// Full model url, drop any method which is already there
+		if colon := strings.LastIndex(base, ":"); colon > idx {
+			base = base[:colon]
+		}
+		return base + method
+	}
+	return base + "/models/" + model + method
+}
+
+// buildRequest translates the OpenAI style request params into a generateContent request body
+func (p *GeminiProvider) buildRequest(priorityParams, anyParam AnyParams) (data []byte, model string, isStream bool, err error) {
+	params := mergeParams(priorityParams, anyParam)
+
+	isStream, _ = params["stream"].(bool)
+	model, _ = params["model"].(string)
+	if model == "" {
+		model = p.model
+	}
+
+	body := make(map[string]any)
+	for _, key := range geminiPassthroughParams {
+		if v, ok := params[key]; ok {
+			body[key] = v
+		}
+	}
+
+	if _, ok := body["contents"]; !ok {
+		messages, err := decodeMessages(params["messages"])
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		var system []geminiPart
+		contents := make([]geminiContent, 0, len(messages))
+		for _, msg := range messages {
+			part := geminiPart{Text: messageText(msg.Content)}
+			switch msg.Role {
+			case "system", "developer":
+				system = append(system, part)
+			case "assistant", "model":
+				contents = append(contents, geminiContent{Role: "model", Parts: []geminiPart{part}})
+			default:
+				contents = append(contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+			}
+		}
+		body["contents"] = contents
+		if _, ok := body["systemInstruction"]; !ok && len(system) > 0 {
+			body["systemInstruction"] = geminiContent{Parts: system}
+		}
+	}
+
+	generationConfig := make(map[string]any)
+	if v, ok := params["generationConfig"].(map[string]any); ok {
+		for k, val := range v {
+			generationConfig[k] = val
+		}
+	}
+	for key, field := range geminiGenerationParams {
+		if v, ok := params[key]; ok {
+			if _, exists := generationConfig[field]; !exists {
+				generationConfig[field] = v
+			}
+		}
+	}
+	if stop, ok := params["stop"]; ok {
+		if s, ok := stop.(string); ok {
+			generationConfig["stopSequences"] = []string{s}
+		} else {
+			generationConfig["stopSequences"] = stop
+		}
+	}
+	if len(generationConfig) > 0 {
+		body["generationConfig"] = generationConfig
+	}
+
+	data, err = json.Marshal(body)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return data, model, isStream, nil
+}
+
+// SendRequest sends a request to the Gemini API
+func (p *GeminiProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+	// Cook request body
+	data, model, isStream, err := p.buildRequest(priorityParams, anyParam)
+	if err != nil {
+		return nil, NewError(0, err)
+	}
+
+	// debug request body
+	if debugRequest == "1" {
+		mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Request: %s", string(data))
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.requestURL(model, isStream), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("failed to create request: %w", err))
+	}
+
+	// Set headers
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	// Record start time
+	startTime := time.Now()
+
+	// Execute request
+	respHttp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("request failed: %w", err))
+	}
+	defer respHttp.Body.Close()
+
+	// Check status code
+	if respHttp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(respHttp.Body)
+		return nil, NewError(respHttp.StatusCode, fmt.Errorf("%s", string(body)))
+	}
+
+	var resp *Response
+
+	defer func() {
+		// debug response body
+		if debugResponse == "1" {
+			mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Response: %+v", resp)
+		}
+	}()
+
+	if isStream {
+		resp, err = p.handleStreamingResponse(respHttp, startTime)
+	} else {
+		resp, err = p.handleNoStreamResponse(respHttp, startTime)
+	}
+
+	if err == nil {
+		return resp, nil
+	} else {
+		return resp, NewError(503, err)
+	}
+}
+
+// handleNoStreamResponse processes a generateContent response
+func (p *GeminiProvider) handleNoStreamResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var chunk geminiResponse
+	if err := json.Unmarshal(body, &chunk); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var (
+		content      strings.Builder
+		finishReason string
+	)
+	// Only the first candidate is accounted like OpenAI choices[0]
+	if len(chunk.Candidates) > 0 {
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			content.WriteString(part.Text)
+		}
+		finishReason = chunk.Candidates[0].FinishReason
+	}
+
+	response := p.toResponse(&chunk, content.String(), finishReason)
+	response.Latency = time.Since(startTime)
+	response.FirstTokenLatency = response.Latency // unstreaming same as e2e latency
+	return response, nil
+}
+
+// handleStreamingResponse processes the server-sent events of streamGenerateContent?alt=sse
+func (p *GeminiProvider) handleStreamingResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	var (
+		last         geminiResponse
+		timer        = newStreamTimer(startTime)
+		content      strings.Builder
+		finishReason string
+	)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := sseData(scanner.Text())
+		if !ok || data == "" {
+			continue
+		}
+
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			mlog.Errorf("Error unmarshaling response: %v", err)
+			continue
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("%s", data)
+		}
+
+		if len(chunk.Candidates) > 0 {
+			candidate := chunk.Candidates[0]
+			for _, part := range candidate.Content.Parts {
+				if part.Text == "" {
+					continue
+				}
+				// Record the arrival of the text part, the first one gives the first token latency
+				timer.token()
+				content.WriteString(part.Text)
+			}
+			if candidate.FinishReason != "" {
+				finishReason = candidate.FinishReason
+			}
+		}
+
+		// usageMetadata is cumulative, keep the latest one
+		if chunk.UsageMetadata.TotalTokenCount > 0 || last.UsageMetadata.TotalTokenCount == 0 {
+			last = chunk
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading streaming response: %w", err)
+	}
+
+	response := p.toResponse(&last, content.String(), finishReason)
+	response.Latency = time.Since(startTime)
+	timer.apply(response)
+	return response, nil
+}
+
+// toResponse maps a GenerateContentResponse onto the common Response
+func (p *GeminiProvider) toResponse(chunk *geminiResponse, content, finishReason string) *Response {
+	usage := chunk.UsageMetadata
+	completionTokens := usage.CandidatesTokenCount + usage.ThoughtsTokenCount
+	return &Response{
+		ID:    chunk.ResponseID,
+		Model: chunk.ModelVersion,
+		Choices: []Choice{
+			{
+				FinishReason: finishReason,
+				Message: Message{
+					Role:    "assistant",
+					Content: content,
+				},
+			},
+		},
+		Usage: Usage{
+			PromptTokens:     usage.PromptTokenCount,
+			CompletionTokens: completionTokens,
+			TotalTokens:      usage.TotalTokenCount,
+		},
+	}
+}
+
+// SupportsStreaming returns whether Gemini supports streaming
+func (p *GeminiProvider) SupportsStreaming() bool {
+	return true
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeminiProvider_RequestURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		stream   bool
+		want     string
+	}{
+		{
+			name:     "base url",
+			endpoint: "https://generativelanguage.googleapis.com/v1beta/",
+			want:     "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent",
+		},
+		{
+			name:     "base url streaming",
+			endpoint: "https://generativelanguage.googleapis.com/v1beta",
+			stream:   true,
+			want:     "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:streamGenerateContent?alt=sse",
+		},
+		{
+			name:     "full method url",
+			endpoint: "http://localhost:8080/v1beta/models/my-model:generateContent",
+			stream:   true,
+			want:     "http://localhost:8080/v1beta/models/my-model:streamGenerateContent?alt=sse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewGeminiProvider("key", tt.endpoint, "gemini-2.0-flash", time.Second)
+			assert.Equal(t, tt.want, provider.requestURL("gemini-2.0-flash", tt.stream))
+		})
+	}
+}
+
+func TestGeminiProvider_Streaming(t *testing.T) {
+	chunks := []string{
+		`{"candidates":[{"content":{"parts":[{"text":"Hello"}],"role":"model"}}],"usageMetadata":{"promptTokenCount":8},"modelVersion":"gemini-2.0-flash","responseId":"r1"}`,
+		`{"candidates":[{"content":{"parts":[{"text":" world"}],"role":"model"},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":2,"totalTokenCount":10},"modelVersion":"gemini-2.0-flash","responseId":"r1"}`,
+	}
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1beta/models/gemini-2.0-flash:streamGenerateContent", r.URL.Path)
+		assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+		assert.Equal(t, "key", r.Header.Get("x-goog-api-key"))
+
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGeminiProvider("key", server.URL+"/v1beta", "gemini-2.0-flash", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "gemini-2.0-flash", "stream": true, "max_tokens": 64}, AnyParams{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "Be brief."},
+			map[string]any{"role": "user", "content": "Hi"},
+			map[string]any{"role": "assistant", "content": "Hello!"},
+			map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "Greet me"}}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Request translation
+	assert.Equal(t, map[string]any{"parts": []any{map[string]any{"text": "Be brief."}}}, received["systemInstruction"])
+	contents := received["contents"].([]any)
+	assert.Len(t, contents, 3)
+	assert.Equal(t, "model", contents[1].(map[string]any)["role"])
+	assert.Equal(t, map[string]any{"text": "Greet me"}, contents[2].(map[string]any)["parts"].([]any)[0])
+	assert.EqualValues(t, 64, received["generationConfig"].(map[string]any)["maxOutputTokens"])
+	assert.NotContains(t, received, "messages")
+	assert.NotContains(t, received, "stream")
+
+	// Response parsing
+	assert.Equal(t, "r1", resp.ID)
+	assert.Equal(t, "Hello world", resp.Choices[0].Message.Content)
+	assert.Equal(t, "STOP", resp.Choices[0].FinishReason)
+	assert.Equal(t, 8, resp.Usage.PromptTokens)
+	assert.Equal(t, 2, resp.Usage.CompletionTokens)
+	assert.Equal(t, 10, resp.Usage.TotalTokens)
+	assert.NotZero(t, resp.FirstTokenLatency)
+}
@@ -0,0 +1,391 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+// Stream framings of the generic provider
+const (
+	FramingJSON   = "json"   // a single JSON body
+	FramingSSE    = "sse"    // server-sent events, one JSON payload per "data:" line
+	FramingNDJSON = "ndjson" // newline delimited JSON
+)
+
+// GenericOptions holds the settings of the generic provider, which are read from the model.generic config section.
+// Extractors are JSONPath-like paths (e.g. "$.choices[0].delta.content" or "choices.0.delta.content")
+// which are evaluated against every JSON payload of the response.
+type GenericOptions struct {
+	Method           string `json:"method"`             // HTTP method, defaults to POST
+	BodyTemplate     string `json:"body_template"`      // Go template of the request body, executed on the merged request params
+	BodyTemplateFile string `json:"body_template_file"` // File holding the body template, used if body_template is empty
+	Framing          string `json:"framing"`            // json (default), sse or ndjson
+	DoneMarker       string `json:"done_marker"`        // Payload which ends the stream, e.g. [DONE]
+	Done             string `json:"done"`               // Extractor of a boolean which ends the stream, e.g. $.done
+	Content          string `json:"content"`            // Extractor of the content (delta)
+	FinishReason     string `json:"finish_reason"`      // Extractor of the finish reason
+	PromptTokens     string `json:"prompt_tokens"`      // Extractor of the prompt tokens
+	CompletionTokens string `json:"completion_tokens"`  // Extractor of the completion tokens
+	TotalTokens      string `json:"total_tokens"`       // Extractor of the total tokens, defaults to prompt + completion
+	Error            string `json:"error"`              // Extractor of an error, the request fails if it is present
+	AuthHeader       string `json:"auth_header"`        // Header of the api key, defaults to "Authorization: Bearer"
+}
+
+func init() {
+	Register(Registration{
+		Name:        "generic",
+		Description: "Any HTTP/JSON service, request body template and response extractors from model.generic",
+		Schema:      &GenericOptions{},
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			var opts GenericOptions
+			if err := DecodeSection(cfg, "generic", &opts); err != nil {
+				return nil, err
+			}
+			return NewGenericProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout, opts)
+		},
+	})
+}
+
+// GenericProvider implements the Provider interface for services described by templates and extractors
+type GenericProvider struct {
+	apiKey   string
+	endpoint string
+	opts     GenericOptions
+	body     *template.Template
+	client   *http.Client
+}
+
+// genericFuncs are the functions available to body templates
+var genericFuncs = template.FuncMap{
+	// json renders a value as JSON, e.g. {{ json .messages }}
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// prompt joins the contents of the messages into a raw prompt, e.g. {{ prompt .messages | json }}
+	"prompt": func(v any) string {
+		p, _ := messagesPrompt(v)
+		return p
+	},
+	// default returns the value, or def if the value is missing, e.g. {{ default 256 .max_tokens }}
+	"default": func(def, v any) any {
+		if v == nil {
+			return def
+		}
+		return v
+	},
+}
+
+// NewGenericProvider creates a new GenericProvider
+func NewGenericProvider(apiKey, endpoint, model string, timeout time.Duration, opts GenericOptions) (*GenericProvider, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("endpoint must be specified for the generic provider")
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.Framing == "" {
+		opts.Framing = FramingJSON
+	}
+	switch opts.Framing {
+	case FramingJSON, FramingSSE, FramingNDJSON:
+	default:
+		return nil, fmt.Errorf("unsupported framing: %s, supported framings: %s, %s, %s", opts.Framing, FramingJSON, FramingSSE, FramingNDJSON)
+	}
+	if opts.Content == "" {
+		return nil, fmt.Errorf("content extractor must be specified for the generic provider")
+	}
+
+	text := opts.BodyTemplate
+	if text == "" && opts.BodyTemplateFile != "" {
+		data, err := os.ReadFile(opts.BodyTemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body template: %w", err)
+		}
+		text = string(data)
+	}
+	if text == "" {
+		// Send the request params as they are
+		text = "{{ json . }}"
+	}
+	body, err := template.New("body").Funcs(genericFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse body template: %w", err)
+	}
+
+	mlog.Infof("Created generic provider [%s] with model [%s], framing [%s]", endpoint, model, opts.Framing)
+
+	return &GenericProvider{
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		opts:     opts,
+		body:     body,
+		client:   newHTTPClient(timeout),
+	}, nil
+}
+
+// Name returns the provider name
+func (p *GenericProvider) Name() string {
+	return "generic"
+}
+
+// buildRequest renders the body template on the merged request params
+func (p *GenericProvider) buildRequest(priorityParams, anyParam AnyParams) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.body.Execute(&buf, map[string]any(mergeParams(priorityParams, anyParam))); err != nil {
+		return nil, fmt.Errorf("failed to render body template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SendRequest sends a request to the generic service
+func (p *GenericProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+	// Cook request body
+	data, err := p.buildRequest(priorityParams, anyParam)
+	if err != nil {
+		return nil, NewError(0, err)
+	}
+
+	// debug request body
+	if debugRequest == "1" {
+		mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Request: %s", string(data))
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, p.opts.Method, p.endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("failed to create request: %w", err))
+	}
+
+	// Set headers
+	if p.apiKey != "" {
+		if p.opts.AuthHeader == "" || strings.EqualFold(p.opts.AuthHeader, "Authorization") {
+			httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+		} else {
+			httpReq.Header.Set(p.opts.AuthHeader, p.apiKey)
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	// Record start time
+	startTime := time.Now()
+
+	// Execute request
+	respHttp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("request failed: %w", err))
+	}
+	defer respHttp.Body.Close()
+
+	// Check status code
+	if respHttp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(respHttp.Body)
+		return nil, NewError(respHttp.StatusCode, fmt.Errorf("%s", string(body)))
+	}
+
+	var resp *Response
+
+	defer func() {
+		// debug response body
+		if debugResponse == "1" {
+			mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Response: %+v", resp)
+		}
+	}()
+
+	resp, err = p.handleResponse(respHttp, startTime)
+	if err == nil {
+		return resp, nil
+	} else {
+		return resp, NewError(503, err)
+	}
+}
+
+// handleResponse splits the response body into JSON payloads according to the framing
+// and runs the extractors on each of them
+func (p *GenericProvider) handleResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	var (
+		timer        = newStreamTimer(startTime)
+		content      strings.Builder
+		finishReason string
+		usage        Usage
+	)
+
+	// handle processes a payload, it returns true once the end of the stream is reached
+	handle := func(payload string) (bool, error) {
+		if p.opts.DoneMarker != "" && payload == p.opts.DoneMarker {
+			return true, nil
+		}
+
+		var v any
+		if err := json.Unmarshal([]byte(payload), &v); err != nil {
+			mlog.Errorf("Error unmarshaling response: %v", err)
+			return false, nil
+		}
+		if p.opts.Error != "" {
+			if e, ok := extractPath(v, p.opts.Error); ok && e != nil {
+				return true, fmt.Errorf("%s", payload)
+			}
+		}
+
+		if text := extractString(v, p.opts.Content); text != "" {
+			// Record the arrival of the content, the first one gives the first token latency
+			timer.token()
+			content.WriteString(text)
+		}
+		if reason := extractString(v, p.opts.FinishReason); reason != "" {
+			finishReason = reason
+		}
+		// Token counts are either cumulative or only sent at the end, keep the latest ones
+		if n := extractInt(v, p.opts.PromptTokens); n > 0 {
+			usage.PromptTokens = n
+		}
+		if n := extractInt(v, p.opts.CompletionTokens); n > 0 {
+			usage.CompletionTokens = n
+		}
+		if n := extractInt(v, p.opts.TotalTokens); n > 0 {
+			usage.TotalTokens = n
+		}
+
+		if p.opts.Done != "" {
+			if done, ok := extractPath(v, p.opts.Done); ok && done == true {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if p.opts.Framing == FramingJSON {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if _, err := handle(string(body)); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			payload := strings.TrimSpace(scanner.Text())
+			if p.opts.Framing == FramingSSE {
+				var ok bool
+				if payload, ok = sseData(payload); !ok {
+					continue
+				}
+			}
+			if payload == "" {
+				continue
+			}
+
+			done, err := handle(payload)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				break
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading streaming response: %w", err)
+		}
+	}
+
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	response := &Response{
+		Choices: []Choice{
+			{
+				FinishReason: finishReason,
+				Message: Message{
+					Role:    "assistant",
+					Content: content.String(),
+				},
+			},
+		},
+		Usage: usage,
+	}
+
+	// Set timing information
+	response.Latency = time.Since(startTime)
+	timer.apply(response)
+	if p.opts.Framing == FramingJSON {
+		response.FirstTokenLatency = response.Latency // unstreaming same as e2e latency
+		response.StreamChunks = 0                     // the single body is not a chunk of tokens
+	}
+	return response, nil
+}
+
+// SupportsStreaming returns whether the generic provider supports streaming
+func (p *GenericProvider) SupportsStreaming() bool {
+	return p.opts.Framing != FramingJSON
+}
+
+// extractPath evaluates a JSONPath-like path (e.g. "$.choices[0].delta.content") against a decoded JSON value
+func extractPath(v any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	if path == "" {
+		return v, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// extractString evaluates a path to a string, an empty path or a missing value gives ""
+func extractString(v any, path string) string {
+	if path == "" {
+		return ""
+	}
+	if s, ok := extractPath(v, path); ok {
+		if str, ok := s.(string); ok {
+			return str
+		}
+	}
+	return ""
+}
+
+// extractInt evaluates a path to an integer, an empty path or a missing value gives 0
+func extractInt(v any, path string) int {
+	if path == "" {
+		return 0
+	}
+	if n, ok := extractPath(v, path); ok {
+		if f, ok := n.(float64); ok {
+			return int(f)
+		}
+	}
+	return 0
+}
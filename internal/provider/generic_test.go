@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractPath(t *testing.T) {
+	var v any
+	assert.NoError(t, json.Unmarshal([]byte(`{"choices":[{"delta":{"content":"Hi"}}],"usage":{"prompt_tokens":3}}`), &v))
+
+	assert.Equal(t, "Hi", extractString(v, "$.choices[0].delta.content"))
+	assert.Equal(t, "Hi", extractString(v, "choices.0.delta.content"))
+	assert.Equal(t, 3, extractInt(v, "$.usage.prompt_tokens"))
+	assert.Equal(t, "", extractString(v, "$.choices[1].delta.content"))
+	assert.Equal(t, 0, extractInt(v, ""))
+}
+
+func TestGenericProvider_NDJSON(t *testing.T) {
+	lines := []string{
+		`{"token":{"text":"Hel"},"details":null}`,
+		`{"token":{"text":"lo"},"details":null}`,
+		`{"token":{"text":""},"details":{"finish_reason":"length","prompt_tokens":5,"generated_tokens":2},"end":true}`,
+		`{"token":{"text":"ignored"}}`,
+	}
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("X-Api-Key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &received))
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := NewGenericProvider("key", server.URL, "tgi", time.Second*10, GenericOptions{
+		BodyTemplate:     `{"inputs": {{ prompt .messages | json }}, "parameters": {"max_new_tokens": {{ default 256 .max_tokens }}}}`,
+		Framing:          FramingNDJSON,
+		Done:             "$.end",
+		Content:          "$.token.text",
+		FinishReason:     "$.details.finish_reason",
+		PromptTokens:     "$.details.prompt_tokens",
+		CompletionTokens: "$.details.generated_tokens",
+		AuthHeader:       "X-Api-Key",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, perr := provider.SendRequest(context.Background(), AnyParams{"model": "tgi"}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+
+	// Request rendering
+	assert.Equal(t, "Hello", received["inputs"])
+	assert.EqualValues(t, 256, received["parameters"].(map[string]any)["max_new_tokens"])
+
+	// Response extraction
+	assert.Equal(t, "Hello", resp.Choices[0].Message.Content)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, 5, resp.Usage.PromptTokens)
+	assert.Equal(t, 2, resp.Usage.CompletionTokens)
+	assert.Equal(t, 7, resp.Usage.TotalTokens)
+	assert.NotZero(t, resp.FirstTokenLatency)
+}
+
+func TestGenericProvider_SSE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		fmt.Fprint(w, "data: {\"out\":\"a\"}\n\ndata: {\"out\":\"b\",\"usage\":{\"in\":1,\"out\":2}}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider, err := NewGenericProvider("key", server.URL, "m", time.Second*10, GenericOptions{
+		Framing:          FramingSSE,
+		DoneMarker:       "[DONE]",
+		Content:          "out",
+		PromptTokens:     "usage.in",
+		CompletionTokens: "usage.out",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, perr := provider.SendRequest(context.Background(), AnyParams{"stream": true}, AnyParams{"prompt": "x"}, nil)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	assert.Equal(t, "ab", resp.Choices[0].Message.Content)
+	assert.Equal(t, 3, resp.Usage.TotalTokens)
+}
+
+func TestGenericProvider_JSONError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"message":"overloaded"}}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewGenericProvider("", server.URL, "m", time.Second*10, GenericOptions{
+		Content: "$.output",
+		Error:   "$.error",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, perr := provider.SendRequest(context.Background(), nil, AnyParams{"prompt": "x"}, nil)
+	if assert.NotNil(t, perr) {
+		assert.Equal(t, 503, perr.Code)
+	}
+}
+
+func TestNewGenericProvider_Validation(t *testing.T) {
+	_, err := NewGenericProvider("", "", "m", time.Second, GenericOptions{Content: "$.out"})
+	assert.Error(t, err)
+	_, err = NewGenericProvider("", "http://localhost", "m", time.Second, GenericOptions{Content: "$.out", Framing: "grpc"})
+	assert.Error(t, err)
+	_, err = NewGenericProvider("", "http://localhost", "m", time.Second, GenericOptions{Content: "$.out", BodyTemplate: "{{ .x "})
+	assert.Error(t, err)
+}
@@ -0,0 +1,290 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+// ollamaPassthroughParams are native /api/chat fields, which are sent as they are
+var ollamaPassthroughParams = []string{"model", "format", "keep_alive", "tools", "think"}
+
+// ollamaOptionParams maps OpenAI style sampling params onto Ollama model options
+var ollamaOptionParams = map[string]string{
+	"max_tokens":            "num_predict",
+	"max_completion_tokens": "num_predict",
+	"temperature":           "temperature",
+	"top_p":                 "top_p",
+	"top_k":                 "top_k",
+	"seed":                  "seed",
+	"stop":                  "stop",
+	"presence_penalty":      "presence_penalty",
+	"frequency_penalty":     "frequency_penalty",
+}
+
+const ollamaDefaultEndpoint = "http://localhost:11434/api/chat"
+
+// ollamaMaxLineSize is the maximum size of an NDJSON line, a non-streaming reply holds the whole answer in one
+const ollamaMaxLineSize = 64 << 20
+
+func init() {
+	Register(Registration{
+		Name:            "ollama",
+		Description:     "Ollama native /api/chat API, with server-side timing",
+		DefaultEndpoint: ollamaDefaultEndpoint,
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			return NewOllamaProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+		},
+	})
+}
+
+// OllamaProvider implements the Provider interface for the Ollama native /api/chat API
+type OllamaProvider struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+// ollamaChunk represents a (streamed line of a) /api/chat response, durations are in nanoseconds
+type ollamaChunk struct {
+	Model   string `json:"model"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done               bool   `json:"done"`
+	DoneReason         string `json:"done_reason"`
+	TotalDuration      int64  `json:"total_duration"`
+	LoadDuration       int64  `json:"load_duration"`
+	PromptEvalCount    int    `json:"prompt_eval_count"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration"`
+	EvalCount          int    `json:"eval_count"`
+	EvalDuration       int64  `json:"eval_duration"`
+	Error              string `json:"error"`
+}
+
+// NewOllamaProvider creates a new OllamaProvider
+func NewOllamaProvider(apiKey, endpoint, model string, timeout time.Duration) *OllamaProvider {
+	if endpoint == "" {
+		endpoint = ollamaDefaultEndpoint
+		mlog.Infof("Created Ollama provider [%s] with model [%s]", endpoint, model)
+	}
+
+	return &OllamaProvider{
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		client:   newHTTPClient(timeout),
+	}
+}
+
+// Name returns the provider name
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+// buildRequest translates the OpenAI style request params into an /api/chat request body
+func (p *OllamaProvider) buildRequest(priorityParams, anyParam AnyParams) (data []byte, isStream bool, err error) {
+	params := mergeParams(priorityParams, anyParam)
+
+	body := make(map[string]any)
+	for _, key := range ollamaPassthroughParams {
+		if v, ok := params[key]; ok {
+			body[key] = v
+		}
+	}
+
+	messages, err := decodeMessages(params["messages"])
+	if err != nil {
+		return nil, false, err
+	}
+	// Ollama only accepts plain text content
+	for i := range messages {
+		if _, ok := messages[i].Content.(string); !ok {
+			messages[i].Content = messageText(messages[i].Content)
+		}
+	}
+	body["messages"] = messages
+
+	options := make(map[string]any)
+	if v, ok := params["options"].(map[string]any); ok {
+		for k, val := range v {
+			options[k] = val
+		}
+	}
+	for key, option := range ollamaOptionParams {
+		if v, ok := params[key]; ok {
+			if _, exists := options[option]; !exists {
+				options[option] = v
+			}
+		}
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+
+	// Ollama streams by default, so always send the stream flag explicitly
+	isStream, _ = params["stream"].(bool)
+	body["stream"] = isStream
+
+	data, err = json.Marshal(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return data, isStream, nil
+}
+
+// SendRequest sends a request to the Ollama API
+func (p *OllamaProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+	// Cook request body
+	data, isStream, err := p.buildRequest(priorityParams, anyParam)
+	if err != nil {
+		return nil, NewError(0, err)
+	}
+
+	// debug request body
+	if debugRequest == "1" {
+		mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Request: %s", string(data))
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("failed to create request: %w", err))
+	}
+
+	// Set headers, the api key is only needed behind an authenticating proxy
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	// Record start time
+	startTime := time.Now()
+
+	// Execute request
+	respHttp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, NewError(0, fmt.Errorf("request failed: %w", err))
+	}
+	defer respHttp.Body.Close()
+
+	// Check status code
+	if respHttp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(respHttp.Body)
+		return nil, NewError(respHttp.StatusCode, fmt.Errorf("%s", string(body)))
+	}
+
+	var resp *Response
+
+	defer func() {
+		// debug response body
+		if debugResponse == "1" {
+			mlog.WithTraceId(fmt.Sprintf("%p", anyParam)).Debugf("Response: %+v", resp)
+		}
+	}()
+
+	resp, err = p.handleResponse(respHttp, startTime, isStream)
+	if err == nil {
+		return resp, nil
+	} else {
+		return resp, NewError(503, err)
+	}
+}
+
+// handleResponse processes an /api/chat response. A non-streaming response is a single
+// NDJSON line with done=true, so both modes share the same parser.
+func (p *OllamaProvider) handleResponse(resp *http.Response, startTime time.Time, isStream bool) (*Response, error) {
+	var (
+		final   ollamaChunk
+		timer   = newStreamTimer(startTime)
+		content strings.Builder
+		role    string
+	)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), ollamaMaxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			mlog.Errorf("Error unmarshaling response: %v", err)
+			continue
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("%s", line)
+		}
+
+		if chunk.Message.Content != "" {
+			// Record the arrival of the content chunk, the first one gives the first token latency
+			timer.token()
+			content.WriteString(chunk.Message.Content)
+		}
+		if role == "" {
+			role = chunk.Message.Role
+		}
+		if chunk.Done {
+			final = chunk
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	response := &Response{
+		Model: final.Model,
+		Choices: []Choice{
+			{
+				FinishReason: final.DoneReason,
+				Message: Message{
+					Role:    role,
+					Content: content.String(),
+				},
+			},
+		},
+		Usage: Usage{
+			PromptTokens:     final.PromptEvalCount,
+			CompletionTokens: final.EvalCount,
+			TotalTokens:      final.PromptEvalCount + final.EvalCount,
+		},
+	}
+	if final.Done {
+		// The timings are only sent with the final chunk, a truncated stream has none
+		response.ServerTiming = &ServerTiming{
+			LoadDuration:    time.Duration(final.LoadDuration),
+			PrefillDuration: time.Duration(final.PromptEvalDuration),
+			DecodeDuration:  time.Duration(final.EvalDuration),
+			TotalDuration:   time.Duration(final.TotalDuration),
+		}
+	}
+
+	// Set timing information
+	response.Latency = time.Since(startTime)
+	timer.apply(response)
+	if !isStream {
+		response.FirstTokenLatency = response.Latency // unstreaming same as e2e latency
+		response.StreamChunks = 0                     // the single line is not a chunk of tokens
+	}
+
+	return response, nil
+}
+
+// SupportsStreaming returns whether Ollama supports streaming
+func (p *OllamaProvider) SupportsStreaming() bool {
+	return true
+}
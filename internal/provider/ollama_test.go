@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOllamaProvider_Streaming(t *testing.T) {
+	lines := []string{
+		`{"model":"llama3","message":{"role":"assistant","content":"Hello"},"done":false}`,
+		`{"model":"llama3","message":{"role":"assistant","content":" world"},"done":false}`,
+		`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop",` +
+			`"total_duration":900000000,"load_duration":100000000,"prompt_eval_count":26,"prompt_eval_duration":200000000,` +
+			`"eval_count":2,"eval_duration":500000000}`,
+	}
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider("", server.URL, "llama3", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "llama3", "stream": true, "stream_options": map[string]any{}}, AnyParams{
+		"messages":   []Message{{Role: "user", Content: "Hello"}},
+		"max_tokens": 32,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Request translation
+	assert.Equal(t, true, received["stream"])
+	assert.EqualValues(t, 32, received["options"].(map[string]any)["num_predict"])
+	assert.NotContains(t, received, "stream_options")
+	assert.NotContains(t, received, "max_tokens")
+
+	// Response parsing
+	assert.Equal(t, "Hello world", resp.Choices[0].Message.Content)
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+	assert.Equal(t, 26, resp.Usage.PromptTokens)
+	assert.Equal(t, 2, resp.Usage.CompletionTokens)
+	assert.Equal(t, 100*time.Millisecond, resp.ServerTiming.LoadDuration)
+	assert.Equal(t, 200*time.Millisecond, resp.ServerTiming.PrefillDuration)
+	assert.Equal(t, 500*time.Millisecond, resp.ServerTiming.DecodeDuration)
+	assert.NotZero(t, resp.FirstTokenLatency)
+}
+
+func TestOllamaProvider_NoStream(t *testing.T) {
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+
+		fmt.Fprint(w, `{"model":"llama3","message":{"role":"assistant","content":"Hi"},"done":true,"done_reason":"stop",`+
+			`"prompt_eval_count":5,"prompt_eval_duration":1000,"eval_count":1,"eval_duration":2000}`)
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider("", server.URL, "llama3", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "llama3"}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, false, received["stream"])
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+	assert.Equal(t, resp.Latency, resp.FirstTokenLatency)
+	assert.Equal(t, 2*time.Microsecond, resp.ServerTiming.DecodeDuration)
+	// The usage is reported, the single line is not a streamed chunk
+	assert.Equal(t, 1, resp.Usage.CompletionTokens)
+	assert.Zero(t, resp.StreamChunks)
+}
+
+func TestOllamaProvider_LongAndTruncated(t *testing.T) {
+	long := strings.Repeat("word ", 100_000)
+	replies := map[string]string{
+		// A non-streaming reply holds the whole answer in one line
+		"/long": `{"model":"llama3","message":{"role":"assistant","content":"` + long + `"},"done":true,"eval_count":100000}`,
+		// A stream cut before its final chunk has no server timing
+		"/truncated": `{"model":"llama3","message":{"role":"assistant","content":"Hello"},"done":false}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, replies[r.URL.Path])
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider("", server.URL+"/long", "llama3", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "llama3"}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, long, resp.Choices[0].Message.Content)
+	assert.NotNil(t, resp.ServerTiming)
+
+	provider = NewOllamaProvider("", server.URL+"/truncated", "llama3", time.Second*10)
+	resp, err = provider.SendRequest(context.Background(), AnyParams{"model": "llama3", "stream": true}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Hello", resp.Choices[0].Message.Content)
+	assert.Nil(t, resp.ServerTiming)
+}
@@ -3,14 +3,17 @@ package provider
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"maps"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
 )
 
 var (
@@ -18,33 +21,83 @@ var (
 	debugResponse = os.Getenv("DEBUG_LLM_RESPONSE")
 )
 
+// API kinds of the OpenAI compatible endpoints
+const (
+	APIKindChat        = "chat"        // /v1/chat/completions
+	APIKindCompletions = "completions" // legacy /v1/completions
+	APIKindEmbeddings  = "embeddings"  // /v1/embeddings
+	APIKindResponses   = "responses"   // /v1/responses
+)
+
+const openAIDefaultEndpoint = "https://api.openai.com/v1/chat/completions"
+
+func init() {
+	Register(Registration{
+		Name:            "openai",
+		Description:     "OpenAI compatible API, model.api_kind selects chat, completions, embeddings or responses",
+		DefaultEndpoint: openAIDefaultEndpoint,
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			switch cfg.APIKind {
+			case "", APIKindChat:
+				return NewOpenAIProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+			case APIKindCompletions:
+				return NewOpenAICompletionsProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+			case APIKindEmbeddings:
+				return NewOpenAIEmbeddingsProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+			case APIKindResponses:
+				return NewOpenAIResponsesProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+			default:
+				return nil, fmt.Errorf("unsupported api_kind: %s, supported api kinds: %s, %s, %s, %s",
+					cfg.APIKind, APIKindChat, APIKindCompletions, APIKindEmbeddings, APIKindResponses)
+			}
+		},
+	})
+}
+
 // OpenAIProvider implements the Provider interface for OpenAI
 type OpenAIProvider struct {
 	apiKey   string
 	endpoint string
+	apiKind  string
 	client   *http.Client
+	// setAuth sets the authentication headers of a request, Bearer api key by default
+	setAuth func(req *http.Request) error
 }
 
 // NewOpenAIProvider creates a new OpenAIProvider
 func NewOpenAIProvider(apiKey, endpoint, model string, timeout time.Duration) *OpenAIProvider {
 	if endpoint == "" {
-		endpoint = "https://api.openai.com/v1/chat/completions"
+		endpoint = openAIDefaultEndpoint
 		mlog.Infof("Created OpenAI provider [%s] with model [%s]", endpoint, model)
 	}
 
-	return &OpenAIProvider{
+	p := &OpenAIProvider{
 		apiKey:   apiKey,
 		endpoint: endpoint,
-		client: &http.Client{
-			Timeout: timeout,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) > 3 {
-					return http.ErrUseLastResponse
-				}
-				return nil
-			},
-		},
+		apiKind:  APIKindChat,
+		client:   newHTTPClient(timeout),
 	}
+	p.setAuth = p.setBearerAuth
+	return p
+}
+
+// setBearerAuth sets the "Authorization: Bearer" header of the api key
+func (p *OpenAIProvider) setBearerAuth(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	return nil
+}
+
+// NewOpenAICompletionsProvider creates a new OpenAIProvider for the legacy text completions API,
+// which takes a raw "prompt" and skips the chat template of the server
+func NewOpenAICompletionsProvider(apiKey, endpoint, model string, timeout time.Duration) *OpenAIProvider {
+	if endpoint == "" {
+		endpoint = "https://api.openai.com/v1/completions"
+		mlog.Infof("Created OpenAI completions provider [%s] with model [%s]", endpoint, model)
+	}
+
+	p := NewOpenAIProvider(apiKey, endpoint, model, timeout)
+	p.apiKind = APIKindCompletions
+	return p
 }
 
 // Name returns the provider name
@@ -62,12 +115,17 @@ func (p *OpenAIProvider) Name() string {
 //
 //	The merged JSON byte slice.
 func (p *OpenAIProvider) mergeRequest(priorityParams, anyParam AnyParams) (data []byte, isStream bool) {
-	body := make(map[string]any)
-
-	maps.Copy(body, anyParam)
-
 	// Merge the priority parameter (it will overwrite keys with the same name)
-	maps.Copy(body, priorityParams)
+	body := mergeParams(priorityParams, anyParam)
+
+	switch p.apiKind {
+	case APIKindCompletions:
+		toCompletionsRequest(body)
+	case APIKindEmbeddings:
+		toEmbeddingsRequest(body)
+	case APIKindResponses:
+		toResponsesRequest(body)
+	}
 
 	if _, ok := body["stream"]; ok {
 		isStream, _ = body["stream"].(bool)
@@ -81,8 +139,19 @@ func (p *OpenAIProvider) mergeRequest(priorityParams, anyParam AnyParams) (data
 	return
 }
 
+// toCompletionsRequest turns a chat request body into a text completions one.
+// Datasets which only carry "messages" get a raw prompt made of the message contents, without any chat template.
+func toCompletionsRequest(body AnyParams) {
+	if _, ok := body["prompt"]; !ok {
+		if prompt, ok := messagesPrompt(body["messages"]); ok {
+			body["prompt"] = prompt
+		}
+	}
+	delete(body, "messages")
+}
+
 // SendRequest sends a request to OpenAI API
-func (p *OpenAIProvider) SendRequest(priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+func (p *OpenAIProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
 	// Cook request body
 	data, isStream := p.mergeRequest(priorityParams, anyParam)
 
@@ -92,13 +161,15 @@ func (p *OpenAIProvider) SendRequest(priorityParams, anyParam AnyParams, headers
 	}
 
 	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", p.endpoint, bytes.NewBuffer(data))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, NewError(0, fmt.Errorf("failed to create request: %w", err))
 	}
 
 	// Set headers
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if err := p.setAuth(httpReq); err != nil {
+		return nil, NewError(0, fmt.Errorf("failed to authenticate request: %w", err))
+	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	for k, v := range headers {
 		httpReq.Header.Set(k, v)
@@ -129,10 +200,16 @@ func (p *OpenAIProvider) SendRequest(priorityParams, anyParam AnyParams, headers
 		}
 	}()
 
-	if isStream {
+	switch {
+	case p.apiKind == APIKindEmbeddings:
+		resp, err = p.handleEmbeddingsResponse(respHttp, startTime)
+	case p.apiKind == APIKindResponses && isStream:
+		resp, err = p.handleResponsesStreamingResponse(respHttp, startTime)
+	case p.apiKind == APIKindResponses:
+		resp, err = p.handleResponsesNoStreamResponse(respHttp, startTime)
+	case isStream:
 		resp, err = p.handleStreamingResponse(respHttp, startTime)
-
-	} else {
+	default:
 		resp, err = p.handleNoStreamResponse(respHttp, startTime)
 	}
 
@@ -159,6 +236,13 @@ func (p *OpenAIProvider) handleNoStreamResponse(resp *http.Response, startTime t
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	// Text completions carry the output in choices[].text
+	for i := range response.Choices {
+		if response.Choices[i].Message.Content == nil && response.Choices[i].Text != "" {
+			response.Choices[i].Message = Message{Role: "assistant", Content: response.Choices[i].Text}
+		}
+	}
+
 	response.Latency = time.Since(startTime)
 	if response.FirstTokenLatency == 0 {
 		response.FirstTokenLatency = response.Latency // unstreaming same as e2e latency
@@ -169,11 +253,11 @@ func (p *OpenAIProvider) handleNoStreamResponse(resp *http.Response, startTime t
 // handleStreamingResponse processes a streaming response from OpenAI API
 func (p *OpenAIProvider) handleStreamingResponse(resp *http.Response, startTime time.Time) (*Response, error) {
 	var (
-		response          Response
-		firstTokenLatency time.Duration
-		content           strings.Builder
-		role              string
-		finishReason      string
+		response     Response
+		timer        = newStreamTimer(startTime)
+		content      strings.Builder
+		role         string
+		finishReason string
 	)
 
 	scanner := bufio.NewScanner(resp.Body)
@@ -198,29 +282,34 @@ func (p *OpenAIProvider) handleStreamingResponse(resp *http.Response, startTime
 			continue
 		}
 
-		// Parse the SSE event
+		// Parse the SSE event, choices are reset so that fields missing in this chunk
+		// are not inherited from the previous one
+		response.Choices = nil
 		if err := json.Unmarshal([]byte(data), &response); err != nil {
 			mlog.Errorf("Error unmarshaling response: %v", err)
 			continue
 		}
 
-		// Record first token latency on first chunk
-		if firstTokenLatency == 0 {
-			firstTokenLatency = time.Since(startTime)
+		// Record the arrival of the chunk, the first one gives the first token latency. The role-only first
+		// chunk, the finish reason and the trailing usage chunks carry no text and are not tokens.
+		if slices.ContainsFunc(response.Choices, func(c Choice) bool { return c.hasToken() }) {
+			timer.token()
 		}
 
 		// Process choices
 		for _, choice := range response.Choices {
+			if len(finishReason) == 0 {
+				finishReason = choice.FinishReason
+			}
+			// Text completions stream choices[].text instead of a delta
 			if choice.Delta == nil {
+				content.WriteString(choice.Text)
 				continue
 			}
 			content.WriteString(choice.Delta.Content)
 			if len(role) == 0 {
 				role = choice.Delta.Role
 			}
-			if len(finishReason) == 0 {
-				finishReason = choice.FinishReason
-			}
 		}
 	}
 
@@ -241,7 +330,7 @@ func (p *OpenAIProvider) handleStreamingResponse(resp *http.Response, startTime
 
 	// Set timing information
 	response.Latency = time.Since(startTime)
-	response.FirstTokenLatency = firstTokenLatency
+	timer.apply(&response)
 
 	return &response, nil
 }
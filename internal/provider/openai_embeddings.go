@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// embeddingsUnsupportedParams are chat only params, which are dropped from an embeddings request
+var embeddingsUnsupportedParams = []string{
+	"messages", "prompt", "stream", "stream_options", "max_tokens", "max_completion_tokens",
+	"ignore_eos", "truncate_prompt_tokens", "temperature", "top_p",
+}
+
+// embeddingsResponse represents a response of the embeddings API, the vectors themselves are not kept
+type embeddingsResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index int `json:"index"`
+	} `json:"data"`
+	Usage Usage `json:"usage"`
+}
+
+// NewOpenAIEmbeddingsProvider creates a new OpenAIProvider for the embeddings API.
+// Each request is a batch, whose size is the number of strings of its "input".
+func NewOpenAIEmbeddingsProvider(apiKey, endpoint, model string, timeout time.Duration) *OpenAIProvider {
+	if endpoint == "" {
+		endpoint = "https://api.openai.com/v1/embeddings"
+		mlog.Infof("Created OpenAI embeddings provider [%s] with model [%s]", endpoint, model)
+	}
+
+	p := NewOpenAIProvider(apiKey, endpoint, model, timeout)
+	p.apiKind = APIKindEmbeddings
+	return p
+}
+
+// toEmbeddingsRequest turns a request body into an embeddings one.
+// Datasets which carry no "input" get the prompt or the message contents as a single input.
+func toEmbeddingsRequest(body AnyParams) {
+	if _, ok := body["input"]; !ok {
+		if prompt, ok := body["prompt"]; ok {
+			body["input"] = prompt
+		} else if prompt, ok := messagesPrompt(body["messages"]); ok {
+			body["input"] = prompt
+		}
+	}
+	for _, key := range embeddingsUnsupportedParams {
+		delete(body, key)
+	}
+}
+
+// handleEmbeddingsResponse processes a response from the embeddings API
+func (p *OpenAIProvider) handleEmbeddingsResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var embeddings embeddingsResponse
+	if err := json.Unmarshal(body, &embeddings); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	response := &Response{
+		Model:      embeddings.Model,
+		Usage:      embeddings.Usage,
+		Embeddings: len(embeddings.Data),
+	}
+	if response.Usage.TotalTokens == 0 {
+		response.Usage.TotalTokens = response.Usage.PromptTokens
+	}
+	response.Latency = time.Since(startTime)
+	return response, nil
+}
@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// responsesUnsupportedParams are chat completions only params, which are rejected by the Responses API
+var responsesUnsupportedParams = []string{
+	"messages", "stream_options", "max_tokens", "max_completion_tokens", "reasoning_effort",
+	"n", "stop", "seed", "logprobs", "frequency_penalty", "presence_penalty", "response_format", "ignore_eos",
+	"extra_body", "truncate_prompt_tokens",
+}
+
+// responsesResult represents a response object of the Responses API
+type responsesResult struct {
+	ID                string `json:"id"`
+	Model             string `json:"model"`
+	Status            string `json:"status"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Output []struct {
+		Type    string `json:"type"`
+		Role    string `json:"role"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		TotalTokens        int `json:"total_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	} `json:"usage"`
+	Error map[string]any `json:"error"`
+}
+
+// responsesEvent represents a typed server-sent event of the Responses API
+type responsesEvent struct {
+	Type     string          `json:"type"`
+	Delta    string          `json:"delta"`
+	Response responsesResult `json:"response"`
+}
+
+// NewOpenAIResponsesProvider creates a new OpenAIProvider for the Responses API
+func NewOpenAIResponsesProvider(apiKey, endpoint, model string, timeout time.Duration) *OpenAIProvider {
+	if endpoint == "" {
+		endpoint = "https://api.openai.com/v1/responses"
+		mlog.Infof("Created OpenAI responses provider [%s] with model [%s]", endpoint, model)
+	}
+
+	p := NewOpenAIProvider(apiKey, endpoint, model, timeout)
+	p.apiKind = APIKindResponses
+	return p
+}
+
+// toResponsesRequest turns a chat request body into a Responses API one.
+// The messages become the "input" items and the chat token limits become "max_output_tokens".
+func toResponsesRequest(body AnyParams) {
+	if _, ok := body["input"]; !ok {
+		if messages, ok := body["messages"]; ok {
+			body["input"] = messages
+		}
+	}
+	if _, ok := body["max_output_tokens"]; !ok {
+		if v, ok := body["max_tokens"]; ok {
+			body["max_output_tokens"] = v
+		} else if v, ok := body["max_completion_tokens"]; ok {
+			body["max_output_tokens"] = v
+		}
+	}
+	if effort, ok := body["reasoning_effort"]; ok {
+		if _, exists := body["reasoning"]; !exists {
+			body["reasoning"] = map[string]any{"effort": effort}
+		}
+	}
+	for _, key := range responsesUnsupportedParams {
+		delete(body, key)
+	}
+}
+
+// handleResponsesNoStreamResponse processes a non-streaming response from the Responses API
+func (p *OpenAIProvider) handleResponsesNoStreamResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result responsesResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("%s", string(body))
+	}
+
+	response := result.toResponse(result.outputText())
+	response.Latency = time.Since(startTime)
+	response.FirstTokenLatency = response.Latency // unstreaming same as e2e latency
+	return response, nil
+}
+
+// handleResponsesStreamingResponse processes the typed server-sent events of the Responses API,
+// the usage is only carried by the final response.completed (or response.incomplete) event
+func (p *OpenAIProvider) handleResponsesStreamingResponse(resp *http.Response, startTime time.Time) (*Response, error) {
+	var (
+		final   responsesResult
+		timer   = newStreamTimer(startTime)
+		content strings.Builder
+	)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		// Event names are repeated in the "type" field of the data payload
+		data, ok := sseData(scanner.Text())
+		if !ok || data == "" {
+			continue
+		}
+
+		var event responsesEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			mlog.Errorf("Error unmarshaling response: %v", err)
+			continue
+		}
+
+		switch event.Type {
+		case "response.output_text.delta":
+			// Record the arrival of the text delta, the first one gives the first token latency
+			timer.token()
+			content.WriteString(event.Delta)
+		case "response.completed", "response.incomplete":
+			final = event.Response
+		case "response.failed", "error":
+			return nil, fmt.Errorf("%s", data)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading streaming response: %w", err)
+	}
+
+	response := final.toResponse(content.String())
+	response.Latency = time.Since(startTime)
+	timer.apply(response)
+	return response, nil
+}
+
+// outputText concatenates the output text parts of the message items
+func (r *responsesResult) outputText() string {
+	var content strings.Builder
+	for _, item := range r.Output {
+		if item.Type != "message" {
+			continue
+		}
+		for _, part := range item.Content {
+			if part.Type == "output_text" {
+				content.WriteString(part.Text)
+			}
+		}
+	}
+	return content.String()
+}
+
+// toResponse maps a Responses API result onto the common Response
+func (r *responsesResult) toResponse(content string) *Response {
+	finishReason := r.Status
+	if r.IncompleteDetails != nil && r.IncompleteDetails.Reason != "" {
+		finishReason = r.IncompleteDetails.Reason
+	}
+
+	response := &Response{
+		ID:    r.ID,
+		Model: r.Model,
+		Choices: []Choice{
+			{
+				FinishReason: finishReason,
+				Message: Message{
+					Role:    "assistant",
+					Content: content,
+				},
+			},
+		},
+		Usage: Usage{
+			PromptTokens:     r.Usage.InputTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+			TotalTokens:      r.Usage.TotalTokens,
+		},
+	}
+	if r.Usage.OutputTokensDetails.ReasoningTokens > 0 {
+		response.Usage.CompletionTokensDetails = &CompletionTokensDetails{
+			ReasoningTokens: r.Usage.OutputTokensDetails.ReasoningTokens,
+		}
+	}
+	if r.Usage.InputTokensDetails.CachedTokens > 0 {
+		response.Usage.PromptTokensDetails = &PromptTokensDetails{
+			CachedTokens: r.Usage.InputTokensDetails.CachedTokens,
+		}
+	}
+	return response
+}
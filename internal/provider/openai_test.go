@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIProvider_StreamingChunks(t *testing.T) {
+	chunks := []string{
+		`{"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"reasoning_content":"Hmm"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`{"id":"c1","choices":[],"usage":{"prompt_tokens":4,"completion_tokens":2,"total_tokens":6,"prompt_tokens_details":{"cached_tokens":3}}}`,
+		`[DONE]`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+			if i == 0 {
+				// The role-only chunk comes well before the first token
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider("key", server.URL, "gpt", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"stream": true}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The empty delta of the finishing chunk must not repeat the previous content
+	assert.Equal(t, "Hello", resp.Choices[0].Message.Content)
+	assert.Equal(t, "assistant", resp.Choices[0].Message.Role)
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+	assert.Equal(t, 6, resp.Usage.TotalTokens)
+	assert.Equal(t, 3, resp.Usage.PromptTokensDetails.CachedTokens)
+
+	// Only the chunks carrying reasoning or content are tokens, not the role, finish reason and usage ones
+	assert.GreaterOrEqual(t, resp.FirstTokenLatency, 50*time.Millisecond)
+	assert.Len(t, resp.InterTokenLatencies, 2)
+	assert.Equal(t, 3, resp.StreamChunks)
+}
+
+func TestOpenAICompletionsProvider(t *testing.T) {
+	chunks := []string{
+		`{"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":"Once","finish_reason":null}]}`,
+		`{"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":" upon","finish_reason":"length"}]}`,
+		`{"id":"cmpl-1","object":"text_completion","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}`,
+		`[DONE]`,
+	}
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+
+		if received["stream"] == true {
+			for _, chunk := range chunks {
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"id":"cmpl-2","choices":[{"index":0,"text":"Once upon","finish_reason":"length"}],`+
+			`"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAICompletionsProvider("key", server.URL, "gpt", time.Second*10)
+
+	// Messages are flattened into a raw prompt
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"stream": true}, AnyParams{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "Tell a story."},
+			map[string]any{"role": "user", "content": "About a cat."},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Tell a story.\n\nAbout a cat.", received["prompt"])
+	assert.NotContains(t, received, "messages")
+	assert.Equal(t, "Once upon", resp.Choices[0].Message.Content)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, 2, resp.Usage.CompletionTokens)
+	assert.NotZero(t, resp.FirstTokenLatency)
+
+	// A raw prompt is sent as it is
+	resp, err = provider.SendRequest(context.Background(), AnyParams{"stream": false}, AnyParams{"prompt": "Once"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Once", received["prompt"])
+	assert.Equal(t, "Once upon", resp.Choices[0].Message.Content)
+	assert.Equal(t, 9, resp.Usage.TotalTokens)
+}
+
+func TestOpenAIProvider_Embeddings(t *testing.T) {
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		fmt.Fprint(w, `{"object":"list","model":"bge","data":[`+
+			`{"object":"embedding","index":0,"embedding":[0.1,0.2]},`+
+			`{"object":"embedding","index":1,"embedding":[0.3,0.4]}],`+
+			`"usage":{"prompt_tokens":9,"total_tokens":9}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIEmbeddingsProvider("key", server.URL, "bge", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "bge", "stream": true, "stream_options": map[string]any{"include_usage": true}}, AnyParams{
+		"input": []any{"first", "second"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []any{"first", "second"}, received["input"])
+	assert.NotContains(t, received, "stream")
+	assert.NotContains(t, received, "stream_options")
+
+	assert.Equal(t, 2, resp.Embeddings)
+	assert.Equal(t, 9, resp.Usage.PromptTokens)
+	assert.Zero(t, resp.Usage.CompletionTokens)
+	assert.Zero(t, resp.FirstTokenLatency)
+	assert.NotZero(t, resp.Latency)
+}
+
+func TestToEmbeddingsRequest(t *testing.T) {
+	body := AnyParams{
+		"messages":   []any{map[string]any{"role": "user", "content": "Hello"}},
+		"max_tokens": 100,
+	}
+	toEmbeddingsRequest(body)
+
+	assert.Equal(t, "Hello", body["input"])
+	assert.NotContains(t, body, "messages")
+	assert.NotContains(t, body, "max_tokens")
+}
+
+func TestOpenAIProvider_ResponsesStreaming(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","response":{"id":"resp_1","status":"in_progress"}}`,
+		`{"type":"response.reasoning_summary_text.delta","delta":"thinking"}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","output_index":1,"content_index":0,"delta":"Hello"}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","output_index":1,"content_index":0,"delta":" world"}`,
+		`{"type":"response.completed","response":{"id":"resp_1","model":"o4-mini","status":"completed",` +
+			`"usage":{"input_tokens":7,"output_tokens":40,"total_tokens":47,"output_tokens_details":{"reasoning_tokens":32}}}}`,
+	}
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		for _, event := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIResponsesProvider("key", server.URL, "o4-mini", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "o4-mini", "stream": true, "stream_options": map[string]any{"include_usage": true}}, AnyParams{
+		"messages":               []Message{{Role: "user", Content: "Hello"}},
+		"max_tokens":             64,
+		"extra_body":             map[string]any{"top_k": 20},
+		"truncate_prompt_tokens": 1024,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Request translation
+	assert.Len(t, received["input"], 1)
+	assert.EqualValues(t, 64, received["max_output_tokens"])
+	assert.NotContains(t, received, "messages")
+	assert.NotContains(t, received, "max_tokens")
+	assert.NotContains(t, received, "stream_options")
+	assert.NotContains(t, received, "extra_body")
+	assert.NotContains(t, received, "truncate_prompt_tokens")
+
+	// Response parsing
+	assert.Equal(t, "resp_1", resp.ID)
+	assert.Equal(t, "Hello world", resp.Choices[0].Message.Content)
+	assert.Equal(t, "completed", resp.Choices[0].FinishReason)
+	assert.Equal(t, 7, resp.Usage.PromptTokens)
+	assert.Equal(t, 40, resp.Usage.CompletionTokens)
+	if assert.NotNil(t, resp.Usage.CompletionTokensDetails) {
+		assert.Equal(t, 32, resp.Usage.CompletionTokensDetails.ReasoningTokens)
+	}
+	assert.NotZero(t, resp.FirstTokenLatency)
+}
+
+func TestOpenAIProvider_ResponsesNoStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"resp_2","model":"gpt","status":"incomplete","incomplete_details":{"reason":"max_output_tokens"},`+
+			`"output":[{"type":"reasoning","summary":[]},{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Hi"}]}],`+
+			`"usage":{"input_tokens":3,"output_tokens":8,"total_tokens":11,"output_tokens_details":{"reasoning_tokens":7}}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIResponsesProvider("key", server.URL, "gpt", time.Second*10)
+	resp, err := provider.SendRequest(context.Background(), AnyParams{"model": "gpt"}, AnyParams{
+		"messages": []Message{{Role: "user", Content: "Hello"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+	assert.Equal(t, "max_output_tokens", resp.Choices[0].FinishReason)
+	assert.Equal(t, 11, resp.Usage.TotalTokens)
+	assert.Equal(t, 7, resp.Usage.CompletionTokensDetails.ReasoningTokens)
+	assert.Equal(t, resp.Latency, resp.FirstTokenLatency)
+}
@@ -1,7 +1,12 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/FortuneW/qlog"
@@ -12,8 +17,9 @@ type Provider interface {
 	// Name returns the provider name
 	Name() string
 
-	// SendRequest sends a request to the LLM and returns the response
-	SendRequest(priorityParams AnyParams, anyParam AnyParams, headers map[string]string) (*Response, *Error)
+	// SendRequest sends a request to the LLM and returns the response,
+	// cancelling ctx aborts the request and closes its stream
+	SendRequest(ctx context.Context, priorityParams AnyParams, anyParam AnyParams, headers map[string]string) (*Response, *Error)
 
 	// SupportsStreaming returns whether the provider supports streaming
 	SupportsStreaming() bool
@@ -34,12 +40,24 @@ type Response struct {
 	Choices []Choice `json:"choices,omitempty"`
 	Usage   Usage    `json:"usage"`
 	// local fields
-	Latency           time.Duration `json:"-"`
-	FirstTokenLatency time.Duration `json:"-"` // Streaming specific fields
+	Latency             time.Duration   `json:"-"`
+	FirstTokenLatency   time.Duration   `json:"-"` // Streaming specific fields
+	ServerTiming        *ServerTiming   `json:"-"` // Server-side timing, if reported by the provider
+	InterTokenLatencies []time.Duration `json:"-"` // Gaps between consecutive streamed chunks
+	StreamChunks        int             `json:"-"` // Number of streamed chunks, which usually carry a token each
+	Embeddings          int             `json:"-"` // Number of embeddings returned by an embeddings request
 
 	JsonData string `json:"-"`
 }
 
+// ServerTiming represents the timing reported by the inference server itself
+type ServerTiming struct {
+	LoadDuration    time.Duration // time spent loading the model
+	PrefillDuration time.Duration // time spent evaluating the prompt
+	DecodeDuration  time.Duration // time spent generating the response
+	TotalDuration   time.Duration // total time spent by the server
+}
+
 func (r *Response) String() string {
 	if len(r.JsonData) > 0 {
 		return r.JsonData
@@ -54,18 +72,161 @@ type Choice struct {
 	Message      Message `json:"message"`
 	FinishReason string  `json:"finish_reason"`
 
+	// for text completions
+	Text string `json:"text,omitempty"`
+
 	// for stream
 	Delta *struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+		Role             string `json:"role"`
+		Content          string `json:"content"`
+		ReasoningContent string `json:"reasoning_content,omitempty"` // reasoning text of vLLM and DeepSeek
+		Reasoning        string `json:"reasoning,omitempty"`         // reasoning text of OpenRouter and Ollama
 	} `json:"delta,omitempty"`
 }
 
+// hasToken returns whether a streamed choice carries generated text, unlike the role-only first delta
+// or the empty delta of the finish reason
+func (c *Choice) hasToken() bool {
+	if c.Delta == nil {
+		return c.Text != ""
+	}
+	return c.Delta.Content != "" || c.Delta.ReasoningContent != "" || c.Delta.Reasoning != ""
+}
+
 // Usage represents token usage information
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails represents the breakdown of the prompt tokens
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"` // prompt tokens served from the prefix cache
+}
+
+// CompletionTokensDetails represents the breakdown of the completion tokens
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
 }
 
 var mlog = qlog.GetRLog("API")
+
+// newHTTPClient creates the HTTP client shared by the HTTP based providers
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > 3 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// mergeParams merges the dataset params and the priority params into a new request body,
+// priority params overwrite keys with the same name
+func mergeParams(priorityParams, anyParam AnyParams) AnyParams {
+	body := make(AnyParams, len(anyParam)+len(priorityParams))
+	maps.Copy(body, anyParam)
+	maps.Copy(body, priorityParams)
+	return body
+}
+
+// decodeMessages converts the OpenAI style "messages" field of a request into typed messages
+func decodeMessages(v any) ([]Message, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if messages, ok := v.([]Message); ok {
+		return messages, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal messages: %w", err)
+	}
+	var messages []Message
+	if err := json.Unmarshal(b, &messages); err != nil {
+		return nil, fmt.Errorf("failed to parse messages: %w", err)
+	}
+	return messages, nil
+}
+
+// messageText extracts the plain text of a message content, which is either a string
+// or an array of OpenAI style content parts
+func messageText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []any:
+		var sb strings.Builder
+		for _, part := range c {
+			if m, ok := part.(map[string]any); ok {
+				if text, ok := m["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// messagesPrompt joins the message contents of an OpenAI style "messages" field into a raw prompt,
+// without any chat template
+func messagesPrompt(v any) (string, bool) {
+	messages, err := decodeMessages(v)
+	if err != nil || len(messages) == 0 {
+		return "", false
+	}
+	texts := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		texts = append(texts, messageText(msg.Content))
+	}
+	return strings.Join(texts, "\n\n"), true
+}
+
+// streamTimer records the arrival times of the chunks of a streaming response
+type streamTimer struct {
+	start               time.Time
+	last                time.Time
+	firstTokenLatency   time.Duration
+	interTokenLatencies []time.Duration
+	chunks              int
+}
+
+// newStreamTimer creates a streamTimer for a request sent at start
+func newStreamTimer(start time.Time) *streamTimer {
+	return &streamTimer{start: start}
+}
+
+// token records the arrival of a chunk, the first one gives the first token latency
+// and the next ones an inter-token latency each
+func (t *streamTimer) token() {
+	now := time.Now()
+	if t.last.IsZero() {
+		t.firstTokenLatency = now.Sub(t.start)
+	} else {
+		t.interTokenLatencies = append(t.interTokenLatencies, now.Sub(t.last))
+	}
+	t.last = now
+	t.chunks++
+}
+
+// apply sets the recorded timing of the response
+func (t *streamTimer) apply(resp *Response) {
+	resp.FirstTokenLatency = t.firstTokenLatency
+	resp.InterTokenLatencies = t.interTokenLatencies
+	resp.StreamChunks = t.chunks
+}
+
+// sseData returns the payload of a server-sent events "data:" line
+func sseData(line string) (string, bool) {
+	if !strings.HasPrefix(line, "data:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+}
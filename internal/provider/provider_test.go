@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"testing"
@@ -39,7 +40,7 @@ func TestOpenAIProvider_OpenAI(t *testing.T) {
 		"max_tokens": 100,
 	}
 
-	resp, err := provider.SendRequest(priorityParam, anyParams, nil)
+	resp, err := provider.SendRequest(context.Background(), priorityParam, anyParams, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -69,7 +70,7 @@ func TestOpenAIProvider_Qwen(t *testing.T) {
 		},
 	}
 
-	resp, err := provider.SendRequest(priorityParam, anyParams, nil)
+	resp, err := provider.SendRequest(context.Background(), priorityParam, anyParams, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -110,7 +111,7 @@ func TestOpenAIProvider_Streaming(t *testing.T) {
 		},
 	}
 
-	resp, err := provider.SendRequest(priorityParam, anyParams, nil)
+	resp, err := provider.SendRequest(context.Background(), priorityParam, anyParams, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
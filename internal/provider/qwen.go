@@ -1,6 +1,24 @@
 package provider
 
-import "time"
+import (
+	"context"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+const qwenDefaultEndpoint = "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions"
+
+func init() {
+	Register(Registration{
+		Name:            "qwen",
+		Description:     "Alibaba Cloud DashScope OpenAI compatible API",
+		DefaultEndpoint: qwenDefaultEndpoint,
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			return NewQwenProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+		},
+	})
+}
 
 // QwenProvider implements the Provider interface for Qwen(same as OpenAI)
 type QwenProvider struct {
@@ -10,7 +28,7 @@ type QwenProvider struct {
 // NewQwenProvider creates a new QwenProvider
 func NewQwenProvider(apiKey, endpoint, model string, timeout time.Duration) *QwenProvider {
 	if endpoint == "" {
-		endpoint = "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions"
+		endpoint = qwenDefaultEndpoint
 		mlog.Infof("Created Qwen provider [%s] with model [%s]", endpoint, model)
 	}
 	return &QwenProvider{
@@ -24,8 +42,8 @@ func (p *QwenProvider) Name() string {
 }
 
 // SendRequest sends a request to Qwen API
-func (p *QwenProvider) SendRequest(priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
-	return p.oai.SendRequest(priorityParams, anyParam, headers)
+func (p *QwenProvider) SendRequest(ctx context.Context, priorityParams, anyParam AnyParams, headers map[string]string) (*Response, *Error) {
+	return p.oai.SendRequest(ctx, priorityParams, anyParam, headers)
 }
 
 // SupportsStreaming returns whether Qwen supports streaming
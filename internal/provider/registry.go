@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+)
+
+// Factory creates a provider from the model configuration
+type Factory func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error)
+
+// Registration describes a provider which can be selected with model.provider.
+//
+// Providers register themselves from an init function, so that a provider living in its own file,
+// optionally behind a build tag (e.g. //go:build mygateway), is built in without editing the cmd code:
+//
+//	func init() {
+//		Register(Registration{Name: "mygateway", DefaultEndpoint: "...", New: newMyGateway})
+//	}
+type Registration struct {
+	Name            string
+	Description     string
+	DefaultEndpoint string
+	// Schema is a pointer to the zero value of the provider specific config section model.<name>,
+	// whose keys are taken from the json tags. Nil if the provider has no such section.
+	Schema any
+	New    Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Registration)
+)
+
+// Register registers a provider, registering the same name twice panics
+func Register(r Registration) {
+	if r.Name == "" || r.New == nil {
+		panic("provider: Register needs a name and a factory")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[r.Name]; exists {
+		panic(fmt.Sprintf("provider: %s is already registered", r.Name))
+	}
+	registry[r.Name] = r
+}
+
+// Lookup returns the registration of a provider
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Registrations returns all the registered providers sorted by name
+func Registrations() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]Registration, 0, len(registry))
+	for _, r := range registry {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Names returns the names of the registered providers sorted by name
+func Names() []string {
+	list := Registrations()
+	names := make([]string, len(list))
+	for i, r := range list {
+		names[i] = r.Name
+	}
+	return names
+}
+
+// New creates the provider selected by model.provider
+func New(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+	r, ok := Lookup(cfg.Provider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s, registered providers: %s", cfg.Provider, strings.Join(Names(), ", "))
+	}
+	return r.New(cfg, timeout)
+}
+
+// DecodeSection decodes the provider specific config section model.<name> into out,
+// unknown keys are rejected so that typos are not silently ignored
+func DecodeSection(cfg *config.ModelConfig, name string, out any) error {
+	section, ok := cfg.Sections[name]
+	if !ok || section == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(section)
+	if err != nil {
+		return fmt.Errorf("invalid model.%s config: %w", name, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid model.%s config: %w", name, err)
+	}
+	return nil
+}
+
+// SchemaKeys returns the config keys of a registration schema
+func (r Registration) SchemaKeys() []string {
+	if r.Schema == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(r.Schema)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
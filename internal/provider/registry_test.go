@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_BuiltinProviders(t *testing.T) {
+	assert.Subset(t, Names(), []string{"anthropic", "azure", "gemini", "generic", "ollama", "openai", "qwen"})
+
+	prov, err := New(&config.ModelConfig{Provider: "openai", APIKind: APIKindEmbeddings}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "openai", prov.Name())
+
+	_, err = New(&config.ModelConfig{Provider: "openai", APIKind: "unknown"}, time.Second)
+	assert.Error(t, err)
+}
+
+func TestRegistry_UnknownProvider(t *testing.T) {
+	_, err := New(&config.ModelConfig{Provider: "nope"}, time.Second)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unsupported provider: nope")
+		assert.Contains(t, err.Error(), "anthropic, azure, gemini, generic, ollama, openai, qwen")
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	Register(Registration{
+		Name: "test-gateway",
+		New: func(cfg *config.ModelConfig, timeout time.Duration) (Provider, error) {
+			return NewOpenAIProvider(cfg.ApiKey, cfg.Endpoint, cfg.Name, timeout), nil
+		},
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-gateway")
+		registryMu.Unlock()
+	}()
+
+	r, ok := Lookup("test-gateway")
+	assert.True(t, ok)
+	assert.Equal(t, "test-gateway", r.Name)
+	assert.Panics(t, func() {
+		Register(r)
+	})
+}
+
+func TestDecodeSection(t *testing.T) {
+	cfg := &config.ModelConfig{
+		Sections: map[string]interface{}{
+			"azure": map[string]interface{}{"deployment": "prod", "api_version": "2025-01-01"},
+		},
+	}
+
+	var opts AzureOptions
+	assert.NoError(t, DecodeSection(cfg, "azure", &opts))
+	assert.Equal(t, "prod", opts.Deployment)
+	assert.Equal(t, "2025-01-01", opts.APIVersion)
+
+	cfg.Sections["azure"] = map[string]interface{}{"deploymnet": "typo"}
+	assert.Error(t, DecodeSection(cfg, "azure", &opts))
+
+	r, _ := Lookup("azure")
+	assert.Equal(t, []string{"deployment", "api_version", "ad_token_file", "ad_token_command"}, r.SchemaKeys())
+}
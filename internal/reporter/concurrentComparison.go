@@ -6,15 +6,92 @@ import (
 	"github.com/FortuneW/gollmperf/internal/analyzer"
 )
 
+// StageAll is the stage label of the metrics of a whole staged or session test
+const StageAll = "all"
+
 // ConcurrentTestResult holds the results of a single concurrent test
 type ConcurrentTestResult struct {
-	Concurrency int               `json:"concurrency"`
-	Metrics     *analyzer.Metrics `json:"metrics"`
+	Concurrency int                 `json:"concurrency"`
+	RequestRate float64             `json:"request_rate,omitempty"` // target requests per second of an open-loop test
+	Stage       string              `json:"stage,omitempty"`        // stage of a staged load profile or turn of a session test, "all" for the whole test
+	SLO         *analyzer.SLOResult `json:"slo,omitempty"`          // SLO check of a probe of seek mode
+	Metrics     *analyzer.Metrics   `json:"metrics"`
+}
+
+// Label returns the load level of the test: the stage of a staged test,
+// the request rate of an open-loop test or the concurrency
+func (r ConcurrentTestResult) Label() string {
+	if r.Stage != "" {
+		return r.Stage
+	}
+	if r.RequestRate > 0 {
+		return fmt.Sprintf("%.2f req/s", r.RequestRate)
+	}
+	return fmt.Sprintf("%d", r.Concurrency)
+}
+
+// SLOStatus returns pass or fail of the SLO check, or an empty string if the SLOs were not checked
+func (r ConcurrentTestResult) SLOStatus() string {
+	if r.SLO == nil {
+		return ""
+	}
+	if r.SLO.Passed {
+		return "pass"
+	}
+	return "fail"
 }
 
 // ConcurrentComparison holds multiple concurrent test results for comparison
 type ConcurrentComparison struct {
 	TestResults []ConcurrentTestResult `json:"test_results"`
+	Seek        *SeekResult            `json:"seek,omitempty"`
+}
+
+// SeekResult holds the outcome of seek mode
+type SeekResult struct {
+	MaxConcurrency int `json:"max_concurrency"` // highest concurrency at which the SLOs hold, 0 if none
+	Probes         int `json:"probes"`
+}
+
+// HasDecodeMetrics returns whether any test result has inter-token latency or time per output token metrics
+func (c *ConcurrentComparison) HasDecodeMetrics() bool {
+	for _, result := range c.TestResults {
+		if result.Metrics.AverageInterTokenLatency > 0 || result.Metrics.AverageTimePerOutputToken > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasEmbeddings returns whether any test result comes from embeddings requests
+func (c *ConcurrentComparison) HasEmbeddings() bool {
+	for _, result := range c.TestResults {
+		if result.Metrics.AverageBatchSize > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSLO returns whether any test result has an SLO check
+func (c *ConcurrentComparison) HasSLO() bool {
+	for _, result := range c.TestResults {
+		if result.SLO != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// StageResults returns the results of the stages of a staged test or the turns of a session test, without the whole test
+func (c *ConcurrentComparison) StageResults() []ConcurrentTestResult {
+	var stages []ConcurrentTestResult
+	for _, result := range c.TestResults {
+		if result.Stage != "" && result.Stage != StageAll {
+			stages = append(stages, result)
+		}
+	}
+	return stages
 }
 
 // GetBestQPS returns the test result with the highest QPS
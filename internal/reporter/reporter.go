@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/FortuneW/gollmperf/internal/analyzer"
+	"github.com/FortuneW/gollmperf/internal/engine"
 	"github.com/FortuneW/qlog"
 )
 
@@ -44,13 +46,73 @@ func (r *Reporter) AddNewMetrics(concurrency int, metrics *analyzer.Metrics) {
 	r.metrics = metrics // current metrics
 }
 
+// AddNewRateMetrics adds the metrics of an open-loop test at a request rate to the reporter
+func (r *Reporter) AddNewRateMetrics(requestRate float64, metrics *analyzer.Metrics) {
+	r.concurrentComparison.TestResults = append(r.concurrentComparison.TestResults, ConcurrentTestResult{
+		RequestRate: requestRate,
+		Metrics:     metrics,
+	})
+	r.metrics = metrics // current metrics
+}
+
+// AddNewStageMetrics adds the metrics of a stage of a staged test or of a turn of a session test to the reporter,
+// with the target concurrency or request rate at the end of the stage
+func (r *Reporter) AddNewStageMetrics(stage string, concurrency int, requestRate float64, metrics *analyzer.Metrics) {
+	r.concurrentComparison.TestResults = append(r.concurrentComparison.TestResults, ConcurrentTestResult{
+		Concurrency: concurrency,
+		RequestRate: requestRate,
+		Stage:       stage,
+		Metrics:     metrics,
+	})
+	r.metrics = metrics // current metrics
+}
+
+// AddNewSeekMetrics adds the metrics of a probe of seek mode to the reporter, with its SLO check.
+// Probes are kept sorted by concurrency, as the search does not probe in order.
+func (r *Reporter) AddNewSeekMetrics(concurrency int, metrics *analyzer.Metrics, slo *analyzer.SLOResult) {
+	results := r.concurrentComparison.TestResults
+	i := sort.Search(len(results), func(i int) bool {
+		return results[i].Concurrency > concurrency
+	})
+	results = append(results, ConcurrentTestResult{})
+	copy(results[i+1:], results[i:])
+	results[i] = ConcurrentTestResult{
+		Concurrency: concurrency,
+		Metrics:     metrics,
+		SLO:         slo,
+	}
+	r.concurrentComparison.TestResults = results
+	r.metrics = metrics // current metrics
+}
+
+// SetSeekResult sets the highest concurrency at which the SLOs hold found by seek mode
+func (r *Reporter) SetSeekResult(maxConcurrency int) {
+	r.concurrentComparison.Seek = &SeekResult{
+		MaxConcurrency: maxConcurrency,
+		Probes:         len(r.concurrentComparison.TestResults),
+	}
+}
+
+// GetTestResults returns the test results added to the reporter
+func (r *Reporter) GetTestResults() []ConcurrentTestResult {
+	return r.concurrentComparison.TestResults
+}
+
 // GenerateConsoleReport generates a console report
 func (r *Reporter) GenerateConsoleReport() {
 	mlog.Info("========== gollmperf Performance Report ==========")
+	if results := r.concurrentComparison.TestResults; len(results) > 0 {
+		if current := results[len(results)-1]; current.Stage == "" && current.RequestRate > 0 {
+			mlog.Infof("Offered Load: %s", current.Label())
+		}
+	}
 	mlog.Infof("Total Duration: %v", r.metrics.TotalDuration)
 	mlog.Infof("Total Requests: %d", r.metrics.TotalRequests)
 	mlog.Infof("Successful Requests: %d", r.metrics.SuccessfulRequests)
 	mlog.Infof("Failed Requests: %d", r.metrics.FailedRequests)
+	if r.metrics.CancelledRequests > 0 {
+		mlog.Warnf("Cancelled Requests: %d (test interrupted)", r.metrics.CancelledRequests)
+	}
 	mlog.Infof("Success Rate: %.2f%%", r.metrics.SuccessRate)
 
 	if r.metrics.SuccessfulRequests > 0 {
@@ -63,6 +125,25 @@ func (r *Reporter) GenerateConsoleReport() {
 
 		mlog.Infof("Average Request Tokens: %.2f", r.metrics.AverageRequestTokens)
 		mlog.Infof("Average Response Tokens: %.2f", r.metrics.AverageResponseTokens)
+		if r.metrics.AverageReasoningTokens > 0 {
+			mlog.Infof("Average Reasoning Tokens: %.2f", r.metrics.AverageReasoningTokens)
+		}
+		if r.metrics.AverageCachedTokens > 0 {
+			mlog.Infof("Average Cached Tokens: %.2f", r.metrics.AverageCachedTokens)
+			mlog.Infof("Cache Hit Rate: %.2f%%", r.metrics.CacheHitRate)
+		}
+		if sources := r.metrics.TokenSources; len(sources) > 0 && sources[engine.TokenSourceUsage] < r.metrics.SuccessfulRequests {
+			mlog.Warnf("Token Sources: %s (client-side estimates where the server reported no usage)", formatCounts(sources))
+		}
+		if v := r.metrics.UsageValidation; v != nil {
+			line := fmt.Sprintf("Usage Validation: %d of %d mismatched (%.2f%%), reported/estimated request tokens %.2f, response tokens %.2f",
+				v.Mismatched, v.Compared, v.MismatchRate, v.RequestTokensRatio, v.ResponseTokensRatio)
+			if v.Mismatched > 0 {
+				mlog.Warn(line)
+			} else {
+				mlog.Info(line)
+			}
+		}
 
 		if r.metrics.AverageFirstTokenLatency > 0 {
 			mlog.Infof("Average First Token Latency: %v", r.metrics.AverageFirstTokenLatency)
@@ -70,6 +151,52 @@ func (r *Reporter) GenerateConsoleReport() {
 			mlog.Infof("First Token Latency P90: %v", r.metrics.FirstTokenLatencyP90)
 			mlog.Infof("First Token Latency P99: %v", r.metrics.FirstTokenLatencyP99)
 		}
+
+		if r.metrics.AverageInterTokenLatency > 0 {
+			mlog.Infof("Average Inter-Token Latency: %v", r.metrics.AverageInterTokenLatency)
+			mlog.Infof("Inter-Token Latency P50: %v", r.metrics.InterTokenLatencyP50)
+			mlog.Infof("Inter-Token Latency P90: %v", r.metrics.InterTokenLatencyP90)
+			mlog.Infof("Inter-Token Latency P99: %v", r.metrics.InterTokenLatencyP99)
+		}
+
+		if r.metrics.AverageTimePerOutputToken > 0 {
+			mlog.Infof("Average Time per Output Token: %v", r.metrics.AverageTimePerOutputToken)
+			mlog.Infof("Time per Output Token P50: %v", r.metrics.TimePerOutputTokenP50)
+			mlog.Infof("Time per Output Token P90: %v", r.metrics.TimePerOutputTokenP90)
+			mlog.Infof("Time per Output Token P99: %v", r.metrics.TimePerOutputTokenP99)
+			mlog.Infof("Decode Tokens per second (per request): %.2f", r.metrics.DecodeTokensPerSecond)
+		}
+
+		if r.metrics.AverageServerPrefillTime > 0 || r.metrics.AverageServerDecodeTime > 0 {
+			mlog.Infof("Average Server Load Time: %v", r.metrics.AverageServerLoadTime)
+			mlog.Infof("Average Server Prefill Time: %v", r.metrics.AverageServerPrefillTime)
+			mlog.Infof("Average Server Decode Time: %v", r.metrics.AverageServerDecodeTime)
+			mlog.Infof("Server Prefill Tokens per second: %.2f", r.metrics.ServerPrefillTokensPerSecond)
+			mlog.Infof("Server Decode Tokens per second: %.2f", r.metrics.ServerDecodeTokensPerSecond)
+		}
+
+		if r.metrics.AverageBatchSize > 0 {
+			mlog.Infof("Embeddings per second: %.2f", r.metrics.EmbeddingsPerSecond)
+			mlog.Infof("Input Tokens per second: %.2f", r.metrics.InputTokensPerSecond)
+			mlog.Infof("Average Batch Size: %.2f", r.metrics.AverageBatchSize)
+		}
+	}
+
+	if stages := r.concurrentComparison.StageResults(); len(stages) > 0 {
+		mlog.Info("Breakdown:")
+		for _, stage := range stages {
+			line := fmt.Sprintf("  %s: requests %d, success rate %.2f%%, QPS %.2f, average latency %v, latency P99 %v, first token latency P50 %v, P99 %v",
+				stage.Stage, stage.Metrics.TotalRequests, stage.Metrics.SuccessRate, stage.Metrics.QPS,
+				stage.Metrics.AverageLatency, stage.Metrics.LatencyP99, stage.Metrics.FirstTokenLatencyP50, stage.Metrics.FirstTokenLatencyP99)
+			if stage.Metrics.AverageCachedTokens > 0 {
+				line += fmt.Sprintf(", cache hit rate %.2f%%", stage.Metrics.CacheHitRate)
+			}
+			mlog.Info(line)
+		}
+	}
+
+	if seek := r.concurrentComparison.Seek; seek != nil {
+		mlog.Infof("Max Sustainable Concurrency: %d (%d probes)", seek.MaxConcurrency, seek.Probes)
 	}
 
 	if len(r.metrics.ErrorTypeCounts) > 0 {
@@ -127,3 +254,17 @@ func (r *Reporter) GenerateFileReport(reportFile, reportFormat string) error {
 	}
 	return nil
 }
+
+// formatCounts formats counts as "key count" pairs sorted by key
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s %d", key, counts[key])
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -17,7 +17,11 @@ func (r *Reporter) GenerateCSVReport(filename string) error {
 	header := "concurrency,total_requests,successful_requests,failed_requests,success_rate,qps,tokens_per_second," +
 		"average_latency,latency_p50,latency_p90,latency_p99," +
 		"average_request_tokens,average_response_tokens," +
-		"average_first_token_latency,first_token_latency_p50,first_token_latency_p90,first_token_latency_p99\n"
+		"average_first_token_latency,first_token_latency_p50,first_token_latency_p90,first_token_latency_p99," +
+		"embeddings_per_second,input_tokens_per_second,average_batch_size,average_reasoning_tokens," +
+		"average_inter_token_latency,inter_token_latency_p50,inter_token_latency_p90,inter_token_latency_p99," +
+		"average_time_per_output_token,time_per_output_token_p50,time_per_output_token_p90,time_per_output_token_p99," +
+		"decode_tokens_per_second,request_rate,stage,slo,cancelled_requests,average_cached_tokens,cache_hit_rate\n"
 
 	if _, err := file.WriteString(header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
@@ -25,7 +29,7 @@ func (r *Reporter) GenerateCSVReport(filename string) error {
 
 	for _, result := range r.concurrentComparison.TestResults {
 		// Write data row
-		row := fmt.Sprintf("%d,%d,%d,%d,%.2f,%.2f,%.2f,%d,%d,%d,%d,%.2f,%.2f,%d,%d,%d,%d\n",
+		row := fmt.Sprintf("%d,%d,%d,%d,%.2f,%.2f,%.2f,%d,%d,%d,%d,%.2f,%.2f,%d,%d,%d,%d,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%.2f,%s,%s,%d,%.2f,%.2f\n",
 			result.Concurrency,
 			result.Metrics.TotalRequests,
 			result.Metrics.SuccessfulRequests,
@@ -43,6 +47,25 @@ func (r *Reporter) GenerateCSVReport(filename string) error {
 			result.Metrics.FirstTokenLatencyP50.Milliseconds(),
 			result.Metrics.FirstTokenLatencyP90.Milliseconds(),
 			result.Metrics.FirstTokenLatencyP99.Milliseconds(),
+			result.Metrics.EmbeddingsPerSecond,
+			result.Metrics.InputTokensPerSecond,
+			result.Metrics.AverageBatchSize,
+			result.Metrics.AverageReasoningTokens,
+			result.Metrics.AverageInterTokenLatency.FloatMilliseconds(),
+			result.Metrics.InterTokenLatencyP50.FloatMilliseconds(),
+			result.Metrics.InterTokenLatencyP90.FloatMilliseconds(),
+			result.Metrics.InterTokenLatencyP99.FloatMilliseconds(),
+			result.Metrics.AverageTimePerOutputToken.FloatMilliseconds(),
+			result.Metrics.TimePerOutputTokenP50.FloatMilliseconds(),
+			result.Metrics.TimePerOutputTokenP90.FloatMilliseconds(),
+			result.Metrics.TimePerOutputTokenP99.FloatMilliseconds(),
+			result.Metrics.DecodeTokensPerSecond,
+			result.RequestRate,
+			result.Stage,
+			result.SLOStatus(),
+			result.Metrics.CancelledRequests,
+			result.Metrics.AverageCachedTokens,
+			result.Metrics.CacheHitRate,
 		)
 
 		if _, err := file.WriteString(row); err != nil {
@@ -34,9 +34,22 @@ func (r *Reporter) GenerateConsoleTableReport() {
 		"1stP50",
 		"1stP90",
 		"1stP99",
+		"ITLAvg",
+		"ITLP99",
+		"TPOT",
+		"TPOTP99",
+		"Dec/s",
 		"ReqToks",
 		"ResToks",
 	}
+	hasEmbeddings := r.concurrentComparison.HasEmbeddings()
+	if hasEmbeddings {
+		headers = append(headers, "Emb/s", "InToks/s", "Batch")
+	}
+	hasSLO := r.concurrentComparison.HasSLO()
+	if hasSLO {
+		headers = append(headers, "SLO")
+	}
 
 	var data [][]string
 	for _, result := range r.concurrentComparison.TestResults {
@@ -48,7 +61,7 @@ func (r *Reporter) GenerateConsoleTableReport() {
 		}
 
 		row := []string{
-			fmt.Sprintf("%d", result.Concurrency),
+			result.Label(),
 			reqsCell,
 			fmt.Sprintf("%.2f", result.Metrics.TotalDuration.Seconds()),
 			fmt.Sprintf("%.2f", result.Metrics.QPS),
@@ -61,9 +74,24 @@ func (r *Reporter) GenerateConsoleTableReport() {
 			fmt.Sprintf("%d", result.Metrics.FirstTokenLatencyP50.Milliseconds()),
 			fmt.Sprintf("%d", result.Metrics.FirstTokenLatencyP90.Milliseconds()),
 			fmt.Sprintf("%d", result.Metrics.FirstTokenLatencyP99.Milliseconds()),
+			fmt.Sprintf("%.1f", result.Metrics.AverageInterTokenLatency.FloatMilliseconds()),
+			fmt.Sprintf("%.1f", result.Metrics.InterTokenLatencyP99.FloatMilliseconds()),
+			fmt.Sprintf("%.1f", result.Metrics.AverageTimePerOutputToken.FloatMilliseconds()),
+			fmt.Sprintf("%.1f", result.Metrics.TimePerOutputTokenP99.FloatMilliseconds()),
+			fmt.Sprintf("%.1f", result.Metrics.DecodeTokensPerSecond),
 			fmt.Sprintf("%.1f", result.Metrics.AverageRequestTokens),
 			fmt.Sprintf("%.1f", result.Metrics.AverageResponseTokens),
 		}
+		if hasEmbeddings {
+			row = append(row,
+				fmt.Sprintf("%.2f", result.Metrics.EmbeddingsPerSecond),
+				fmt.Sprintf("%.2f", result.Metrics.InputTokensPerSecond),
+				fmt.Sprintf("%.1f", result.Metrics.AverageBatchSize),
+			)
+		}
+		if hasSLO {
+			row = append(row, result.SLOStatus())
+		}
 		data = append(data, row)
 	}
 
@@ -0,0 +1,95 @@
+package reporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/analyzer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporter_GenerateFileReport(t *testing.T) {
+	r := NewReporter()
+	r.AddNewMetrics(1, &analyzer.Metrics{
+		TotalRequests:             10,
+		SuccessfulRequests:        10,
+		QPS:                       2,
+		AverageLatency:            analyzer.Duration(time.Second),
+		AverageInterTokenLatency:  analyzer.Duration(12500 * time.Microsecond),
+		AverageTimePerOutputToken: analyzer.Duration(11 * time.Millisecond),
+		DecodeTokensPerSecond:     90.9,
+		EmbeddingsPerSecond:       40,
+		AverageBatchSize:          4,
+	})
+
+	dir := t.TempDir()
+	for _, format := range []string{"html", "csv", "json"} {
+		file := filepath.Join(dir, "report."+format)
+		assert.NoError(t, r.GenerateFileReport(file, format))
+
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		switch format {
+		case "html":
+			assert.Contains(t, string(data), "Decode Metrics")
+			assert.Contains(t, string(data), "12.50")
+			assert.Contains(t, string(data), "Embeddings Metrics")
+		case "csv":
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			assert.Len(t, lines, 2)
+			assert.Equal(t, len(strings.Split(lines[0], ",")), len(strings.Split(lines[1], ",")))
+			assert.Contains(t, lines[1], "12.50")
+		}
+	}
+}
+
+func TestReporter_StageMetrics(t *testing.T) {
+	r := NewReporter()
+	r.AddNewStageMetrics("ramp-up", 8, 0, &analyzer.Metrics{TotalRequests: 10, SuccessfulRequests: 10})
+	r.AddNewStageMetrics("spike", 32, 0, &analyzer.Metrics{TotalRequests: 20, SuccessfulRequests: 18, FailedRequests: 2})
+	r.AddNewStageMetrics(StageAll, 0, 0, &analyzer.Metrics{TotalRequests: 30, SuccessfulRequests: 28, FailedRequests: 2})
+
+	stages := r.concurrentComparison.StageResults()
+	assert.Len(t, stages, 2)
+	assert.Equal(t, "spike", stages[1].Label())
+
+	dir := t.TempDir()
+	for _, format := range []string{"html", "csv"} {
+		file := filepath.Join(dir, "report."+format)
+		assert.NoError(t, r.GenerateFileReport(file, format))
+
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "ramp-up")
+		assert.Contains(t, string(data), "spike")
+	}
+}
+
+func TestReporter_SeekMetrics(t *testing.T) {
+	r := NewReporter()
+	for _, concurrency := range []int{1, 2, 4, 8, 6, 5} {
+		slo := &analyzer.SLOResult{Passed: true}
+		if concurrency > 5 {
+			slo = &analyzer.SLOResult{Violations: []string{"E2E P99 12s > 10s"}}
+		}
+		r.AddNewSeekMetrics(concurrency, &analyzer.Metrics{TotalRequests: 10, SuccessfulRequests: 10}, slo)
+	}
+	r.SetSeekResult(5)
+
+	var order []int
+	for _, result := range r.concurrentComparison.TestResults {
+		order = append(order, result.Concurrency)
+	}
+	assert.Equal(t, []int{1, 2, 4, 5, 6, 8}, order)
+	assert.Equal(t, &SeekResult{MaxConcurrency: 5, Probes: 6}, r.concurrentComparison.Seek)
+
+	file := filepath.Join(t.TempDir(), "report.html")
+	assert.NoError(t, r.GenerateFileReport(file, "html"))
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Max Sustainable Concurrency")
+	assert.Contains(t, string(data), "E2E P99 12s > 10s")
+}
@@ -3,13 +3,14 @@ const testData = [
 {{- range .ReporterData.TestResults }}
   {
     concurrency: {{.Concurrency}},
+    label: {{printf "%q" .Label}},
     qps: {{printf "%.2f" .Metrics.QPS}},
     tokensPerSec: {{printf "%.1f" .Metrics.TokensPerSecond}}
   },
 {{- end }}
 ];
 
-const concurrencyLevels = testData.map(item => item.concurrency);
+const concurrencyLevels = testData.map(item => item.label);
 const qpsValues = testData.map(item => item.qps);
 const tokensPerSecValues = testData.map(item => item.tokensPerSec);
 
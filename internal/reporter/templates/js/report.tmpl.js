@@ -11,6 +11,9 @@ const translations = {
         "bottleneckDetected": "Bottleneck Detected",
         "recommended": "Recommended",
         "optimalConcurrency": "Optimal Concurrency",
+        "sloSeek": "SLO Seek",
+        "maxSustainableConcurrency": "Max Sustainable Concurrency",
+        "probes": "probes",
         "detailedComparison": "Detailed Comparison",
         "concurrency": "Concurrency",
         "requests": "Requests",
@@ -31,7 +34,16 @@ const translations = {
         "firstTokenLatencyChart": "First Token Latency Chart",
         "errorStatistics": "Error Statistics",
         "errorRate": "Error Rate",
-        "errorTypeDistribution": "Error Type Distribution"
+        "errorTypeDistribution": "Error Type Distribution",
+        "decodeMetrics": "Decode Metrics",
+        "interTokenLatency": "Inter-Token Latency (ms)",
+        "timePerOutputToken": "Time per Output Token (ms)",
+        "decodeTokensPerSec": "Decode Tokens/sec",
+        "embeddingsMetrics": "Embeddings Metrics",
+        "embeddingsPerSec": "Embeddings/sec",
+        "inputTokensPerSec": "Input Tokens/sec",
+        "averageBatchSize": "Average Batch Size",
+        "batchLatency": "Batch Latency (Avg/P99)"
     },
     zh: {
         "concurrentTestComparison": "并发测试比较",
@@ -44,6 +56,9 @@ const translations = {
         "bottleneckDetected": "检测到瓶颈",
         "recommended": "推荐",
         "optimalConcurrency": "最优并发数",
+        "sloSeek": "SLO 搜索",
+        "maxSustainableConcurrency": "最大可持续并发数",
+        "probes": "次探测",
         "detailedComparison": "详细比较",
         "concurrency": "并发数",
         "requests": "请求数",
@@ -64,7 +79,16 @@ const translations = {
         "firstTokenLatencyChart": "首Token延迟图表",
         "errorStatistics": "错误统计",
         "errorRate": "错误率",
-        "errorTypeDistribution": "错误类型分布"
+        "errorTypeDistribution": "错误类型分布",
+        "decodeMetrics": "解码指标",
+        "interTokenLatency": "Token间延迟 (ms)",
+        "timePerOutputToken": "每输出Token耗时 (ms)",
+        "decodeTokensPerSec": "解码Tokens/秒",
+        "embeddingsMetrics": "Embeddings指标",
+        "embeddingsPerSec": "Embeddings/秒",
+        "inputTokensPerSec": "输入Tokens/秒",
+        "averageBatchSize": "平均批大小",
+        "batchLatency": "批延迟 (平均/P99)"
     }
 };
 
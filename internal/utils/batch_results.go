@@ -1,16 +1,18 @@
 package utils
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/FortuneW/gollmperf/internal/collector"
 	"github.com/FortuneW/gollmperf/internal/engine"
 )
 
-// SaveBatchResultsToJSONL saves batch test results to a JSONL file
+// SaveBatchResultsToJSONL saves batch test results to a JSONL file, streaming them from the collector
 // Each line in the output file corresponds to the test case at the same line number in the input file
-func SaveBatchResultsToJSONL(results []*engine.Result, filePath string) error {
+func SaveBatchResultsToJSONL(col *collector.Collector, filePath string) error {
 	_ = os.MkdirAll(filepath.Dir(filePath), 0755)
 	// Create or truncate the file
 	file, err := os.Create(filePath)
@@ -20,7 +22,9 @@ func SaveBatchResultsToJSONL(results []*engine.Result, filePath string) error {
 	defer file.Close()
 
 	// Write each result as a JSON line
-	for i, result := range results {
+	writer := bufio.NewWriter(file)
+	i := 0
+	err = col.Each(func(result *engine.Result) error {
 		var jsonData []byte
 		if result.Success && result.RefResponse != nil {
 			jsonData = []byte(result.RefResponse.String())
@@ -30,10 +34,15 @@ func SaveBatchResultsToJSONL(results []*engine.Result, filePath string) error {
 			}
 		}
 		// Write to file with newline
-		if _, err := file.Write(append(jsonData, '\n')); err != nil {
+		if _, err := writer.Write(append(jsonData, '\n')); err != nil {
 			return fmt.Errorf("failed to write result %d to file: %w", i, err)
 		}
+		i++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return writer.Flush()
 }
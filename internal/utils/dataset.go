@@ -4,10 +4,13 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"strings"
 	"sync"
 
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
 	"github.com/FortuneW/gollmperf/internal/provider"
 )
 
@@ -59,11 +62,15 @@ func addSystemPromptToMessages(reqCase provider.AnyParams, systemPrompt string)
 	return reqCase
 }
 
-// LoadDataset loads test data from a file
-func LoadDataset(filePath, fileType string, systemPrompt string) ([]provider.AnyParams, error) {
-	switch fileType {
+// LoadDataset loads test data from the dataset file, the offline tokenizer (nil if not configured)
+// counts the tokens of the prompt datasets
+func LoadDataset(cfg *config.DatasetConfig, tok Tokenizer, systemPrompt string) ([]provider.AnyParams, error) {
+	if len(cfg.Sources) > 0 {
+		return loadWorkload(cfg.Sources, tok, systemPrompt)
+	}
+	switch cfg.Type {
 	case "jsonl":
-		requests, err := loadJSONLDataset(filePath)
+		requests, err := loadJSONLDataset(cfg.Path)
 		if err != nil {
 			return nil, err
 		}
@@ -74,9 +81,47 @@ func LoadDataset(filePath, fileType string, systemPrompt string) ([]provider.Any
 			}
 		}
 		return requests, nil
+	case engine.DatasetSessions:
+		sessions, err := loadJSONLDataset(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		// The system prompt goes before the first turn of each session
+		if strings.TrimSpace(systemPrompt) != "" {
+			for i := range sessions {
+				if _, ok := sessions[i]["messages"]; !ok {
+					sessions[i]["messages"] = []interface{}{}
+				}
+				sessions[i] = addSystemPromptToMessages(sessions[i], systemPrompt)
+			}
+		}
+		return sessions, nil
+	case DatasetShareGPT, DatasetAlpaca, DatasetCSV, DatasetText:
+		return loadPromptDataset(cfg, tok, systemPrompt)
 	default:
-		return nil, fmt.Errorf("unsupported dataset type: %s", fileType)
+		return nil, fmt.Errorf("unsupported dataset type: %s", cfg.Type)
+	}
+}
+
+// loadWorkload loads the sources of a mixed workload and mixes them by weight,
+// the params of a source override the ones of its entries
+func loadWorkload(sources []config.DatasetSource, tok Tokenizer, systemPrompt string) ([]provider.AnyParams, error) {
+	workload := make([]engine.WorkloadSource, len(sources))
+	for i, src := range sources {
+		if src.Type == engine.DatasetSessions {
+			return nil, fmt.Errorf("dataset source %s: a sessions dataset can not be mixed", src.Name)
+		}
+		dataset, err := LoadDataset(&src.DatasetConfig, tok, systemPrompt)
+		if err != nil {
+			return nil, fmt.Errorf("dataset source %s: %w", src.Name, err)
+		}
+		for _, entry := range dataset {
+			maps.Copy(entry, src.Params)
+		}
+		mlog.Infof("Loaded %d test cases from dataset source %s (%s), weight %v", len(dataset), src.Name, src.Path, src.Weight)
+		workload[i] = engine.WorkloadSource{Name: src.Name, Weight: src.Weight, Dataset: dataset}
 	}
+	return engine.MixWorkload(workload)
 }
 
 // loadJSONLDataset loads dataset from JSONL file
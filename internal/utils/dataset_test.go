@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/FortuneW/gollmperf/internal/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,7 +22,7 @@ func TestLoadDataset(t *testing.T) {
 	assert.NoError(t, err)
 	file.Close()
 
-	dataset, err := LoadDataset(file.Name(), "jsonl", "")
+	dataset, err := LoadDataset(&config.DatasetConfig{Type: "jsonl", Path: file.Name()}, nil, "")
 	assert.NoError(t, err)
 	assert.Len(t, dataset, 2)
 
@@ -29,7 +30,18 @@ func TestLoadDataset(t *testing.T) {
 }
 
 func TestLoadExamplesCaseFile(t *testing.T) {
-	dataset, err := LoadDataset("../../examples/test_cases.jsonl", "jsonl", "")
+	dataset, err := LoadDataset(&config.DatasetConfig{Type: "jsonl", Path: "../../examples/test_cases.jsonl"}, nil, "")
 	assert.NoError(t, err)
 	t.Log(dataset)
 }
+
+func TestLoadSessionsDataset(t *testing.T) {
+	dataset, err := LoadDataset(&config.DatasetConfig{Type: "sessions", Path: "../../examples/sessions.jsonl"}, nil, "Be brief")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 3)
+	for _, session := range dataset {
+		messages := session["messages"].([]interface{})
+		assert.Equal(t, map[string]interface{}{"role": "system", "content": "Be brief"}, messages[0])
+		assert.NotEmpty(t, session["turns"])
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// Tags of the requests of a prefix cache dataset
+const (
+	PrefixTag      = "prefix"       // PrefixShared, PrefixWarmup or PrefixUnique
+	PrefixGroupTag = "prefix_group" // group of a shared prefix, starting at 1
+	PrefixShared   = "shared"       // the prefix is shared with the other requests of its group, the request may hit the cache
+	PrefixWarmup   = "warmup"       // first request of a group, which fills the cache for the shared ones
+	PrefixUnique   = "unique"       // the prefix is random, the request misses the cache
+)
+
+// Template variables holding the texts of a request, so that they are not parsed as templates
+const (
+	prefixVar = "prefix"        // prefix of the request
+	systemVar = "system_prompt" // system prompt, which may have literal braces, e.g. JSON instructions
+)
+
+// GeneratePrefixCacheDataset generates a prefix cache benchmark dataset. The prefixes are sized with the offline
+// tokenizer if not nil, with the vLLM /tokenize endpoint if available, with an estimation otherwise. The shared
+// requests are evenly spread over the dataset and round-robin over the groups, each request is tagged with
+// PrefixTag and PrefixGroupTag. The content of the requests is a template: a unique prefix starts with a
+// {{uuid}} rendered for each request, so that it misses the cache even when a test cycles over the dataset,
+// and a shared one with a UUID of its group, so that both kinds have the same length. The dataset must thus
+// be rendered by a TemplateRenderer.
+func GeneratePrefixCacheDataset(cfg *config.PrefixCacheDatasetConfig, tok Tokenizer, endpoint, systemPrompt string) ([]provider.AnyParams, error) {
+	if cfg.Requests <= 0 || cfg.PrefixLength <= 0 {
+		return nil, fmt.Errorf("requests and prefix_len must be positive")
+	}
+	if cfg.ShareRatio < 0 || cfg.ShareRatio > 1 {
+		return nil, fmt.Errorf("share_ratio %v is not between 0 and 1", cfg.ShareRatio)
+	}
+	groups := cfg.Groups
+	if groups <= 0 {
+		groups = 1
+	}
+
+	// Shared prefixes, without tokenizer the unique ones have the same number of words
+	prefixes := make([]string, groups)
+	groupIDs := make([]string, groups)
+	tokenize := true
+	for g := range prefixes {
+		groupIDs[g] = gofakeit.UUID()
+		if tok != nil {
+			prefixes[g] = GetRandomPromptByTokenizer(tok, cfg.PrefixLength)
+			continue
+		}
+		if tokenize {
+			prompt, err := GetRandomPromptByTokenCount(endpoint, cfg.PrefixLength)
+			if err == nil {
+				prefixes[g] = prompt
+				continue
+			}
+			mlog.Warnf("Failed to size the prefixes with the tokenize endpoint: %v, using an estimation", err)
+			tokenize = false
+		}
+		prefixes[g] = generateRandomWords(cfg.PrefixLength)
+	}
+	prefixWords := len(strings.Fields(prefixes[0]))
+
+	dataset := make([]provider.AnyParams, 0, cfg.Requests)
+	shared := 0
+	for i := 0; i < cfg.Requests; i++ {
+		var prefix, content string
+		tags := map[string]any{}
+		// The shared requests are the ones which move the running count of shared requests to the next integer
+		if int(float64(i+1)*cfg.ShareRatio) > int(float64(i)*cfg.ShareRatio) {
+			group := shared % groups
+			prefix = prefixes[group]
+			content = groupIDs[group] + " {{." + prefixVar + "}}"
+			tags[PrefixTag] = PrefixShared
+			if shared < groups {
+				// The first request of a group is bound to miss the cache
+				tags[PrefixTag] = PrefixWarmup
+			}
+			tags[PrefixGroupTag] = strconv.Itoa(group + 1)
+			shared++
+		} else {
+			if tok != nil {
+				prefix = GetRandomPromptByTokenizer(tok, cfg.PrefixLength)
+			} else {
+				prefix = randomWords(prefixWords)
+			}
+			content = "{{uuid}} {{." + prefixVar + "}}"
+			tags[PrefixTag] = PrefixUnique
+		}
+
+		if cfg.SuffixLength > 0 {
+			content += "\n\n" + generateRandomWords(cfg.SuffixLength)
+		}
+		messages := []interface{}{
+			map[string]interface{}{
+				"role":    "user",
+				"content": content,
+			},
+		}
+		if systemPrompt != "" {
+			messages = append([]interface{}{
+				map[string]interface{}{
+					"role":    "system",
+					"content": "{{." + systemVar + "}}",
+				},
+			}, messages...)
+		}
+
+		req := provider.AnyParams{
+			"messages": messages,
+			"stream":   true,
+			"stream_options": map[string]interface{}{
+				"include_usage": true,
+			},
+			engine.TagsKey: tags,
+			engine.VarsKey: map[string]any{prefixVar: prefix, systemVar: systemPrompt},
+		}
+		if cfg.OutputLength > 0 {
+			req["max_tokens"] = cfg.OutputLength
+			req["ignore_eos"] = true
+		}
+		dataset = append(dataset, req)
+	}
+
+	return dataset, nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePrefixCacheDataset(t *testing.T) {
+	server := mockTokenizeServer(t)
+	defer server.Close()
+
+	cfg := &config.PrefixCacheDatasetConfig{
+		Requests:     20,
+		PrefixLength: 200,
+		SuffixLength: 10,
+		OutputLength: 16,
+		Groups:       2,
+		ShareRatio:   0.75,
+	}
+	dataset, err := GeneratePrefixCacheDataset(cfg, nil, server.URL, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 20)
+
+	renderer := NewTemplateRenderer(nil)
+	render := func(req map[string]any) string {
+		params, err := renderer.Render(req)
+		assert.NoError(t, err)
+		return params["messages"].([]any)[0].(map[string]any)["content"].(string)
+	}
+	prefixes := map[string]map[string]bool{} // prefixes per group
+	unique, warmup := 0, 0
+	for _, req := range dataset {
+		assert.Equal(t, 16, req["max_tokens"])
+		tags := req[engine.TagsKey].(map[string]any)
+		prefix := render(req)[:100]
+		switch tags[PrefixTag] {
+		case PrefixWarmup:
+			warmup++
+			fallthrough
+		case PrefixShared:
+			group := tags[PrefixGroupTag].(string)
+			if prefixes[group] == nil {
+				prefixes[group] = map[string]bool{}
+			}
+			prefixes[group][prefix] = true
+		case PrefixUnique:
+			// A unique prefix differs each time it is sent
+			assert.NotEqual(t, prefix, render(req)[:100])
+			unique++
+		}
+	}
+	assert.Equal(t, 5, unique)
+	assert.Equal(t, 2, warmup)
+	assert.Len(t, prefixes, 2)
+	for _, group := range prefixes {
+		assert.Len(t, group, 1)
+	}
+
+	// A system prompt with braces is sent as it is
+	system := `Reply in JSON: {"answer": "{{answer}}"}`
+	dataset, err = GeneratePrefixCacheDataset(&config.PrefixCacheDatasetConfig{Requests: 2, PrefixLength: 10, ShareRatio: 0.5}, nil, server.URL, system)
+	assert.NoError(t, err)
+	for _, req := range dataset {
+		params, err := renderer.Render(req)
+		assert.NoError(t, err)
+		assert.Equal(t, system, params["messages"].([]any)[0].(map[string]any)["content"])
+	}
+
+	_, err = GeneratePrefixCacheDataset(&config.PrefixCacheDatasetConfig{Requests: 1, PrefixLength: 10, ShareRatio: 2}, nil, server.URL, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+)
+
+// Types of the prompt datasets, the public benchmark datasets made of prompts with an optional reference answer
+const (
+	DatasetShareGPT = "sharegpt" // JSON array or JSONL of {"conversations": [{"from": "human", "value": ...}, ...]}
+	DatasetAlpaca   = "alpaca"   // JSON array or JSONL of {"instruction": ..., "input": ..., "output": ...}
+	DatasetCSV      = "csv"      // CSV with a header, the prompts in the prompt column
+	DatasetText     = "text"     // one prompt per line
+)
+
+// promptEntry is a prompt of a dataset with its reference answer, empty if the dataset has none
+type promptEntry struct {
+	prompt    string
+	reference string
+}
+
+// loadPromptDataset loads a prompt dataset into chat requests of a single user message. The prompts longer than
+// MaxInputLength tokens are skipped, NumSamples prompts are randomly sampled, and max_tokens is set from
+// OutputLength or from the reference answer. The tokens are counted with the offline tokenizer if not nil,
+// estimated otherwise.
+func loadPromptDataset(cfg *config.DatasetConfig, tok Tokenizer, systemPrompt string) ([]provider.AnyParams, error) {
+	var (
+		entries []promptEntry
+		err     error
+	)
+	switch cfg.Type {
+	case DatasetShareGPT:
+		entries, err = loadShareGPT(cfg.Path)
+	case DatasetAlpaca:
+		entries, err = loadAlpaca(cfg.Path)
+	case DatasetCSV:
+		entries, err = loadCSVPrompts(cfg.Path, cfg.PromptColumn, cfg.OutputColumn)
+	case DatasetText:
+		entries, err = loadTextPrompts(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unsupported dataset type: %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Shuffle before filtering, so that only the sampled prompts are tokenized
+	if cfg.NumSamples > 0 {
+		seed := cfg.Seed
+		if seed == 0 {
+			seed = rand.Uint64()
+		}
+		r := rand.New(rand.NewPCG(seed, seed))
+		r.Shuffle(len(entries), func(i, j int) {
+			entries[i], entries[j] = entries[j], entries[i]
+		})
+	}
+
+	var dataset []provider.AnyParams
+	for _, entry := range entries {
+		if cfg.NumSamples > 0 && len(dataset) == cfg.NumSamples {
+			break
+		}
+		if strings.TrimSpace(entry.prompt) == "" {
+			continue
+		}
+		if cfg.MaxInputLength > 0 && countTokens(tok, entry.prompt) > cfg.MaxInputLength {
+			continue
+		}
+
+		req := provider.AnyParams{
+			"messages": []interface{}{
+				map[string]interface{}{
+					"role":    "user",
+					"content": entry.prompt,
+				},
+			},
+		}
+		maxTokens := cfg.OutputLength
+		if cfg.ReferenceOutputLen && entry.reference != "" {
+			maxTokens = max(countTokens(tok, entry.reference), 1)
+		}
+		if maxTokens > 0 {
+			req["max_tokens"] = maxTokens
+		}
+		dataset = append(dataset, addSystemPromptToMessages(req, systemPrompt))
+	}
+
+	if len(dataset) == 0 {
+		return nil, fmt.Errorf("no prompt of dataset %s within max_input_len %d", cfg.Path, cfg.MaxInputLength)
+	}
+	return dataset, nil
+}
+
+// countTokens counts the tokens of text with the offline tokenizer, or estimates them at 4 bytes per token
+func countTokens(tok Tokenizer, text string) int {
+	if tok != nil {
+		return tok.CountTokens(text)
+	}
+	return (len(text) + 3) / 4
+}
+
+// loadJSONRecords loads the records of a JSON array or of a JSONL file
+func loadJSONRecords[T any](filePath string) ([]T, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	var records []T
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON array: %w", err)
+		}
+		return records, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var record T
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// shareGPTTurn is a turn of a ShareGPT conversation, either {"from", "value"} or {"role", "content"}
+type shareGPTTurn struct {
+	From    string `json:"from"`
+	Value   string `json:"value"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// loadShareGPT loads the first human turn of each conversation, the next turn is its reference answer
+func loadShareGPT(filePath string) ([]promptEntry, error) {
+	records, err := loadJSONRecords[struct {
+		Conversations []shareGPTTurn `json:"conversations"`
+	}](filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]promptEntry, 0, len(records))
+	for _, record := range records {
+		for i, turn := range record.Conversations {
+			speaker, text := turn.From, turn.Value
+			if speaker == "" {
+				speaker, text = turn.Role, turn.Content
+			}
+			if speaker != "human" && speaker != "user" {
+				continue
+			}
+			entry := promptEntry{prompt: text}
+			if i+1 < len(record.Conversations) {
+				next := record.Conversations[i+1]
+				entry.reference = next.Value
+				if next.From == "" {
+					entry.reference = next.Content
+				}
+			}
+			entries = append(entries, entry)
+			break
+		}
+	}
+	return entries, nil
+}
+
+// loadAlpaca loads the instructions followed by their input, the output is the reference answer
+func loadAlpaca(filePath string) ([]promptEntry, error) {
+	records, err := loadJSONRecords[struct {
+		Instruction string `json:"instruction"`
+		Input       string `json:"input"`
+		Output      string `json:"output"`
+	}](filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]promptEntry, 0, len(records))
+	for _, record := range records {
+		prompt := record.Instruction
+		if record.Input != "" {
+			prompt += "\n\n" + record.Input
+		}
+		entries = append(entries, promptEntry{prompt: prompt, reference: record.Output})
+	}
+	return entries, nil
+}
+
+// loadCSVPrompts loads the prompt column of a CSV file with a header, and the output column if not empty
+func loadCSVPrompts(filePath, promptColumn, outputColumn string) ([]promptEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	if promptColumn == "" {
+		promptColumn = "prompt"
+	}
+	promptIndex, outputIndex := -1, -1
+	for i, name := range header {
+		switch name = csvHeaderName(name); {
+		case name == promptColumn:
+			promptIndex = i
+		case outputColumn != "" && name == outputColumn:
+			outputIndex = i
+		}
+	}
+	if promptIndex < 0 {
+		return nil, fmt.Errorf("CSV file %s has no %q column", filePath, promptColumn)
+	}
+	if outputColumn != "" && outputIndex < 0 {
+		return nil, fmt.Errorf("CSV file %s has no %q column", filePath, outputColumn)
+	}
+
+	var entries []promptEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV file: %w", err)
+		}
+		entry := promptEntry{prompt: record[promptIndex]}
+		if outputIndex >= 0 {
+			entry.reference = record[outputIndex]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// csvHeaderName returns a column name of a CSV header without spaces nor the byte order mark
+// which starts the files saved by Excel
+func csvHeaderName(name string) string {
+	return strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+}
+
+// loadTextPrompts loads one prompt per line, blank lines are skipped
+func loadTextPrompts(filePath string) ([]promptEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	scanner.Buffer(buf, cap(buf))
+
+	var entries []promptEntry
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			entries = append(entries, promptEntry{prompt: line})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeDatasetFile writes a dataset fixture to a temp file named name
+func writeDatasetFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// userContent returns the content of the last message of a request
+func userContent(req provider.AnyParams) any {
+	messages := req["messages"].([]interface{})
+	return messages[len(messages)-1].(map[string]interface{})["content"]
+}
+
+func TestLoadDataset_ShareGPT(t *testing.T) {
+	path := writeDatasetFile(t, "sharegpt.json", `[
+		{"id": "1", "conversations": [
+			{"from": "system", "value": "ignored"},
+			{"from": "human", "value": "What is Go?"},
+			{"from": "gpt", "value": "A programming language created at Google in 2007."}
+		]},
+		{"id": "2", "conversations": [{"from": "gpt", "value": "no human turn"}]},
+		{"id": "3", "conversations": [{"role": "user", "content": "Hi"}]}
+	]`)
+
+	dataset, err := LoadDataset(&config.DatasetConfig{Type: DatasetShareGPT, Path: path, ReferenceOutputLen: true}, nil, "Be brief")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 2)
+	assert.Equal(t, "What is Go?", userContent(dataset[0]))
+	assert.Equal(t, 13, dataset[0]["max_tokens"]) // 50 bytes estimated at 4 bytes per token
+	assert.Equal(t, map[string]interface{}{"role": "system", "content": "Be brief"}, dataset[0]["messages"].([]interface{})[0])
+	assert.Equal(t, "Hi", userContent(dataset[1]))
+	assert.NotContains(t, dataset[1], "max_tokens") // no reference answer nor output_len
+}
+
+func TestLoadDataset_Alpaca(t *testing.T) {
+	path := writeDatasetFile(t, "alpaca.jsonl", `{"instruction": "Translate to French.", "input": "Hello", "output": "Bonjour"}
+{"instruction": "Name a color.", "input": "", "output": "Blue"}
+`)
+
+	dataset, err := LoadDataset(&config.DatasetConfig{Type: DatasetAlpaca, Path: path, OutputLength: 64}, nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 2)
+	assert.Equal(t, "Translate to French.\n\nHello", userContent(dataset[0]))
+	assert.Equal(t, "Name a color.", userContent(dataset[1]))
+	assert.Equal(t, 64, dataset[1]["max_tokens"])
+}
+
+func TestLoadDataset_CSV(t *testing.T) {
+	path := writeDatasetFile(t, "prompts.csv", "id,question,answer\n1,\"Why, really?\",Because\n2,\"Two\nlines\",\n")
+
+	dataset, err := LoadDataset(&config.DatasetConfig{
+		Type: DatasetCSV, Path: path, PromptColumn: "question", OutputColumn: "answer", ReferenceOutputLen: true, OutputLength: 7,
+	}, nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 2)
+	assert.Equal(t, "Why, really?", userContent(dataset[0]))
+	assert.Equal(t, 2, dataset[0]["max_tokens"])
+	assert.Equal(t, "Two\nlines", userContent(dataset[1]))
+	assert.Equal(t, 7, dataset[1]["max_tokens"]) // empty answer, output_len applies
+
+	_, err = LoadDataset(&config.DatasetConfig{Type: DatasetCSV, Path: path}, nil, "")
+	assert.Error(t, err) // no prompt column
+}
+
+func TestLoadDataset_TextSampling(t *testing.T) {
+	path := writeDatasetFile(t, "prompts.txt", "one\n\ntwo\nthree\nfour\nfive\nthis prompt is far too long for the limit\n")
+
+	cfg := &config.DatasetConfig{Type: DatasetText, Path: path}
+	dataset, err := LoadDataset(cfg, nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 6)
+
+	// Long prompts are skipped, the sampling is reproducible with a seed
+	cfg.MaxInputLength, cfg.NumSamples, cfg.Seed = 2, 3, 42
+	first, err := LoadDataset(cfg, nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, first, 3)
+	second, err := LoadDataset(cfg, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	for _, req := range first {
+		assert.NotEqual(t, "this prompt is far too long for the limit", userContent(req))
+	}
+
+	cfg.MaxInputLength = 0
+	cfg.NumSamples = 100
+	dataset, err = LoadDataset(cfg, nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 6)
+}
+
+func TestLoadDataset_Workload(t *testing.T) {
+	chat := writeDatasetFile(t, "chat.jsonl", `{"messages": [{"role": "user", "content": "Hi"}], "max_tokens": 16}`)
+	docs := writeDatasetFile(t, "docs.txt", "Summarize A\nSummarize B\n")
+
+	dataset, err := LoadDataset(&config.DatasetConfig{Sources: []config.DatasetSource{
+		{DatasetConfig: config.DatasetConfig{Type: "jsonl", Path: chat}, Name: "chat", Weight: 1, Params: map[string]interface{}{"max_tokens": 8}},
+		{DatasetConfig: config.DatasetConfig{Type: DatasetText, Path: docs}, Name: "docs", Weight: 1},
+	}}, nil, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 4)
+	assert.Equal(t, 8, dataset[0]["max_tokens"]) // the params of the source override the entry
+	assert.Equal(t, map[string]string{engine.SourceTag: "chat"}, dataset[0][engine.TagsKey])
+	assert.Equal(t, "Summarize A", userContent(dataset[1]))
+	assert.Equal(t, map[string]string{engine.SourceTag: "docs"}, dataset[1][engine.TagsKey])
+
+	_, err = LoadDataset(&config.DatasetConfig{Sources: []config.DatasetSource{
+		{DatasetConfig: config.DatasetConfig{Type: engine.DatasetSessions, Path: chat}, Name: "chat", Weight: 1},
+	}}, nil, "")
+	assert.Error(t, err)
+}
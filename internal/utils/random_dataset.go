@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/provider"
+)
+
+// Distributions of the token lengths of a random dataset
+const (
+	LengthFixed     = "fixed"
+	LengthUniform   = "uniform"
+	LengthNormal    = "normal"
+	LengthLognormal = "lognormal"
+	LengthHistogram = "histogram"
+)
+
+// calibrationWords is the number of words tokenized to measure the tokens per word of the random prompts
+const calibrationWords = 1000
+
+// NewLengthSampler returns a sampler of token lengths of the distribution, whose mean is the given length
+func NewLengthSampler(mean int, dist config.LengthDistribution) (func() int, error) {
+	minLength := max(dist.Min, 1)
+	maxLength := dist.Max
+	if maxLength > 0 && maxLength < minLength {
+		return nil, fmt.Errorf("max length %d is less than min length %d", maxLength, minLength)
+	}
+	clamp := func(length float64) int {
+		n := max(int(math.Round(length)), minLength)
+		if maxLength > 0 {
+			n = min(n, maxLength)
+		}
+		return n
+	}
+
+	if dist.Type != LengthHistogram && mean <= 0 {
+		return nil, fmt.Errorf("length must be positive")
+	}
+	m := float64(mean)
+
+	switch dist.Type {
+	case "", LengthFixed:
+		return func() int { return clamp(m) }, nil
+	case LengthUniform:
+		if dist.RangeRatio < 0 || dist.RangeRatio >= 1 {
+			return nil, fmt.Errorf("range-ratio %v is not in [0, 1)", dist.RangeRatio)
+		}
+		low, high := m*(1-dist.RangeRatio), m*(1+dist.RangeRatio)
+		return func() int { return clamp(low + rand.Float64()*(high-low)) }, nil
+	case LengthNormal:
+		if dist.StdDev < 0 {
+			return nil, fmt.Errorf("stddev must not be negative")
+		}
+		return func() int { return clamp(m + rand.NormFloat64()*dist.StdDev) }, nil
+	case LengthLognormal:
+		if dist.StdDev < 0 {
+			return nil, fmt.Errorf("stddev must not be negative")
+		}
+		// Parameters of the underlying normal distribution giving the mean and the standard deviation
+		sigma := math.Sqrt(math.Log(1 + dist.StdDev*dist.StdDev/(m*m)))
+		mu := math.Log(m) - sigma*sigma/2
+		return func() int { return clamp(math.Exp(mu + rand.NormFloat64()*sigma)) }, nil
+	case LengthHistogram:
+		lengths, weights, err := loadLengthHistogram(dist.Path)
+		if err != nil {
+			return nil, err
+		}
+		total := weights[len(weights)-1]
+		return func() int {
+			// The first cumulative weight above the draw is never a bin of zero weight
+			draw := rand.Float64() * total
+			i := sort.Search(len(weights), func(i int) bool { return weights[i] > draw })
+			return clamp(float64(lengths[i]))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown length distribution: %s", dist.Type)
+	}
+}
+
+// loadLengthHistogram loads a histogram file of "length,weight" lines, blank lines and lines starting with # are
+// skipped. It returns the lengths with their cumulative weights.
+func loadLengthHistogram(path string) ([]int, []float64, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("histogram distribution needs a path")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open histogram file: %w", err)
+	}
+	defer file.Close()
+
+	var (
+		lengths []int
+		weights []float64
+		total   float64
+	)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("invalid histogram line %d: %q", lineNum, line)
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid length at histogram line %d: %w", lineNum, err)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil || weight < 0 {
+			return nil, nil, fmt.Errorf("invalid weight at histogram line %d: %q", lineNum, fields[1])
+		}
+		total += weight
+		lengths = append(lengths, length)
+		weights = append(weights, total)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read histogram file: %w", err)
+	}
+	if total <= 0 {
+		return nil, nil, fmt.Errorf("histogram file %s has no weight", path)
+	}
+	return lengths, weights, nil
+}
+
+// GenerateRandomDataset generates the random dataset for vLLM: NumPrompts distinct prompts of random words, whose
+// input and output lengths are drawn from their distributions. The prompts are sized with the offline
+// tokenizer if not nil. Otherwise a single prompt is sized exactly with the /tokenize endpoint, many prompts are
+// sized with the tokens per word measured once, the server truncates the excess tokens.
+func GenerateRandomDataset(cfg *config.RandomDatasetVLLMConfig, tok Tokenizer, endpoint, systemPrompt string) ([]provider.AnyParams, error) {
+	inputLength, err := NewLengthSampler(cfg.InputLength, cfg.InputDistribution)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input length distribution: %w", err)
+	}
+	outputLength, err := NewLengthSampler(cfg.OutputLength, cfg.OutputDistribution)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output length distribution: %w", err)
+	}
+
+	numPrompts := cfg.NumPrompts
+	if numPrompts <= 0 {
+		numPrompts = config.DefaultRandomNumPrompts
+	}
+	var prompt func(tokens int) string
+	if tok != nil {
+		prompt = func(tokens int) string {
+			return GetRandomPromptByTokenizer(tok, tokens)
+		}
+	} else if numPrompts == 1 {
+		prompt = func(tokens int) string {
+			p, err := GetRandomPromptByTokenCount(endpoint, tokens)
+			if err != nil {
+				mlog.Warnf("Failed to generate exact token count: %v, using best effort", err)
+				return generateRandomWords(tokens)
+			}
+			return p
+		}
+	} else {
+		wordsPerToken := measureWordsPerToken(endpoint)
+		prompt = func(tokens int) string {
+			return randomWords(max(int(math.Ceil(float64(tokens)*wordsPerToken)), 1))
+		}
+	}
+
+	dataset := make([]provider.AnyParams, 0, numPrompts)
+	for i := 0; i < numPrompts; i++ {
+		inputTokens, outputTokens := inputLength(), outputLength()
+
+		messages := []interface{}{
+			map[string]interface{}{
+				"role":    "user",
+				"content": prompt(inputTokens),
+			},
+		}
+
+		// Add system prompt if provided
+		if systemPrompt != "" {
+			messages = append([]interface{}{
+				map[string]interface{}{
+					"role":    "system",
+					"content": systemPrompt,
+				},
+			}, messages...)
+		}
+
+		dataset = append(dataset, provider.AnyParams{
+			"messages":               messages,
+			"max_tokens":             outputTokens,
+			"ignore_eos":             true,
+			"truncate_prompt_tokens": inputTokens,
+			"stream":                 true,
+			"stream_options": map[string]interface{}{
+				"include_usage": true,
+			},
+		})
+	}
+	return dataset, nil
+}
+
+// measureWordsPerToken measures the random words per token with the vLLM /tokenize endpoint,
+// it falls back to the estimation of generateRandomWords if the endpoint is not available
+func measureWordsPerToken(endpoint string) float64 {
+	const estimatedWordsPerToken = 1.2
+
+	tokenizeURL, err := BuildTokenizeURL(endpoint)
+	if err != nil {
+		mlog.Warnf("Failed to build tokenize URL: %v, estimating %.1f words per token", err, estimatedWordsPerToken)
+		return estimatedWordsPerToken
+	}
+	count, err := CallTokenizeAPI(tokenizeURL, randomWords(calibrationWords))
+	if err != nil || count <= 0 {
+		mlog.Warnf("Tokenize API call failed: %v, estimating %.1f words per token", err, estimatedWordsPerToken)
+		return estimatedWordsPerToken
+	}
+	wordsPerToken := float64(calibrationWords) / float64(count)
+	mlog.Infof("Measured %.3f random words per token", wordsPerToken)
+	return wordsPerToken
+}
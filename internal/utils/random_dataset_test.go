@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLengthSampler(t *testing.T) {
+	histogram := filepath.Join(t.TempDir(), "lengths.csv")
+	assert.NoError(t, os.WriteFile(histogram, []byte("# length,weight\n100,1\n200,0\n300,3\n"), 0644))
+
+	for _, tc := range []struct {
+		name     string
+		dist     config.LengthDistribution
+		mean     float64
+		min, max int
+	}{
+		{"fixed", config.LengthDistribution{}, 1000, 1000, 1000},
+		{"uniform", config.LengthDistribution{Type: LengthUniform, RangeRatio: 0.5}, 1000, 500, 1500},
+		{"normal", config.LengthDistribution{Type: LengthNormal, StdDev: 100}, 1000, 1, 0},
+		{"lognormal", config.LengthDistribution{Type: LengthLognormal, StdDev: 500}, 1000, 1, 0},
+		{"clamped", config.LengthDistribution{Type: LengthNormal, StdDev: 1000, Min: 900, Max: 1100}, 1000, 900, 1100},
+		{"histogram", config.LengthDistribution{Type: LengthHistogram, Path: histogram}, 250, 100, 300},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sample, err := NewLengthSampler(1000, tc.dist)
+			assert.NoError(t, err)
+
+			const n = 20000
+			total := 0
+			for i := 0; i < n; i++ {
+				length := sample()
+				total += length
+				assert.GreaterOrEqual(t, length, tc.min)
+				if tc.max > 0 {
+					assert.LessOrEqual(t, length, tc.max)
+				}
+				if tc.dist.Type == LengthHistogram {
+					assert.NotEqual(t, 200, length)
+				}
+			}
+			if tc.name != "clamped" {
+				assert.InDelta(t, tc.mean, float64(total)/n, tc.mean*0.03)
+			}
+		})
+	}
+
+	for _, dist := range []config.LengthDistribution{
+		{Type: "zipf"},
+		{Type: LengthUniform, RangeRatio: 1},
+		{Type: LengthNormal, StdDev: -1},
+		{Type: LengthHistogram},
+		{Min: 10, Max: 5},
+	} {
+		_, err := NewLengthSampler(1000, dist)
+		assert.Error(t, err, dist)
+	}
+}
+
+func TestGenerateRandomDataset(t *testing.T) {
+	server := mockTokenizeServer(t)
+	defer server.Close()
+
+	cfg := &config.RandomDatasetVLLMConfig{
+		InputLength:        100,
+		OutputLength:       50,
+		NumPrompts:         10,
+		OutputDistribution: config.LengthDistribution{Type: LengthUniform, RangeRatio: 0.5},
+	}
+	dataset, err := GenerateRandomDataset(cfg, nil, server.URL, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, 10)
+
+	prompts := map[string]bool{}
+	for _, req := range dataset {
+		assert.Equal(t, 100, req["truncate_prompt_tokens"])
+		assert.GreaterOrEqual(t, req["max_tokens"], 25)
+		assert.LessOrEqual(t, req["max_tokens"], 75)
+		prompts[req["messages"].([]interface{})[0].(map[string]interface{})["content"].(string)] = true
+	}
+	assert.Len(t, prompts, 10)
+
+	// The number of prompts defaults to the one of the config
+	cfg.NumPrompts = 0
+	dataset, err = GenerateRandomDataset(cfg, nil, server.URL, "")
+	assert.NoError(t, err)
+	assert.Len(t, dataset, config.DefaultRandomNumPrompts)
+}
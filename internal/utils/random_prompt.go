@@ -186,7 +186,11 @@ func generateRandomWords(targetTokenCount int) string {
 	if wordCount < 1 {
 		wordCount = 1
 	}
+	return randomWords(wordCount)
+}
 
+// randomWords generates a string of wordCount random English words
+func randomWords(wordCount int) string {
 	words := make([]string, wordCount)
 	for i := 0; i < wordCount; i++ {
 		words[i] = gofakeit.Word()
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// templateFuncs are the functions of the request templates besides the builtin ones of text/template
+var templateFuncs = template.FuncMap{
+	// randInt returns a random integer in [min, max]
+	"randInt": func(min, max int) (int, error) {
+		if max < min {
+			return 0, fmt.Errorf("randInt: max %d is less than min %d", max, min)
+		}
+		return min + rand.IntN(max-min+1), nil
+	},
+	// randFloat returns a random float in [min, max)
+	"randFloat": func(min, max float64) float64 {
+		return min + rand.Float64()*(max-min)
+	},
+	// randChoice returns one of its arguments at random
+	"randChoice": func(items ...any) (any, error) {
+		if len(items) == 0 {
+			return nil, fmt.Errorf("randChoice: no item")
+		}
+		return items[rand.IntN(len(items))], nil
+	},
+	// fake returns fake data of a gofakeit function, with its params after a colon, e.g. "name" or "sentence:8"
+	"fake": func(function string) (string, error) {
+		name, _, _ := strings.Cut(function, ":")
+		if gofakeit.GetFuncLookup(name) == nil {
+			return "", fmt.Errorf("fake: unknown function %q", name)
+		}
+		return gofakeit.Generate("{" + function + "}")
+	},
+	"uuid": gofakeit.UUID,
+}
+
+// TemplateRenderer renders the Go-template placeholders of the string values of the dataset entries, e.g.
+// {{.user_name}}, {{randInt 1 100}} or {{fake "sentence"}}, freshly for each request. The variables are
+// the _vars of the entry (engine.VarsKey) over a random row of the variables file, a missing one is an error.
+type TemplateRenderer struct {
+	rows      []map[string]any
+	templates sync.Map // source -> *template.Template
+}
+
+// NewTemplateRenderer creates a renderer drawing the variables of each request from a random row, rows may be empty
+func NewTemplateRenderer(rows []map[string]any) *TemplateRenderer {
+	return &TemplateRenderer{rows: rows}
+}
+
+// Rows returns the rows of variables the renderer draws from
+func (r *TemplateRenderer) Rows() []map[string]any {
+	return r.rows
+}
+
+// Render implements engine.RequestRenderer, it returns the params of the entry without its variables
+func (r *TemplateRenderer) Render(reqCase provider.AnyParams) (provider.AnyParams, error) {
+	vars := make(map[string]any)
+	if len(r.rows) > 0 {
+		maps.Copy(vars, r.rows[rand.IntN(len(r.rows))])
+	}
+	if own, ok := reqCase[engine.VarsKey].(map[string]any); ok {
+		maps.Copy(vars, own)
+	}
+
+	params := make(provider.AnyParams, len(reqCase))
+	for key, value := range reqCase {
+		if key == engine.VarsKey {
+			continue
+		}
+		rendered, err := r.render(value, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		params[key] = rendered
+	}
+	return params, nil
+}
+
+// render renders the strings of a value, maps and arrays are copied so that the entry is left untouched
+func (r *TemplateRenderer) render(value any, vars map[string]any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := r.parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, vars); err != nil {
+			return nil, err
+		}
+		return sb.String(), nil
+	case map[string]any:
+		rendered := make(map[string]any, len(v))
+		for key, item := range v {
+			var err error
+			if rendered[key], err = r.render(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	case []any:
+		rendered := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			if rendered[i], err = r.render(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
+
+// parse returns the parsed template of a source, parsed once
+func (r *TemplateRenderer) parse(source string) (*template.Template, error) {
+	if tmpl, ok := r.templates.Load(source); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("request").Funcs(templateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	r.templates.Store(source, tmpl)
+	return tmpl, nil
+}
+
+// LoadTemplateVars loads the rows of template variables of a CSV file with a header (a file ending with .csv),
+// or of a JSON array or JSONL file of objects
+func LoadTemplateVars(filePath string) ([]map[string]any, error) {
+	var rows []map[string]any
+	if strings.EqualFold(filepath.Ext(filePath), ".csv") {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		defer file.Close()
+
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV file: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("CSV file %s has no header", filePath)
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(map[string]any, len(header))
+			for i, name := range header {
+				row[csvHeaderName(name)] = record[i]
+			}
+			rows = append(rows, row)
+		}
+	} else {
+		var err error
+		if rows, err = loadJSONRecords[map[string]any](filePath); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("variables file %s has no row", filePath)
+	}
+	return rows, nil
+}
+
+// AssignTemplateVars gives row i of the variables to entry i of the dataset, cycling over the rows.
+// The variables of an entry take precedence over the ones of its row. The entries are replaced by copies,
+// as a dataset may repeat the same entry, e.g. a mixed workload.
+func AssignTemplateVars(dataset []provider.AnyParams, rows []map[string]any) {
+	if len(rows) == 0 {
+		return
+	}
+	for i, entry := range dataset {
+		vars := maps.Clone(rows[i%len(rows)])
+		if own, ok := entry[engine.VarsKey].(map[string]any); ok {
+			maps.Copy(vars, own)
+		}
+		dataset[i] = maps.Clone(entry)
+		dataset[i][engine.VarsKey] = vars
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateRenderer(t *testing.T) {
+	r := NewTemplateRenderer([]map[string]any{{"user_name": "Ada", "city": "Paris"}})
+	entry := provider.AnyParams{
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": `Hi, I am {{.user_name}} from {{.city}}, pick {{randInt 1 3}} of {{randChoice "a" "b"}}`},
+		},
+		"user":         "{{uuid}}",
+		"max_tokens":   100,
+		engine.VarsKey: map[string]any{"city": "Lyon"},
+	}
+
+	params, err := r.Render(entry)
+	assert.NoError(t, err)
+	assert.NotContains(t, params, engine.VarsKey)
+	assert.Equal(t, 100, params["max_tokens"])
+	assert.Len(t, params["user"], 36)
+	content := params["messages"].([]interface{})[0].(map[string]interface{})["content"].(string)
+	assert.Regexp(t, `^Hi, I am Ada from Lyon, pick [1-3] of [ab]$`, content)
+
+	// The entry is left untouched
+	assert.Contains(t, entry["messages"].([]interface{})[0].(map[string]interface{})["content"], "{{.user_name}}")
+	assert.Contains(t, entry, engine.VarsKey)
+}
+
+func TestTemplateRenderer_Fake(t *testing.T) {
+	r := NewTemplateRenderer(nil)
+	params, err := r.Render(provider.AnyParams{"prompt": `{{fake "sentence:5"}}|{{fake "email"}}`})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[^|{]+\|\S+@\S+$`, params["prompt"])
+}
+
+func TestTemplateRenderer_Errors(t *testing.T) {
+	r := NewTemplateRenderer(nil)
+	for _, source := range []string{"{{.missing}}", "{{randInt 3 1}}", "{{unknown}}", `{{fake "no_such_function"}}`} {
+		_, err := r.Render(provider.AnyParams{"prompt": source})
+		assert.Error(t, err, source)
+	}
+}
+
+func TestLoadTemplateVars(t *testing.T) {
+	rows, err := LoadTemplateVars(writeDatasetFile(t, "vars.csv", "\ufeffuser_name,plan\nAda,pro\nBob,free\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"user_name": "Ada", "plan": "pro"}, {"user_name": "Bob", "plan": "free"}}, rows)
+
+	rows, err = LoadTemplateVars(writeDatasetFile(t, "vars.jsonl", `{"user_name": "Ada", "age": 36}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"user_name": "Ada", "age": 36.0}}, rows)
+
+	_, err = LoadTemplateVars(writeDatasetFile(t, "empty.csv", "user_name\n"))
+	assert.Error(t, err)
+}
+
+func TestAssignTemplateVars(t *testing.T) {
+	// The first two entries are the same map, as in a mixed workload
+	entry := provider.AnyParams{"prompt": "{{.n}} {{.user_name}}"}
+	dataset := []provider.AnyParams{entry, entry, {"prompt": "{{.n}} {{.user_name}}"}}
+	dataset[2][engine.VarsKey] = map[string]any{"user_name": "Eve"}
+	AssignTemplateVars(dataset, []map[string]any{{"n": "0", "user_name": "Ada"}, {"n": "1", "user_name": "Bob"}})
+	assert.NotContains(t, entry, engine.VarsKey)
+
+	r := NewTemplateRenderer(nil)
+	for i, want := range []string{"0 Ada", "1 Bob", "0 Eve"} {
+		params, err := r.Render(dataset[i])
+		assert.NoError(t, err)
+		assert.Equal(t, want, params["prompt"], strconv.Itoa(i))
+	}
+}
+
+func TestRenderExampleTemplates(t *testing.T) {
+	dataset, err := LoadDataset(&config.DatasetConfig{Type: "jsonl", Path: "../../examples/templated.jsonl"}, nil, "")
+	assert.NoError(t, err)
+
+	r := NewTemplateRenderer(nil)
+	for _, entry := range dataset {
+		params, err := r.Render(entry)
+		assert.NoError(t, err)
+		assert.NotContains(t, fmt.Sprint(params), "{{")
+	}
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"container/heap"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits a text into tokens offline, without the tokenize endpoint of a server.
+// Special and added tokens are not matched, as the prompts of a benchmark are plain text.
+type Tokenizer interface {
+	// TokenEnds returns the byte offset in text of the end of each token
+	TokenEnds(text string) []int
+	// CountTokens returns the number of tokens of text
+	CountTokens(text string) int
+}
+
+// LoadTokenizer loads a HuggingFace tokenizer.json (a file ending with .json) or a tiktoken encoding file
+func LoadTokenizer(path string) (Tokenizer, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return loadHFTokenizer(path)
+	}
+	return loadTiktoken(path)
+}
+
+// TruncateToTokens returns the first n tokens of text, or text if it has less tokens.
+// A cut inside a multi-byte character moves back to the start of the character.
+func TruncateToTokens(tok Tokenizer, text string, n int) string {
+	ends := tok.TokenEnds(text)
+	if n >= len(ends) {
+		return text
+	}
+	if n <= 0 {
+		return ""
+	}
+	end := ends[n-1]
+	for end > 0 && end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end]
+}
+
+// promptCutAttempts is the number of cuts GetRandomPromptByTokenizer tries to size a prompt
+const promptCutAttempts = 8
+
+// GetRandomPromptByTokenizer generates a random prompt of targetTokens tokens of the offline tokenizer. The tokens
+// at the cut of the prompt may differ once it is cut, e.g. the merges of a BPE piece, so the cut prompt is counted
+// again and the cut moved until the count matches. If no cut matches, the closest prompt is returned.
+func GetRandomPromptByTokenizer(tok Tokenizer, targetTokens int) string {
+	if targetTokens <= 0 {
+		return ""
+	}
+	prompt := generateRandomWords(targetTokens)
+	for count := tok.CountTokens(prompt); count < targetTokens; count = tok.CountTokens(prompt) {
+		prompt += " " + generateRandomWords(targetTokens-count)
+	}
+
+	ends := tok.TokenEnds(prompt)
+	best, bestDiff := "", -1
+	tried := make(map[int]bool, promptCutAttempts)
+	for n := targetTokens; n >= 1 && n <= len(ends) && !tried[n] && len(tried) < promptCutAttempts; {
+		tried[n] = true
+		cut := TruncateToTokens(tok, prompt, n)
+		diff := tok.CountTokens(cut) - targetTokens
+		// Among cuts as far from the target, the longer one, rather than an empty prompt
+		if bestDiff < 0 || abs(diff) < bestDiff || (abs(diff) == bestDiff && diff > 0) {
+			best, bestDiff = cut, abs(diff)
+		}
+		switch {
+		case diff > 0:
+			n--
+		case diff < 0:
+			n++
+		default:
+			return cut
+		}
+	}
+	return best
+}
+
+// Pre-tokenization patterns of the byte-level BPE tokenizers. RE2 has no lookahead, the "\s+(?!\S)"
+// alternative of the original patterns is emulated by preTokenizer.
+const (
+	gpt2Pattern   = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	o200kPattern  = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+)
+
+// whitespaceLookahead is the alternative of the patterns which RE2 does not support
+const whitespaceLookahead = `\s+(?!\S)|`
+
+// preTokenizer splits a text into the pieces which are tokenized separately
+type preTokenizer struct {
+	re *regexp.Regexp
+	// Whether the pattern had the "\s+(?!\S)" alternative: a run of whitespace followed by a non-space
+	// leaves its last character to the next piece
+	lookahead bool
+}
+
+// newPreTokenizer compiles a pre-tokenization pattern
+func newPreTokenizer(pattern string) (*preTokenizer, error) {
+	p := &preTokenizer{}
+	if strings.Contains(pattern, whitespaceLookahead) {
+		pattern = strings.Replace(pattern, whitespaceLookahead, "", 1)
+		p.lookahead = true
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported pre-tokenization pattern: %w", err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// split returns the [start, end) offsets of the pieces of text, the text not matched by the pattern is a piece too
+func (p *preTokenizer) split(text string) [][2]int {
+	var pieces [][2]int
+	for pos := 0; pos < len(text); {
+		loc := p.re.FindStringIndex(text[pos:])
+		if loc == nil {
+			pieces = append(pieces, [2]int{pos, len(text)})
+			break
+		}
+		if loc[0] > 0 {
+			pieces = append(pieces, [2]int{pos, pos + loc[0]})
+			pos += loc[0]
+			continue
+		}
+		end := pos + loc[1]
+		if loc[1] == 0 {
+			// An empty match does not progress, the next character is a piece of its own
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			end = pos + size
+		} else if p.lookahead && end < len(text) {
+			match := text[pos:end]
+			if last, size := utf8.DecodeLastRuneInString(match); isAllSpace(match) && last != '\n' && last != '\r' &&
+				size < len(match) {
+				end -= size
+			}
+		}
+		pieces = append(pieces, [2]int{pos, end})
+		pos = end
+	}
+	return pieces
+}
+
+// isAllSpace reports whether s only has whitespace
+func isAllSpace(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// bpeSymbol is a symbol of a piece being merged, with its [start, end) offsets in the text
+type bpeSymbol struct {
+	key        string
+	start, end int
+}
+
+// bpeMerge merges the adjacent symbols of a piece by increasing rank, the leftmost pair first among equal ranks,
+// until no pair has a rank, as both tiktoken and the HuggingFace BPE model do, rank returns false for a pair
+// which does not merge. The pairs wait in a priority queue, so that a long piece merges in O(n log n).
+func bpeMerge(symbols []bpeSymbol, rank func(a, b string) (int, bool)) []bpeSymbol {
+	n := len(symbols)
+	if n < 2 {
+		return symbols
+	}
+	prev := make([]int, n)  // index of the previous symbol, -1 for the first one
+	next := make([]int, n)  // index of the next symbol, n for the last one
+	gone := make([]bool, n) // the symbol was merged into its previous one
+	queue := make(bpeQueue, 0, n)
+	pair := func(left int) (bpePair, bool) {
+		right := next[left]
+		if right >= n {
+			return bpePair{}, false
+		}
+		r, ok := rank(symbols[left].key, symbols[right].key)
+		return bpePair{rank: r, left: left, right: right, end: symbols[right].end}, ok
+	}
+	for i := range symbols {
+		prev[i], next[i] = i-1, i+1
+	}
+	for i := 0; i < n-1; i++ {
+		if p, ok := pair(i); ok {
+			queue = append(queue, p)
+		}
+	}
+	heap.Init(&queue)
+
+	for queue.Len() > 0 {
+		p := heap.Pop(&queue).(bpePair)
+		// A pair is stale once either of its symbols has changed
+		if gone[p.left] || next[p.left] != p.right || symbols[p.right].end != p.end {
+			continue
+		}
+		symbols[p.left].key += symbols[p.right].key
+		symbols[p.left].end = symbols[p.right].end
+		gone[p.right] = true
+		next[p.left] = next[p.right]
+		if next[p.left] < n {
+			prev[next[p.left]] = p.left
+		}
+		for _, left := range []int{prev[p.left], p.left} {
+			if left < 0 {
+				continue
+			}
+			if q, ok := pair(left); ok {
+				heap.Push(&queue, q)
+			}
+		}
+	}
+
+	merged := symbols[:0]
+	for i, s := range symbols {
+		if !gone[i] {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// bpePair is a pair of adjacent symbols which merge, with the end of its right symbol to detect its changes
+type bpePair struct {
+	rank, left, right, end int
+}
+
+// bpeQueue is a heap of pairs by rank then position
+type bpeQueue []bpePair
+
+func (q bpeQueue) Len() int { return len(q) }
+func (q bpeQueue) Less(i, j int) bool {
+	return q[i].rank < q[j].rank || (q[i].rank == q[j].rank && q[i].left < q[j].left)
+}
+func (q bpeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *bpeQueue) Push(x any)   { *q = append(*q, x.(bpePair)) }
+func (q *bpeQueue) Pop() any {
+	old := *q
+	p := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return p
+}
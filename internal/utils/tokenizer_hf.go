@@ -0,0 +1,383 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// metaspace is the replacement of the spaces of the SentencePiece style tokenizers
+const metaspace = "▁"
+
+// hfComponent is a normalizer or a pre-tokenizer of a tokenizer.json, only the fields used here are decoded
+type hfComponent struct {
+	Type          string        `json:"type"`
+	Normalizers   []hfComponent `json:"normalizers"`   // Sequence normalizer
+	Pretokenizers []hfComponent `json:"pretokenizers"` // Sequence pre-tokenizer
+	Pattern       struct {
+		Regex  string `json:"Regex"`
+		String string `json:"String"`
+	} `json:"pattern"` // Split pre-tokenizer and Replace normalizer
+	Content       string `json:"content"`        // Replace normalizer
+	Prepend       string `json:"prepend"`        // Prepend normalizer
+	PrependScheme string `json:"prepend_scheme"` // Metaspace pre-tokenizer
+	Split         *bool  `json:"split"`          // Metaspace pre-tokenizer
+	UseRegex      *bool  `json:"use_regex"`      // ByteLevel pre-tokenizer
+	Lowercase     *bool  `json:"lowercase"`      // BertNormalizer
+}
+
+// flatten returns the components of a component, which are several for a Sequence
+func (c *hfComponent) flatten() []hfComponent {
+	if c == nil {
+		return nil
+	}
+	if c.Type != "Sequence" {
+		return []hfComponent{*c}
+	}
+	var flat []hfComponent
+	for _, sub := range append(c.Normalizers, c.Pretokenizers...) {
+		flat = append(flat, sub.flatten()...)
+	}
+	return flat
+}
+
+// hfTokenizerFile represents the fields of a tokenizer.json used here
+type hfTokenizerFile struct {
+	Normalizer   *hfComponent `json:"normalizer"`
+	PreTokenizer *hfComponent `json:"pre_tokenizer"`
+	Model        struct {
+		Type                    string            `json:"type"`
+		Vocab                   map[string]int    `json:"vocab"`
+		Merges                  []json.RawMessage `json:"merges"`
+		ByteFallback            bool              `json:"byte_fallback"`
+		IgnoreMerges            bool              `json:"ignore_merges"`
+		ContinuingSubwordPrefix *string           `json:"continuing_subword_prefix"`
+		MaxInputCharsPerWord    int               `json:"max_input_chars_per_word"`
+	} `json:"model"`
+}
+
+// hfBPE is the tokenizer of a HuggingFace BPE model, either byte-level (GPT-2, Llama 3, Qwen...)
+// or SentencePiece style with metaspaces (Llama 2, Mistral...)
+type hfBPE struct {
+	vocab        map[string]int
+	merges       map[[2]string]int
+	byteFallback bool
+	ignoreMerges bool
+
+	byteLevel bool
+	pre       *preTokenizer // byte-level pre-tokenization, nil if the text is a single piece
+	prepend   bool          // metaspace prepended to a text which does not start with a space, by the Metaspace pre-tokenizer
+	prefix    string        // prepended to any text by the Prepend normalizer, e.g. "▁" for Llama 2
+	split     bool          // the Metaspace pre-tokenizer splits the text before each metaspace
+}
+
+// hfWordPiece is the tokenizer of a HuggingFace WordPiece model (BERT...)
+type hfWordPiece struct {
+	vocab        map[string]int
+	prefix       string
+	maxWordChars int
+	lowercase    bool
+}
+
+// loadHFTokenizer loads a HuggingFace tokenizer.json with a BPE or WordPiece model
+func loadHFTokenizer(path string) (Tokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer file: %w", err)
+	}
+	var file hfTokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tokenizer file: %w", err)
+	}
+	if len(file.Model.Vocab) == 0 {
+		return nil, fmt.Errorf("tokenizer file %s has no vocab", path)
+	}
+
+	normalizers, preTokenizers := file.Normalizer.flatten(), file.PreTokenizer.flatten()
+	switch file.Model.Type {
+	case "BPE":
+		return newHFBPE(&file, normalizers, preTokenizers)
+	case "WordPiece":
+		t := &hfWordPiece{
+			vocab:        file.Model.Vocab,
+			prefix:       "##",
+			maxWordChars: file.Model.MaxInputCharsPerWord,
+		}
+		if file.Model.ContinuingSubwordPrefix != nil {
+			t.prefix = *file.Model.ContinuingSubwordPrefix
+		}
+		if t.maxWordChars <= 0 {
+			t.maxWordChars = 100
+		}
+		for _, n := range normalizers {
+			if n.Type == "Lowercase" || (n.Type == "BertNormalizer" && (n.Lowercase == nil || *n.Lowercase)) {
+				t.lowercase = true
+			}
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unsupported tokenizer model: %q", file.Model.Type)
+	}
+}
+
+// newHFBPE creates the tokenizer of a BPE model
+func newHFBPE(file *hfTokenizerFile, normalizers, preTokenizers []hfComponent) (*hfBPE, error) {
+	t := &hfBPE{
+		vocab:        file.Model.Vocab,
+		merges:       make(map[[2]string]int, len(file.Model.Merges)),
+		byteFallback: file.Model.ByteFallback,
+		ignoreMerges: file.Model.IgnoreMerges,
+	}
+	// Merges are either "a b" or ["a", "b"]
+	for rank, raw := range file.Model.Merges {
+		var pair [2]string
+		var merge string
+		if err := json.Unmarshal(raw, &merge); err == nil {
+			first, second, ok := strings.Cut(merge, " ")
+			if !ok {
+				return nil, fmt.Errorf("invalid merge %d: %q", rank, merge)
+			}
+			pair = [2]string{first, second}
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("invalid merge %d: %s", rank, raw)
+		}
+		if _, ok := t.merges[pair]; !ok {
+			t.merges[pair] = rank
+		}
+	}
+
+	pattern, metaspaced := "", false
+	for _, p := range preTokenizers {
+		switch p.Type {
+		case "ByteLevel":
+			t.byteLevel = true
+			if pattern == "" && (p.UseRegex == nil || *p.UseRegex) {
+				pattern = gpt2Pattern
+			}
+		case "Split":
+			if pattern == "" {
+				pattern = p.Pattern.Regex
+				if pattern == "" {
+					pattern = regexp.QuoteMeta(p.Pattern.String)
+				}
+			}
+		case "Metaspace":
+			metaspaced = true
+			t.prepend = p.PrependScheme != "never"
+			t.split = p.Split == nil || *p.Split
+		}
+	}
+	for _, n := range normalizers {
+		switch {
+		case n.Type == "Replace" && n.Content == metaspace:
+			metaspaced = true
+		case n.Type == "Prepend":
+			t.prefix = strings.ReplaceAll(n.Prepend, " ", metaspace)
+		}
+	}
+
+	switch {
+	case t.byteLevel:
+		if pattern != "" {
+			pre, err := newPreTokenizer(pattern)
+			if err != nil {
+				return nil, err
+			}
+			t.pre = pre
+		}
+	case !metaspaced:
+		return nil, fmt.Errorf("unsupported BPE tokenizer, neither byte-level nor metaspace")
+	}
+	return t, nil
+}
+
+// TokenEnds implements Tokenizer
+func (t *hfBPE) TokenEnds(text string) []int {
+	var ends []int
+	for _, piece := range t.pieces(text) {
+		ends = t.tokenize(piece, ends)
+	}
+	return ends
+}
+
+// CountTokens implements Tokenizer
+func (t *hfBPE) CountTokens(text string) int {
+	return len(t.TokenEnds(text))
+}
+
+// pieces returns the initial symbols of each piece of text
+func (t *hfBPE) pieces(text string) [][]bpeSymbol {
+	var pieces [][]bpeSymbol
+	if t.byteLevel {
+		split := [][2]int{{0, len(text)}}
+		if t.pre != nil {
+			split = t.pre.split(text)
+		}
+		for _, piece := range split {
+			symbols := make([]bpeSymbol, 0, piece[1]-piece[0])
+			for i := piece[0]; i < piece[1]; i++ {
+				symbols = append(symbols, bpeSymbol{key: byteLevelChars[text[i]], start: i, end: i + 1})
+			}
+			pieces = append(pieces, symbols)
+		}
+		return pieces
+	}
+
+	// Metaspace: the spaces are metaspaces, and the prepended ones have a zero width. The text is a single piece,
+	// in which runs of spaces merge into "▁▁" tokens, unless the pre-tokenizer starts a piece at each space.
+	if text == "" {
+		return nil
+	}
+	var symbols []bpeSymbol
+	for _, r := range t.prefix {
+		symbols = append(symbols, bpeSymbol{key: string(r)})
+	}
+	if t.prepend && !strings.HasPrefix(text, " ") {
+		symbols = append(symbols, bpeSymbol{key: metaspace})
+	}
+	for i, r := range text {
+		key := string(r)
+		if r == ' ' {
+			key = metaspace
+			if t.split && len(symbols) > 0 {
+				pieces = append(pieces, symbols)
+				symbols = nil
+			}
+		}
+		symbols = append(symbols, bpeSymbol{key: key, start: i, end: i + utf8.RuneLen(r)})
+	}
+	if len(symbols) > 0 {
+		pieces = append(pieces, symbols)
+	}
+	return pieces
+}
+
+// tokenize merges the symbols of a piece and appends the ends of its tokens to ends
+func (t *hfBPE) tokenize(symbols []bpeSymbol, ends []int) []int {
+	if t.ignoreMerges {
+		var word strings.Builder
+		for _, s := range symbols {
+			word.WriteString(s.key)
+		}
+		if _, ok := t.vocab[word.String()]; ok {
+			return append(ends, symbols[len(symbols)-1].end)
+		}
+	}
+
+	for _, s := range bpeMerge(symbols, func(a, b string) (int, bool) {
+		r, ok := t.merges[[2]string{a, b}]
+		return r, ok
+	}) {
+		if _, ok := t.vocab[s.key]; ok || !t.byteFallback {
+			// A symbol out of the vocab is a single unknown token
+			ends = append(ends, s.end)
+			continue
+		}
+		// Byte fallback: one token per byte
+		for i := 1; i <= len(s.key); i++ {
+			ends = append(ends, min(s.start+i, s.end))
+		}
+	}
+	return ends
+}
+
+// byteLevelChars maps the bytes to the printable characters of the byte-level BPE vocabs (bytes_to_unicode of GPT-2)
+var byteLevelChars = func() [256]string {
+	var chars [256]string
+	n := 0
+	for b := 0; b < 256; b++ {
+		if ('!' <= b && b <= '~') || ('¡' <= b && b <= '¬') || ('®' <= b && b <= 'ÿ') {
+			chars[b] = string(rune(b))
+		} else {
+			chars[b] = string(rune(256 + n))
+			n++
+		}
+	}
+	return chars
+}()
+
+// TokenEnds implements Tokenizer
+func (t *hfWordPiece) TokenEnds(text string) []int {
+	var ends []int
+	for _, word := range t.words(text) {
+		ends = t.tokenize(text, word, ends)
+	}
+	return ends
+}
+
+// CountTokens implements Tokenizer
+func (t *hfWordPiece) CountTokens(text string) int {
+	return len(t.TokenEnds(text))
+}
+
+// words splits text on whitespace and isolates punctuation and CJK characters, as the BERT pre-tokenizer does
+func (t *hfWordPiece) words(text string) [][2]int {
+	var words [][2]int
+	start := -1
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			if start >= 0 {
+				words = append(words, [2]int{start, i})
+				start = -1
+			}
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.Is(unicode.Han, r):
+			if start >= 0 {
+				words = append(words, [2]int{start, i})
+				start = -1
+			}
+			words = append(words, [2]int{i, i + utf8.RuneLen(r)})
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		words = append(words, [2]int{start, len(text)})
+	}
+	return words
+}
+
+// tokenize splits a word into the longest subwords of the vocab and appends the ends of its tokens to ends,
+// a word which can not be split is a single unknown token
+func (t *hfWordPiece) tokenize(text string, word [2]int, ends []int) []int {
+	var (
+		keys    []string
+		offsets []int // end offset of each rune
+	)
+	for i, r := range text[word[0]:word[1]] {
+		offsets = append(offsets, word[0]+i+utf8.RuneLen(r))
+		if t.lowercase {
+			r = unicode.ToLower(r)
+		}
+		keys = append(keys, string(r))
+	}
+	if len(keys) > t.maxWordChars {
+		return append(ends, word[1])
+	}
+
+	var tokens []int
+	for start := 0; start < len(keys); {
+		end := len(keys)
+		for ; end > start; end-- {
+			sub := strings.Join(keys[start:end], "")
+			if start > 0 {
+				sub = t.prefix + sub
+			}
+			if _, ok := t.vocab[sub]; ok {
+				break
+			}
+		}
+		if end == start {
+			return append(ends, word[1])
+		}
+		tokens = append(tokens, offsets[end-1])
+		start = end
+	}
+	return append(ends, tokens...)
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTokenizerFile writes a tokenizer fixture to a temp file named name
+func writeTokenizerFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testTiktoken returns a tiktoken file with the lowercase letters, the space and a few merges
+func testTiktoken(t *testing.T) string {
+	var sb strings.Builder
+	tokens := []string{" "}
+	for c := 'a'; c <= 'z'; c++ {
+		tokens = append(tokens, string(c))
+	}
+	tokens = append(tokens, "he", "ll", "llo", "hello", " w", "or")
+	for rank, token := range tokens {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	return writeTokenizerFile(t, "cl100k_base.tiktoken", sb.String())
+}
+
+func TestTiktoken(t *testing.T) {
+	tok, err := LoadTokenizer(testTiktoken(t))
+	assert.NoError(t, err)
+
+	// "hello" is a token, " world" merges " w" and "or"
+	assert.Equal(t, []int{5, 7, 9, 10, 11}, tok.TokenEnds("hello world"))
+	assert.Equal(t, 2, tok.CountTokens("hell")) // "he" and "ll", "hell" is not a token
+	assert.Equal(t, 0, tok.CountTokens(""))
+}
+
+func TestHFTokenizer_ByteLevel(t *testing.T) {
+	path := writeTokenizerFile(t, "tokenizer.json", `{
+		"pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+		"model": {
+			"type": "BPE",
+			"vocab": {"h": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "w": 5, "r": 6, "d": 7,
+				"he": 8, "ll": 9, "hell": 10, "hello": 11, "Ġw": 12},
+			"merges": ["h e", "l l", ["he", "ll"], "hell o", "Ġ w"]
+		}
+	}`)
+	tok, err := LoadTokenizer(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{5, 7, 8, 9, 10, 11}, tok.TokenEnds("hello world"))
+}
+
+func TestHFTokenizer_MetaspaceByteFallback(t *testing.T) {
+	path := writeTokenizerFile(t, "tokenizer.json", `{
+		"pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always"},
+		"model": {
+			"type": "BPE",
+			"byte_fallback": true,
+			"vocab": {"▁": 0, "h": 1, "i": 2, "▁h": 3, "▁hi": 4},
+			"merges": ["▁ h", "▁h i"]
+		}
+	}`)
+	tok, err := LoadTokenizer(path)
+	assert.NoError(t, err)
+
+	// "你" is out of the vocab, one token per byte
+	text := "hi 你"
+	assert.Equal(t, []int{2, 3, 4, 5, 6}, tok.TokenEnds(text))
+	// A cut inside "你" moves back to its start
+	assert.Equal(t, "hi ", TruncateToTokens(tok, text, 3))
+	assert.Equal(t, "hi", TruncateToTokens(tok, text, 1))
+	assert.Equal(t, text, TruncateToTokens(tok, text, 10))
+}
+
+// testLlama2Tokenizer returns a tokenizer.json of the Llama 2 style, whose normalizers prepend a metaspace
+// and replace the spaces, without pre-tokenizer
+func testLlama2Tokenizer(t *testing.T) string {
+	return writeTokenizerFile(t, "tokenizer.json", `{
+		"normalizer": {"type": "Sequence", "normalizers": [
+			{"type": "Prepend", "prepend": "▁"},
+			{"type": "Replace", "pattern": {"String": " "}, "content": "▁"}
+		]},
+		"pre_tokenizer": null,
+		"model": {
+			"type": "BPE",
+			"byte_fallback": true,
+			"vocab": {"▁": 0, "h": 1, "i": 2, "▁▁": 3, "▁h": 4, "▁hi": 5},
+			"merges": ["▁ ▁", "▁ h", "▁h i"]
+		}
+	}`)
+}
+
+func TestHFTokenizer_Llama2Normalizer(t *testing.T) {
+	tok, err := LoadTokenizer(testLlama2Tokenizer(t))
+	assert.NoError(t, err)
+
+	// The text is not split at the spaces, so that two spaces merge into "▁▁"
+	assert.Equal(t, []int{2, 4, 5, 6}, tok.TokenEnds("hi  hi"))
+	// The metaspace is prepended to a text starting with a space too
+	assert.Equal(t, []int{1, 2, 3}, tok.TokenEnds(" hi"))
+	assert.Equal(t, 0, tok.CountTokens(""))
+}
+
+func TestBPEMerge(t *testing.T) {
+	ranks := map[string]int{"aa": 0, "aaaa": 1}
+	var symbols []bpeSymbol
+	for i := range 5 {
+		symbols = append(symbols, bpeSymbol{key: "a", start: i, end: i + 1})
+	}
+
+	// The leftmost pair merges first among equal ranks
+	merged := bpeMerge(symbols, func(a, b string) (int, bool) {
+		r, ok := ranks[a+b]
+		return r, ok
+	})
+	assert.Equal(t, []bpeSymbol{{key: "aaaa", start: 0, end: 4}, {key: "a", start: 4, end: 5}}, merged)
+}
+
+func TestHFTokenizer_WordPiece(t *testing.T) {
+	path := writeTokenizerFile(t, "tokenizer.json", `{
+		"normalizer": {"type": "BertNormalizer", "lowercase": true},
+		"pre_tokenizer": {"type": "BertPreTokenizer"},
+		"model": {
+			"type": "WordPiece",
+			"unk_token": "[UNK]",
+			"continuing_subword_prefix": "##",
+			"vocab": {"[UNK]": 0, "hello": 1, "un": 2, "##aff": 3, "##able": 4, ",": 5}
+		}
+	}`)
+	tok, err := LoadTokenizer(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{5, 6, 9, 12, 16, 20}, tok.TokenEnds("Hello, unaffable xyz"))
+}
+
+func TestLoadTokenizer_Invalid(t *testing.T) {
+	_, err := LoadTokenizer(filepath.Join(t.TempDir(), "missing.tiktoken"))
+	assert.Error(t, err)
+
+	_, err = LoadTokenizer(writeTokenizerFile(t, "tokenizer.json", `{"model": {"type": "Unigram", "vocab": {"a": 0}}}`))
+	assert.Error(t, err)
+}
+
+func TestPreTokenizer_WhitespaceLookahead(t *testing.T) {
+	pre, err := newPreTokenizer(gpt2Pattern)
+	assert.NoError(t, err)
+
+	// A run of spaces leaves its last one to the next word, except at the end of the text
+	assert.Equal(t, [][2]int{{0, 1}, {1, 2}, {2, 4}}, pre.split("a  b"))
+	assert.Equal(t, [][2]int{{0, 1}, {1, 3}}, pre.split("a  "))
+}
+
+func TestGetRandomPromptByTokenizer(t *testing.T) {
+	tok, err := LoadTokenizer(testTiktoken(t))
+	assert.NoError(t, err)
+
+	for _, n := range []int{1, 50, 300} {
+		assert.Equal(t, n, tok.CountTokens(GetRandomPromptByTokenizer(tok, n)))
+	}
+
+	// The tokens of a single BPE piece may change at the cut, the prompt is counted again
+	tok, err = LoadTokenizer(testLlama2Tokenizer(t))
+	assert.NoError(t, err)
+	for _, n := range []int{2, 50, 300} {
+		assert.Equal(t, n, tok.CountTokens(GetRandomPromptByTokenizer(tok, n)))
+	}
+	assert.Empty(t, GetRandomPromptByTokenizer(tok, 0))
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tiktoken is the tokenizer of a tiktoken encoding file, whose lines are "<base64 token> <rank>"
+type tiktoken struct {
+	ranks map[string]int
+	pre   *preTokenizer
+}
+
+// loadTiktoken loads a tiktoken encoding file. The pre-tokenization pattern is chosen by the file name:
+// o200k_base for o200k, the GPT-2 one for r50k and p50k, cl100k_base otherwise.
+func loadTiktoken(path string) (*tiktoken, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tiktoken file: %w", err)
+	}
+	defer file.Close()
+
+	t := &tiktoken{ranks: make(map[string]int)}
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid tiktoken line %d", lineNum)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token at tiktoken line %d: %w", lineNum, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank at tiktoken line %d: %w", lineNum, err)
+		}
+		t.ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tiktoken file: %w", err)
+	}
+	if len(t.ranks) == 0 {
+		return nil, fmt.Errorf("tiktoken file %s has no token", path)
+	}
+
+	pattern := cl100kPattern
+	switch name := strings.ToLower(filepath.Base(path)); {
+	case strings.Contains(name, "o200k"):
+		pattern = o200kPattern
+	case strings.Contains(name, "r50k"), strings.Contains(name, "p50k"):
+		pattern = gpt2Pattern
+	}
+	if t.pre, err = newPreTokenizer(pattern); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TokenEnds implements Tokenizer
+func (t *tiktoken) TokenEnds(text string) []int {
+	var ends []int
+	for _, piece := range t.pre.split(text) {
+		// A piece which is a token is not merged
+		if _, ok := t.ranks[text[piece[0]:piece[1]]]; ok {
+			ends = append(ends, piece[1])
+			continue
+		}
+		symbols := make([]bpeSymbol, 0, piece[1]-piece[0])
+		for i := piece[0]; i < piece[1]; i++ {
+			symbols = append(symbols, bpeSymbol{key: text[i : i+1], start: i, end: i + 1})
+		}
+		// tiktoken merges the pair whose concatenation has the lowest rank
+		for _, s := range bpeMerge(symbols, func(a, b string) (int, bool) {
+			r, ok := t.ranks[a+b]
+			return r, ok
+		}) {
+			ends = append(ends, s.end)
+		}
+	}
+	return ends
+}
+
+// CountTokens implements Tokenizer
+func (t *tiktoken) CountTokens(text string) int {
+	return len(t.TokenEnds(text))
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/FortuneW/gollmperf/internal/engine"
+	"github.com/FortuneW/gollmperf/internal/provider"
+)
+
+// traceRecord is a line of a trace: the time of the request, either its offset in seconds from the start
+// of the trace or its timestamp, and either the request body or its input and output token lengths
+type traceRecord struct {
+	Offset    *float64           `json:"offset"`
+	Timestamp any                `json:"timestamp"` // RFC 3339 time or Unix time in seconds
+	Body      provider.AnyParams `json:"body"`
+	InputLen  int                `json:"input_len"`
+	OutputLen int                `json:"output_len"`
+}
+
+// at returns the time of the record, from the start of the trace or from the Unix epoch
+func (r *traceRecord) at() (time.Duration, error) {
+	if r.Offset != nil {
+		return time.Duration(*r.Offset * float64(time.Second)), nil
+	}
+	switch ts := r.Timestamp.(type) {
+	case float64:
+		return time.Duration(ts * float64(time.Second)), nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q: %w", ts, err)
+		}
+		return time.Duration(t.UnixNano()), nil
+	case nil:
+		return 0, fmt.Errorf("no offset nor timestamp")
+	default:
+		return 0, fmt.Errorf("invalid timestamp %v", ts)
+	}
+}
+
+// LoadTrace loads the requests of the window of a trace sorted by time, with their offsets from the start
+// of the window. A request recorded with its token lengths is a prompt of random words, sized with the
+// offline tokenizer if not nil, or with the tokens per word measured once with the /tokenize endpoint.
+func LoadTrace(cfg *config.ReplayConfig, tok Tokenizer, endpoint, systemPrompt string) ([]engine.TraceRequest, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("no trace file, set test.replay.path or --trace")
+	}
+	if cfg.End > 0 && cfg.End <= cfg.Start {
+		return nil, fmt.Errorf("empty replay window [%v, %v)", cfg.Start, cfg.End)
+	}
+	records, err := loadJSONRecords[traceRecord](cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("trace %s has no request", cfg.Path)
+	}
+
+	times := make([]time.Duration, len(records))
+	order := make([]int, len(records))
+	for i := range records {
+		if times[i], err = records[i].at(); err != nil {
+			return nil, fmt.Errorf("trace record %d: %w", i+1, err)
+		}
+		if records[i].Body == nil && records[i].InputLen <= 0 {
+			return nil, fmt.Errorf("trace record %d: no body nor input_len", i+1)
+		}
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(times[a], times[b])
+	})
+
+	var wordsPerToken float64
+	first := times[order[0]]
+	trace := make([]engine.TraceRequest, 0, len(records))
+	for _, i := range order {
+		offset := times[i] - first
+		if offset < cfg.Start || (cfg.End > 0 && offset >= cfg.End) {
+			continue
+		}
+
+		record := records[i]
+		params := record.Body
+		if params == nil {
+			var prompt string
+			if tok != nil {
+				prompt = GetRandomPromptByTokenizer(tok, record.InputLen)
+			} else {
+				if wordsPerToken == 0 {
+					wordsPerToken = measureWordsPerToken(endpoint)
+				}
+				prompt = randomWords(max(int(math.Ceil(float64(record.InputLen)*wordsPerToken)), 1))
+			}
+			params = provider.AnyParams{
+				"messages": []interface{}{
+					map[string]interface{}{
+						"role":    "user",
+						"content": prompt,
+					},
+				},
+			}
+			if record.OutputLen > 0 {
+				params["max_tokens"] = record.OutputLen
+				params["ignore_eos"] = true
+			}
+		}
+		trace = append(trace, engine.TraceRequest{
+			Offset: offset - cfg.Start,
+			Params: addSystemPromptToMessages(params, systemPrompt),
+		})
+	}
+
+	if len(trace) == 0 {
+		return nil, fmt.Errorf("no request of trace %s in the window [%v, %v)", cfg.Path, cfg.Start, cfg.End)
+	}
+	return trace, nil
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FortuneW/gollmperf/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTrace(t *testing.T) {
+	tok, err := LoadTokenizer(testTiktoken(t))
+	assert.NoError(t, err)
+	path := writeDatasetFile(t, "trace.jsonl", `{"offset": 2.5, "input_len": 40, "output_len": 8}
+{"offset": 0.5, "body": {"messages": [{"role": "user", "content": "Hi"}], "max_tokens": 16}}
+{"offset": 1, "input_len": 12}
+{"offset": 9, "body": {"prompt": "late"}}
+`)
+
+	trace, err := LoadTrace(&config.ReplayConfig{Path: path}, tok, "", "Be brief")
+	assert.NoError(t, err)
+	assert.Len(t, trace, 4)
+	assert.Equal(t, []time.Duration{0, 500 * time.Millisecond, 2 * time.Second, 8500 * time.Millisecond},
+		[]time.Duration{trace[0].Offset, trace[1].Offset, trace[2].Offset, trace[3].Offset})
+	assert.Equal(t, "Hi", userContent(trace[0].Params))
+	assert.Equal(t, map[string]interface{}{"role": "system", "content": "Be brief"}, trace[0].Params["messages"].([]interface{})[0])
+	assert.Equal(t, 12, tok.CountTokens(userContent(trace[1].Params).(string)))
+	assert.NotContains(t, trace[1].Params, "max_tokens")
+	assert.Equal(t, 8, trace[2].Params["max_tokens"])
+
+	// The offsets of a window are from its start
+	trace, err = LoadTrace(&config.ReplayConfig{Path: path, Start: 500 * time.Millisecond, End: 5 * time.Second}, tok, "", "")
+	assert.NoError(t, err)
+	assert.Len(t, trace, 2)
+	assert.Equal(t, time.Duration(0), trace[0].Offset)
+	assert.Equal(t, 1500*time.Millisecond, trace[1].Offset)
+
+	_, err = LoadTrace(&config.ReplayConfig{Path: path, Start: 10 * time.Second}, tok, "", "")
+	assert.Error(t, err)
+}
+
+func TestLoadTrace_Timestamps(t *testing.T) {
+	path := writeDatasetFile(t, "trace.jsonl", `{"timestamp": "2025-06-01T10:00:01.25Z", "body": {"prompt": "b"}}
+{"timestamp": "2025-06-01T10:00:00Z", "body": {"prompt": "a"}}
+`)
+	trace, err := LoadTrace(&config.ReplayConfig{Path: path}, nil, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", trace[0].Params["prompt"])
+	assert.Equal(t, 1250*time.Millisecond, trace[1].Offset)
+
+	_, err = LoadTrace(&config.ReplayConfig{Path: writeDatasetFile(t, "bad.jsonl", `{"body": {"prompt": "a"}}`)}, nil, "", "")
+	assert.Error(t, err)
+}